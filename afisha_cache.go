@@ -0,0 +1,388 @@
+// Package main содержит общий кеш афиши и журнал изменений между загрузками.
+//
+// Этот файл реализует:
+// - afishaCache - последние загруженные спектакли Вахтангова, балета и театров из конфига с ограничением по возрасту
+// - diffShows() - сравнение двух снимков: новые даты, начало и окончание продаж
+// - runCacheRefresher() - фоновое обновление кеша, чтобы изменения фиксировались без запросов
+//
+// Взаимодействует с:
+// - vakhtangov_formatter.go: FetchAllShows() загружает спектакли Вахтангова
+// - ballet.go: RunBaletParser() загружает балеты
+// - theaters.go: fetchTheater() загружает афиши других театров
+// - telegram.go: бот берет афишу из кеша, кнопка "Обновить" загружает заново
+// - api_server.go: HTTP API отдает данные и журнал изменений из кеша
+// - metrics.go: успешные загрузки отмечаются для /readyz
+// - storage.go: журнал изменений сохраняется в storage.dir/changes.json
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CACHE_TTL — как долго данные в кеше считаются свежими по умолчанию (timeouts.cache_ttl в конфиге)
+const CACHE_TTL = 5 * time.Minute
+
+// cacheTTL returns the configured cache freshness
+func cacheTTL() time.Duration {
+	return currentConfig().Timeouts.CacheTTL.Duration
+}
+
+// CHANGE_LOG_LIMIT — сколько последних изменений хранится в памяти
+const CHANGE_LOG_LIMIT = 1000
+
+// Типы изменений сеанса между двумя снимками
+const (
+	ChangeAdded   = "added"    // объявлена новая дата
+	ChangeOnSale  = "on_sale"  // билеты появились в продаже
+	ChangeSoldOut = "sold_out" // билеты пропали из продажи
+)
+
+// changeEventTitle names the change type for people
+func changeEventTitle(event string) string {
+	switch event {
+	case ChangeAdded:
+		return "Новая дата"
+	case ChangeOnSale:
+		return "Билеты в продаже"
+	case ChangeSoldOut:
+		return "Билеты закончились"
+	}
+	return event
+}
+
+// PerformanceChange описывает изменение одного сеанса между двумя загрузками
+type PerformanceChange struct {
+	At          time.Time `json:"at"`
+	Event       string    `json:"event"`
+	ShowID      string    `json:"show_id"`
+	Title       string    `json:"title"`
+	Start       time.Time `json:"start"`
+	Stage       string    `json:"stage,omitempty"`
+	StageUID    string    `json:"stage_uid"`
+	DateTimeKey string    `json:"datetime_key"`
+	OldOnSale   bool      `json:"old_on_sale"`
+	NewOnSale   bool      `json:"new_on_sale"`
+	BuyLink     string    `json:"buy_link,omitempty"`
+	// Цены и места со страницы покупки, заполняются перед рассылкой; 0 — неизвестно
+	MinPrice  int `json:"min_price,omitempty"`
+	SeatsLeft int `json:"seats_left,omitempty"`
+}
+
+// performanceKey uniquely identifies a session across snapshots
+func performanceKey(inf ShowInfo) string {
+	return inf.StageUID + "/" + inf.DateTimeKey
+}
+
+type afishaCache struct {
+	// fetchMu не дает параллельным запросам одновременно загружать сайты
+	fetchMu sync.Mutex
+
+	mu       sync.RWMutex
+	shows    []Show
+	showsAt  time.Time
+	ballet   []BaletShow
+	balletAt time.Time
+	theaters map[string]theaterSnapshot // по id театра
+	changes  []PerformanceChange
+
+	// changesPath — файл, в котором журнал изменений переживает перезапуск; пусто — только в памяти
+	changesPath string
+}
+
+// theaterSnapshot — последняя загруженная афиша одного театра
+type theaterSnapshot struct {
+	shows []Show
+	at    time.Time
+}
+
+var cache = &afishaCache{}
+
+// Shows returns Vakhtangov shows no older than maxAge, fetching them if needed.
+// maxAge = 0 always fetches fresh data.
+func (c *afishaCache) Shows(ctx context.Context, maxAge time.Duration) ([]Show, time.Time, error) {
+	if shows, at, ok := c.cachedShows(maxAge); ok {
+		return shows, at, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Пока ждали блокировку, данные мог загрузить другой запрос
+	if maxAge > 0 {
+		if shows, at, ok := c.cachedShows(maxAge); ok {
+			return shows, at, nil
+		}
+	}
+
+	fresh, err := FetchAllShows(ctx, ShowFilter{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	merged := mergeFailedShows(c.shows, fresh)
+	var changes []PerformanceChange
+	if !c.showsAt.IsZero() {
+		changes = diffShows(c.shows, merged, now)
+		c.appendChanges(changes)
+	}
+	c.shows = merged
+	c.showsAt = now
+	changeLog, changesPath := c.changes, c.changesPath
+	c.mu.Unlock()
+
+	if len(changes) > 0 && changesPath != "" {
+		if err := writeJSONFile(changesPath, changeLog); err != nil {
+			logError(err)
+		}
+	}
+	markFetchSuccess(providerVakhtangovAPI, countSessions(merged))
+
+	return copyShows(merged), now, nil
+}
+
+func (c *afishaCache) cachedShows(maxAge time.Duration) ([]Show, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.showsAt.IsZero() || maxAge <= 0 || time.Since(c.showsAt) > maxAge {
+		return nil, time.Time{}, false
+	}
+	return copyShows(c.shows), c.showsAt, true
+}
+
+// Ballet returns ballet shows no older than maxAge, fetching them if needed
+func (c *afishaCache) Ballet(ctx context.Context, maxAge time.Duration) ([]BaletShow, time.Time, error) {
+	if shows, at, ok := c.cachedBallet(maxAge); ok {
+		return shows, at, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Пока ждали блокировку, данные мог загрузить другой запрос
+	if maxAge > 0 {
+		if shows, at, ok := c.cachedBallet(maxAge); ok {
+			return shows, at, nil
+		}
+	}
+
+	fresh, err := RunBaletParser()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	c.ballet = fresh
+	c.balletAt = now
+	c.mu.Unlock()
+	// Страницы балетов загружаются независимо; загрузка успешна, если удалась хотя бы одна
+	sessions, loaded := 0, false
+	for _, sh := range fresh {
+		sessions += len(sh.Sessions)
+		loaded = loaded || sh.Title != "Ошибка"
+	}
+	if loaded {
+		markFetchSuccess(providerBallet, sessions)
+	}
+
+	return append([]BaletShow(nil), fresh...), now, nil
+}
+
+func (c *afishaCache) cachedBallet(maxAge time.Duration) ([]BaletShow, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.balletAt.IsZero() || maxAge <= 0 || time.Since(c.balletAt) > maxAge {
+		return nil, time.Time{}, false
+	}
+	return append([]BaletShow(nil), c.ballet...), c.balletAt, true
+}
+
+// Theater returns shows of a configured theater no older than maxAge, fetching them if needed
+func (c *afishaCache) Theater(ctx context.Context, t TheaterConfig, maxAge time.Duration) ([]Show, time.Time, error) {
+	if shows, at, ok := c.cachedTheater(t.ID, maxAge); ok {
+		return shows, at, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Пока ждали блокировку, данные мог загрузить другой запрос
+	if maxAge > 0 {
+		if shows, at, ok := c.cachedTheater(t.ID, maxAge); ok {
+			return shows, at, nil
+		}
+	}
+
+	fresh, err := fetchTheater(ctx, t)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	if c.theaters == nil {
+		c.theaters = make(map[string]theaterSnapshot)
+	}
+	c.theaters[t.ID] = theaterSnapshot{shows: fresh, at: now}
+	c.mu.Unlock()
+	markFetchSuccess(theaterMetricsLabel(t), countSessions(fresh))
+
+	return copyShows(fresh), now, nil
+}
+
+func (c *afishaCache) cachedTheater(id string, maxAge time.Duration) ([]Show, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap, ok := c.theaters[id]
+	if !ok || maxAge <= 0 || time.Since(snap.at) > maxAge {
+		return nil, time.Time{}, false
+	}
+	return copyShows(snap.shows), snap.at, true
+}
+
+// persistChanges loads the change log from path and keeps saving it there after every fetch
+func (c *afishaCache) persistChanges(path string) error {
+	var saved []PerformanceChange
+	if err := readJSONFile(path, &saved); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changesPath = path
+	c.changes = nil
+	c.appendChanges(saved)
+	return nil
+}
+
+// flushChanges writes the change log to its file again, e.g. on shutdown
+func (c *afishaCache) flushChanges() error {
+	c.mu.RLock()
+	changes, path := c.changes, c.changesPath
+	c.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+	return writeJSONFile(path, changes)
+}
+
+// Changes returns recorded changes that happened after since
+func (c *afishaCache) Changes(since time.Time) []PerformanceChange {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []PerformanceChange
+	for _, ch := range c.changes {
+		if ch.At.After(since) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// appendChanges adds changes to the bounded log; c.mu must be held
+func (c *afishaCache) appendChanges(changes []PerformanceChange) {
+	c.changes = append(c.changes, changes...)
+	if extra := len(c.changes) - CHANGE_LOG_LIMIT; extra > 0 {
+		c.changes = append([]PerformanceChange(nil), c.changes[extra:]...)
+	}
+}
+
+// countSessions returns the total number of sessions across shows
+func countSessions(shows []Show) int {
+	n := 0
+	for _, sh := range shows {
+		n += len(sh.Info)
+	}
+	return n
+}
+
+// copyShows copies the slice so callers can sort it without touching the cache
+func copyShows(shows []Show) []Show {
+	return append([]Show(nil), shows...)
+}
+
+// mergeFailedShows keeps the previous data for pages that failed to load this time,
+// otherwise a network hiccup would look like every session disappearing
+func mergeFailedShows(prev, next []Show) []Show {
+	prevByURL := make(map[string]Show, len(prev))
+	for _, sh := range prev {
+		prevByURL[sh.URL] = sh
+	}
+	out := make([]Show, 0, len(next))
+	for _, sh := range next {
+		if sh.Title == "Error" {
+			if old, ok := prevByURL[sh.URL]; ok {
+				out = append(out, old)
+				continue
+			}
+		}
+		out = append(out, sh)
+	}
+	return out
+}
+
+// diffShows compares two snapshots and reports new dates and sale status changes
+func diffShows(prev, next []Show, at time.Time) []PerformanceChange {
+	old := make(map[string]ShowInfo)
+	for _, sh := range prev {
+		for _, inf := range sh.Info {
+			old[performanceKey(inf)] = inf
+		}
+	}
+
+	var changes []PerformanceChange
+	for _, sh := range next {
+		for _, inf := range sh.Info {
+			change := PerformanceChange{
+				At:          at,
+				ShowID:      showID(sh.URL),
+				Title:       sh.Title,
+				Start:       mskTime(inf.Start),
+				Stage:       inf.Stage,
+				StageUID:    inf.StageUID,
+				DateTimeKey: inf.DateTimeKey,
+				NewOnSale:   inf.CanBuy,
+				BuyLink:     inf.BuyLink,
+			}
+			before, existed := old[performanceKey(inf)]
+			switch {
+			case !existed:
+				change.Event = ChangeAdded
+			case !before.CanBuy && inf.CanBuy:
+				change.Event = ChangeOnSale
+				change.OldOnSale = false
+			case before.CanBuy && !inf.CanBuy:
+				change.Event = ChangeSoldOut
+				change.OldOnSale = true
+			default:
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// runCacheRefresher reloads the cache every interval until ctx is done
+func runCacheRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, _, err := cache.Shows(ctx, 0); err != nil {
+			logError(err)
+		}
+		if _, _, err := cache.Ballet(ctx, 0); err != nil {
+			logError(err)
+		}
+		for _, t := range currentConfig().Providers.Theaters {
+			if _, _, err := cache.Theater(ctx, t, 0); err != nil {
+				logError(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package main содержит локальный HTTP API с данными афиши.
+//
+// Этот файл реализует:
+// - RunAPIServer() - режим serve: HTTP-сервер с JSON API и фоновым обновлением кеша
+// - GET /api/shows - спектакли Вахтангова с числом подходящих сеансов
+// - GET /api/shows/{id}/performances - сеансы одного спектакля (id — slug из URL страницы)
+// - GET /api/ballet - балеты
+// - GET /api/changes?since=RFC3339 - изменения между загрузками (новые даты, начало/конец продаж)
+// - GET /api/feed.atom и /api/feed.rss - те же изменения лентой для RSS-читалок (feed.go)
+// - GET /api/openapi.json - описание API в формате OpenAPI 3
+// - GET /metrics, /healthz, /readyz - метрики Prometheus и проверки здоровья (metrics.go)
+//
+// Фильтры /api/shows и /api/shows/{id}/performances: from, to (YYYY-MM-DD), weekdays,
+// time (evening|matinee), stage (UID или название), on_sale (true|false).
+//
+// Взаимодействует с:
+// - afisha_cache.go: все данные берутся из общего кеша, что и у бота
+// - filters.go: параметры запроса разбираются тем же parseFilterFlags(), что и флаги CLI
+// - main.go: запускается командой "showsparser serve"
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"parser/logger"
+)
+
+var apiLog = logger.Get().Named("server")
+
+// API_SHUTDOWN_TIMEOUT — сколько ждать завершения активных HTTP-запросов
+const API_SHUTDOWN_TIMEOUT = 10 * time.Second
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+type apiShow struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	URL          string   `json:"url"`
+	Cast         []string `json:"cast,omitempty"`
+	Performances int      `json:"performances"`
+	OnSale       int      `json:"on_sale"`
+}
+
+type apiPerformance struct {
+	Start       time.Time `json:"start"`
+	Date        string    `json:"date"`
+	Weekday     string    `json:"weekday"`
+	Time        string    `json:"time"`
+	Stage       string    `json:"stage,omitempty"`
+	StageUID    string    `json:"stage_uid"`
+	DateTimeKey string    `json:"datetime_key"`
+	OnSale      bool      `json:"on_sale"`
+	BuyLink     string    `json:"buy_link,omitempty"`
+}
+
+type apiBaletSession struct {
+	Info    string `json:"info"`
+	BuyLink string `json:"buy_link,omitempty"`
+}
+
+type apiBaletShow struct {
+	Title    string            `json:"title"`
+	OnSale   bool              `json:"on_sale"`
+	Sessions []apiBaletSession `json:"sessions"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// RunAPIServer serves the JSON API on addr until ctx is done
+func RunAPIServer(ctx context.Context, addr string) error {
+	if err := cache.persistChanges(storagePath("changes.json")); err != nil {
+		return err
+	}
+	shutdown.Go(ctx, func(ctx context.Context) {
+		runCacheRefresher(ctx, cacheTTL())
+	})
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           withRequestLogging(newAPIHandler()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		apiLog.Infof("API server listening on %s", addr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		err = fmt.Errorf("API server failed: %w", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), API_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		apiLog.Errorf("Error shutting down API server: %v", shutdownErr)
+	}
+	return err
+}
+
+// newAPIHandler builds the router for the JSON API
+func newAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/shows", handleAPIShows)
+	mux.HandleFunc("GET /api/shows/{id}/performances", handleAPIPerformances)
+	mux.HandleFunc("GET /api/ballet", handleAPIBallet)
+	mux.HandleFunc("GET /api/changes", handleAPIChanges)
+	mux.HandleFunc("GET /api/feed.atom", handleFeed("atom", "application/atom+xml"))
+	mux.HandleFunc("GET /api/feed.rss", handleFeed("rss", "application/rss+xml"))
+	mux.HandleFunc("GET /api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	registerOpsHandlers(mux)
+	return mux
+}
+
+// statusRecorder remembers the response status for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLogging tags the request context with a request ID (X-Request-ID
+// or a new random one) and logs every request once it is served
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := logger.WithRequestID(r.Context(), id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		logger.From(ctx).Named("server").Infow("Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logError(err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, apiError{Error: msg})
+}
+
+// filterFromQuery builds a ShowFilter from query parameters
+func filterFromQuery(r *http.Request) (ShowFilter, error) {
+	q := r.URL.Query()
+	ff := &filterFlags{
+		from:      q.Get("from"),
+		to:        q.Get("to"),
+		weekdays:  q.Get("weekdays"),
+		timeOfDay: q.Get("time"),
+		stage:     q.Get("stage"),
+	}
+	onSale, err := onSaleFromQuery(r)
+	if err != nil {
+		return ShowFilter{}, err
+	}
+	ff.onlyOnSale = onSale
+	return parseFilterFlags(ff)
+}
+
+// onSaleFromQuery reads the on_sale parameter as strconv.ParseBool does; missing means false
+func onSaleFromQuery(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("on_sale")
+	if raw == "" {
+		return false, nil
+	}
+	onSale, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid on_sale: %w", err)
+	}
+	return onSale, nil
+}
+
+func handleAPIShows(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	shows, _, err := cache.Shows(r.Context(), cacheTTL())
+	if err != nil {
+		logger.From(r.Context()).Errorf("Error loading afisha: %v", err)
+		writeAPIError(w, http.StatusBadGateway, "failed to load shows")
+		return
+	}
+
+	out := make([]apiShow, 0, len(shows))
+	for _, sh := range filter.ApplyShows(shows) {
+		onSale := 0
+		for _, inf := range sh.Info {
+			if inf.CanBuy {
+				onSale++
+			}
+		}
+		out = append(out, apiShow{
+			ID:           showID(sh.URL),
+			Title:        sh.Title,
+			URL:          sh.URL,
+			Cast:         sh.Cast,
+			Performances: len(sh.Info),
+			OnSale:       onSale,
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func handleAPIPerformances(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	shows, _, err := cache.Shows(r.Context(), cacheTTL())
+	if err != nil {
+		logger.From(r.Context()).Errorf("Error loading afisha: %v", err)
+		writeAPIError(w, http.StatusBadGateway, "failed to load shows")
+		return
+	}
+
+	id := r.PathValue("id")
+	for _, sh := range shows {
+		if showID(sh.URL) != id {
+			continue
+		}
+		out := make([]apiPerformance, 0, len(sh.Info))
+		for _, inf := range sh.Info {
+			if !filter.MatchInfo(inf) {
+				continue
+			}
+			out = append(out, apiPerformance{
+				Start:       mskTime(inf.Start),
+				Date:        inf.Date,
+				Weekday:     inf.Weekday,
+				Time:        inf.Time,
+				Stage:       inf.Stage,
+				StageUID:    inf.StageUID,
+				DateTimeKey: inf.DateTimeKey,
+				OnSale:      inf.CanBuy,
+				BuyLink:     inf.BuyLink,
+			})
+		}
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+	writeAPIError(w, http.StatusNotFound, "show not found")
+}
+
+func handleAPIBallet(w http.ResponseWriter, r *http.Request) {
+	onlyOnSale, err := onSaleFromQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	shows, _, err := cache.Ballet(r.Context(), cacheTTL())
+	if err != nil {
+		logger.From(r.Context()).Errorf("Error loading afisha: %v", err)
+		writeAPIError(w, http.StatusBadGateway, "failed to load ballet")
+		return
+	}
+
+	out := make([]apiBaletShow, 0, len(shows))
+	for _, sh := range shows {
+		if onlyOnSale && !sh.CanBuy {
+			continue
+		}
+		sessions := make([]apiBaletSession, 0, len(sh.Sessions))
+		for _, s := range sh.Sessions {
+			sessions = append(sessions, apiBaletSession{Info: s.Info, BuyLink: s.BuyLink})
+		}
+		out = append(out, apiBaletShow{Title: sh.Title, OnSale: sh.CanBuy, Sessions: sessions})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func handleAPIChanges(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid since: expected RFC3339 timestamp")
+			return
+		}
+		since = t
+	}
+	changes := cache.Changes(since)
+	if changes == nil {
+		changes = []PerformanceChange{}
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withAPICache replaces the shared cache with fresh test data
+func withAPICache(t *testing.T) {
+	t.Helper()
+	now := time.Now()
+	prev := cache
+	cache = &afishaCache{
+		shows: []Show{
+			{
+				Title: "Ревизор",
+				URL:   "https://vakhtangov.ru/shows/revizor/",
+				Info: []ShowInfo{
+					// Суббота, вечер, основная сцена, в продаже
+					{Start: time.Date(2026, time.November, 14, 19, 0, 0, 0, time.UTC), Stage: "Основная сцена", StageUID: "main", CanBuy: true},
+					// Воскресенье, утро, основная сцена, не в продаже
+					{Start: time.Date(2026, time.November, 15, 12, 0, 0, 0, time.UTC), Stage: "Основная сцена", StageUID: "main"},
+				},
+			},
+			{
+				Title: "Чайка",
+				URL:   "https://vakhtangov.ru/shows/chaika/",
+				Info: []ShowInfo{
+					// Среда, вечер, малая сцена, в продаже
+					{Start: time.Date(2026, time.November, 18, 19, 30, 0, 0, time.UTC), Stage: "Малая сцена", StageUID: "small", CanBuy: true},
+				},
+			},
+		},
+		showsAt: now,
+		ballet: []BaletShow{
+			{Title: "Жизель", CanBuy: true, Sessions: []BaletSession{{Info: "5 декабря 18:00", BuyLink: "https://tickets.example/giselle"}}},
+			{Title: "Щелкунчик"},
+		},
+		balletAt: now,
+		changes: []PerformanceChange{
+			{At: time.Date(2026, time.October, 17, 10, 0, 0, 0, time.UTC), Event: ChangeAdded, ShowID: "revizor", Title: "Ревизор"},
+			{At: time.Date(2026, time.October, 18, 10, 0, 0, 0, time.UTC), Event: ChangeOnSale, ShowID: "chaika", Title: "Чайка"},
+		},
+	}
+	t.Cleanup(func() { cache = prev })
+}
+
+// getAPI serves one GET request and decodes the JSON body into out
+func getAPI(t *testing.T, target string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newAPIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return rec.Code
+}
+
+func TestAPIShowsFilters(t *testing.T) {
+	withAPICache(t)
+	tests := []struct {
+		query string
+		want  string // id:сеансов:в продаже
+	}{
+		{"", "revizor:2:1 chaika:1:1"},
+		{"?from=2026-11-15", "revizor:1:0 chaika:1:1"},
+		{"?to=2026-11-15", "revizor:2:1"},
+		{"?from=2026-11-15&to=2026-11-15", "revizor:1:0"},
+		{"?weekdays=sat,wed", "revizor:1:1 chaika:1:1"},
+		{"?weekdays=вс", "revizor:1:0"},
+		{"?time=evening", "revizor:1:1 chaika:1:1"},
+		{"?time=matinee", "revizor:1:0"},
+		{"?stage=small", "chaika:1:1"},
+		{"?stage=основная+сцена", "revizor:2:1"},
+		{"?on_sale=true", "revizor:1:1 chaika:1:1"},
+		{"?on_sale=1", "revizor:1:1 chaika:1:1"},
+		{"?on_sale=false", "revizor:2:1 chaika:1:1"},
+		{"?on_sale=true&weekdays=sun", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var shows []apiShow
+			if code := getAPI(t, "/api/shows"+tt.query, &shows); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			got := make([]string, 0, len(shows))
+			for _, sh := range shows {
+				got = append(got, sh.ID+":"+strconv.Itoa(sh.Performances)+":"+strconv.Itoa(sh.OnSale))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("shows = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIBadQuery(t *testing.T) {
+	withAPICache(t)
+	tests := []struct {
+		target string
+		want   string // начало текста ошибки
+	}{
+		{"/api/shows?from=14.11.2026", "invalid from"},
+		{"/api/shows?to=tomorrow", "invalid to"},
+		{"/api/shows?weekdays=someday", "invalid weekdays"},
+		{"/api/shows?time=night", "invalid time"},
+		{"/api/shows?on_sale=yes", "invalid on_sale"},
+		{"/api/shows/revizor/performances?on_sale=maybe", "invalid on_sale"},
+		{"/api/ballet?on_sale=yes", "invalid on_sale"},
+		{"/api/changes?since=2026-10-18", "invalid since"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var e apiError
+			if code := getAPI(t, tt.target, &e); code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", code)
+			}
+			if !strings.HasPrefix(e.Error, tt.want) {
+				t.Errorf("error = %q, want %q...", e.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIBalletOnSale(t *testing.T) {
+	withAPICache(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "Жизель Щелкунчик"},
+		{"?on_sale=false", "Жизель Щелкунчик"},
+		{"?on_sale=true", "Жизель"},
+		{"?on_sale=1", "Жизель"},
+		{"?on_sale=T", "Жизель"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var shows []apiBaletShow
+			if code := getAPI(t, "/api/ballet"+tt.query, &shows); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			var got []string
+			for _, sh := range shows {
+				got = append(got, sh.Title)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ballet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIChangesSince(t *testing.T) {
+	withAPICache(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "revizor chaika"},
+		{"?since=2026-10-17T10:00:00Z", "chaika"},
+		{"?since=2026-10-17T12:59:59%2B02:00", "chaika"},
+		{"?since=2026-10-17T12:59:59%2B03:00", "revizor chaika"},
+		{"?since=2026-10-18T10:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var changes []PerformanceChange
+			if code := getAPI(t, "/api/changes"+tt.query, &changes); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			if changes == nil {
+				t.Fatal("empty result is not a JSON array")
+			}
+			var got []string
+			for _, ch := range changes {
+				got = append(got, ch.ShowID)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIPerformances(t *testing.T) {
+	withAPICache(t)
+	var perfs []apiPerformance
+	if code := getAPI(t, "/api/shows/revizor/performances?time=matinee", &perfs); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(perfs) != 1 || perfs[0].StageUID != "main" || perfs[0].OnSale {
+		t.Errorf("performances = %+v", perfs)
+	}
+	var e apiError
+	if code := getAPI(t, "/api/shows/hamlet/performances", &e); code != http.StatusNotFound {
+		t.Errorf("unknown show status = %d", code)
+	}
+}
@@ -7,18 +7,16 @@
 // - Standalone режим работы (имеет собственную функцию main)
 //
 // Взаимодействует с:
-// - Не взаимодействует с другими файлами проекта (независимый модуль)
-// - Использует конфигурационный файл ballet_config.json
+// - telegram_renderer.go: RenderBaletShowsMarkdown() размечает текст через TelegramRenderer
+// - Берет URL страниц из providers.ballet.urls единого конфига (config.go)
 package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -29,12 +27,9 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
+// BALET_TIMEOUT — таймаут одной страницы балета по умолчанию (timeouts.ballet_page в конфиге)
 const BALET_TIMEOUT = 10 * time.Second
 
-type BaletConfig struct {
-	URLs []string `json:"urls"`
-}
-
 type BaletShow struct {
 	Title    string
 	CanBuy   bool
@@ -46,22 +41,9 @@ type BaletSession struct {
 	BuyLink string // Ссылка на покупку
 }
 
-func loadBaletConfig(path string) (*BaletConfig, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var cfg BaletConfig
-	if err = json.NewDecoder(f).Decode(&cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
-}
-
 func parseBaletPage(ctx context.Context, url string) BaletShow {
-	log := logger.Get().Named("ballet")
+	ctx = logger.WithProvider(ctx, providerBallet)
+	log := logger.From(ctx).Named("ballet")
 	log.Infof("Парсинг страницы: %s", url)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -73,7 +55,9 @@ func parseBaletPage(ctx context.Context, url string) BaletShow {
 	// Устанавливаем User-Agent для корректной работы с сайтом
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 
+	start := time.Now()
 	resp, err := http.DefaultClient.Do(req)
+	observeFetch(providerBallet, start, resp)
 	if err != nil {
 		log.Errorf("Ошибка выполнения запроса: %v", err)
 		return BaletShow{Title: "Ошибка", CanBuy: false}
@@ -87,6 +71,7 @@ func parseBaletPage(ctx context.Context, url string) BaletShow {
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
+		parseFailures.WithLabelValues(providerBallet).Inc()
 		log.Errorf("Ошибка парсинга HTML: %v", err)
 		return BaletShow{Title: "Ошибка", CanBuy: false}
 	}
@@ -602,34 +587,19 @@ func printBaletResult(show BaletShow) {
 }
 
 func RunBaletParser() ([]BaletShow, error) {
-	// Пробуем загрузить конфиг из разных возможных файлов
-	configFiles := []string{"ballet_config.json"}
-	var cfg *BaletConfig
-	var err error
-
-	for _, configFile := range configFiles {
-		cfg, err = loadBaletConfig(configFile)
-		if err == nil {
-			logger.Get().Named("ballet").Infof("Конфиг загружен из: %s", configFile)
-			break
-		}
+	cfg := currentConfig()
+	urls := cfg.Providers.Ballet.URLs
+	if len(urls) == 0 {
+		return nil, errors.New("в конфиге нет URL-адресов балетов (providers.ballet.urls)")
 	}
 
-	if cfg == nil {
-		return nil, errors.New("не удалось загрузить конфиг. Создайте файл ballet_config.json с полем urls")
-	}
-
-	if len(cfg.URLs) == 0 {
-		return nil, errors.New("в конфиге нет URL-адресов для парсинга")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), BALET_TIMEOUT*time.Duration(len(cfg.URLs)))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.BalletPage.Duration*time.Duration(len(urls)))
 	defer cancel()
 
 	var wg sync.WaitGroup
-	results := make(chan BaletShow, len(cfg.URLs))
+	results := make(chan BaletShow, len(urls))
 
-	for _, url := range cfg.URLs {
+	for _, url := range urls {
 		wg.Add(1)
 		go func(url string) {
 			defer wg.Done()
@@ -653,26 +623,26 @@ func RunBaletParser() ([]BaletShow, error) {
 	return shows, nil
 }
 
-// RenderBaletShowMarkdown formats a single ballet show for Telegram Markdown
-func RenderBaletShowMarkdown(show BaletShow) string {
+// RenderBaletShowMarkdown formats a single ballet show for Telegram using the given renderer
+func RenderBaletShowMarkdown(r TelegramRenderer, show BaletShow) string {
 	var b strings.Builder
 	// Title
-	b.WriteString(fmt.Sprintf("*%s*\n", escapeBaletMarkdown(show.Title)))
+	b.WriteString(r.Bold(strings.TrimSpace(show.Title)) + "\n")
 
 	// Availability status
-	status := "❌ Билеты недоступны"
+	status := tr(r.Lang(), "show.unavailable")
 	if show.CanBuy {
-		status = "✅ Билеты доступны"
+		status = tr(r.Lang(), "show.available")
 	}
-	b.WriteString(fmt.Sprintf("%s\n", status))
+	b.WriteString(r.Escape(status) + "\n")
 
 	// Buy options
 	if len(show.Sessions) > 0 {
-		b.WriteString("\n*Опции покупки:*\n")
+		b.WriteString("\n" + r.Bold(tr(r.Lang(), "show.buy_options")) + "\n")
 		for _, session := range show.Sessions {
-			b.WriteString(fmt.Sprintf("• %s\n", escapeBaletMarkdown(session.Info)))
+			b.WriteString(r.Escape("• "+strings.TrimSpace(session.Info)) + "\n")
 			if session.BuyLink != "" {
-				b.WriteString(fmt.Sprintf("  → [Купить билет](%s)\n", session.BuyLink))
+				b.WriteString(r.Escape("  → ") + r.Link(tr(r.Lang(), "show.buy"), session.BuyLink) + "\n")
 			}
 		}
 	}
@@ -680,46 +650,23 @@ func RenderBaletShowMarkdown(show BaletShow) string {
 	return b.String()
 }
 
-// RenderBaletShowsMarkdown formats multiple ballet shows into a single Telegram message
-func RenderBaletShowsMarkdown(shows []BaletShow) string {
+// RenderBaletShowsMarkdownBlocks formats every ballet show separately
+func RenderBaletShowsMarkdownBlocks(r TelegramRenderer, shows []BaletShow) []string {
 	// Сортируем спектакли по названию для стабильного порядка вывода
 	sort.Slice(shows, func(i, j int) bool {
 		return shows[i].Title > shows[j].Title
 	})
 
-	var b strings.Builder
-	for i, show := range shows {
-		if i > 0 {
-			b.WriteString("\n〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️️\n")
-		}
-		b.WriteString(RenderBaletShowMarkdown(show))
+	blocks := make([]string, 0, len(shows))
+	for _, show := range shows {
+		blocks = append(blocks, RenderBaletShowMarkdown(r, show))
 	}
-	return b.String()
+	return blocks
 }
 
-// escapeBaletMarkdown escapes Telegram MarkdownV2-sensitive characters
-func escapeBaletMarkdown(s string) string {
-	replacer := strings.NewReplacer(
-		"_", "\\_",
-		"*", "\\*",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-		"~", "\\~",
-		"`", "\\`",
-		">", "\\>",
-		"#", "\\#",
-		"+", "\\+",
-		"-", "\\-",
-		"=", "\\=",
-		"|", "\\|",
-		"{", "\\{",
-		"}", "\\}",
-		".", "\\.",
-		"!", "\\!",
-	)
-	return replacer.Replace(strings.TrimSpace(s))
+// RenderBaletShowsMarkdown formats multiple ballet shows into a single Telegram message
+func RenderBaletShowsMarkdown(r TelegramRenderer, shows []BaletShow) string {
+	return strings.Join(RenderBaletShowsMarkdownBlocks(r, shows), showsSeparator)
 }
 
 // func main() {
@@ -0,0 +1,502 @@
+// Package main содержит единый конфиг приложения.
+//
+// Этот файл реализует:
+// - AppConfig - версия, провайдеры (URL страниц и другие театры), таймауты, настройки бота, уведомления и хранилище
+// - loadAppConfig() - чтение JSON с проверкой неизвестных полей и понятными ошибками валидации
+// - applyEnvOverrides() - переопределение полей переменными окружения
+// - watchConfig() - перечитывание конфига по SIGHUP или при изменении файла без перезапуска
+//
+// Путь к файлу задается флагом -config или CONFIG_FILE, по умолчанию config.json.
+// Переменные окружения сильнее файла: ALLOWED_USERS, ADMIN_CHAT_IDS, BOT_MODE,
+// FETCH_TIMEOUT, BALLET_PAGE_TIMEOUT, CACHE_TTL, REFRESH_COOLDOWN, DIGEST_CHANNEL, STORAGE_DIR.
+// Секреты (токен бота, секрет webhook, пароль SMTP, ключи подписи исходящих webhook)
+// в файле не хранятся и берутся только из окружения.
+//
+// При перезагрузке применяются списки URL и театров, таймауты, доступ к боту и администраторы;
+// режим бота (BOT_MODE) и адреса HTTP-серверов читаются только при запуске.
+//
+// Взаимодействует с:
+// - main.go: загружает конфиг при старте и запускает watchConfig()
+// - vakhtangov_formatter.go, vakhtangov_api.go, ballet.go: берут URL провайдеров из currentConfig()
+// - theaters.go: форматы афиш и города для проверки providers.theaters
+// - telegram.go, telegram_middleware.go: доступ, администраторы и ограничение частоты
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"parser/logger"
+)
+
+var configLog = logger.Get().Named("config")
+
+// CONFIG_VERSION — версия формата конфига, которую понимает эта сборка
+const CONFIG_VERSION = 1
+
+// CONFIG_POLL_INTERVAL — как часто проверяется время изменения файла конфига
+const CONFIG_POLL_INTERVAL = 2 * time.Second
+
+// Duration is a time.Duration written as "30s" or "5m" in the config
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\" or \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	d.Duration = v
+	return nil
+}
+
+type AppConfig struct {
+	Version       int                 `json:"version"`
+	Providers     ProvidersConfig     `json:"providers"`
+	Timeouts      TimeoutsConfig      `json:"timeouts"`
+	Bot           BotConfig           `json:"bot"`
+	Notifications NotificationsConfig `json:"notifications"`
+	Storage       StorageConfig       `json:"storage"`
+}
+
+type ProvidersConfig struct {
+	Vakhtangov VakhtangovConfig `json:"vakhtangov"`
+	Ballet     BalletConfig     `json:"ballet"`
+	// Theaters — афиши других театров, подключаемые конфигом (см. theaters.go)
+	Theaters []TheaterConfig `json:"theaters,omitempty"`
+}
+
+type VakhtangovConfig struct {
+	// APIURL — JSON с расписанием и продажами (ticketland_afisha)
+	APIURL string   `json:"api_url"`
+	URLs   []string `json:"urls"`
+	// Stages сопоставляет stage UID из API с названием сцены, например "Историческая сцена"
+	Stages map[string]string `json:"stages,omitempty"`
+	TicketlandSiteConfig
+}
+
+// TicketlandSiteConfig — сайт театра с лентой Ticketland и его ссылка покупки
+type TicketlandSiteConfig struct {
+	BaseURL string `json:"base_url,omitempty"` // по умолчанию схема и хост ленты
+	BuyLink string `json:"buy_link,omitempty"` // шаблон с {stageuid} и {datetime}, по умолчанию TICKETLAND_BUY_LINK
+}
+
+type BalletConfig struct {
+	URLs []string `json:"urls"`
+}
+
+// TheaterConfig — еще один театр: где его афиша и в каком она формате
+type TheaterConfig struct {
+	ID       string `json:"id"`       // a-z, 0-9, "_" и "-": входит в данные кнопок бота
+	Name     string `json:"name"`     // название в меню и заголовке афиши
+	City     string `json:"city"`     // moscow или spb — группа в меню бота
+	Provider string `json:"provider"` // ticketland или jsonld
+	URL      string `json:"url"`      // афиша на сайте или file:// с сохраненной копией
+	// Stages, base_url и buy_link — только для ленты Ticketland
+	Stages map[string]string `json:"stages,omitempty"`
+	TicketlandSiteConfig
+}
+
+type TimeoutsConfig struct {
+	Fetch           Duration `json:"fetch"`            // загрузка афиши Вахтангова в CLI
+	BalletPage      Duration `json:"ballet_page"`      // одна страница балета
+	CacheTTL        Duration `json:"cache_ttl"`        // сколько данные в кеше считаются свежими
+	RefreshCooldown Duration `json:"refresh_cooldown"` // пауза между загрузками афиши одним пользователем
+}
+
+type BotConfig struct {
+	Mode         string   `json:"mode"`          // polling или webhook
+	AllowedUsers []string `json:"allowed_users"` // пустой список — бот доступен всем
+	AdminChatIDs []int64  `json:"admin_chat_ids"`
+}
+
+type NotificationsConfig struct {
+	// DigestTime — время ежедневной сводки по умолчанию, HH:MM по Москве
+	DigestTime string `json:"digest_time"`
+	// Channel — канал для ежедневной сводки: "@username" или числовой ID; пусто — не публиковать
+	Channel string `json:"channel"`
+	// Email — рассылка изменений афиши по почте
+	Email EmailConfig `json:"email"`
+	// Webhooks — адреса, куда POST-запросом отправляются изменения афиши
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+type WebhookConfig struct {
+	// Name — имя webhook в логах и журнале неотправленных; пусто — "notifications.webhooks[N]"
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	// SecretEnv — имя переменной окружения с секретом для подписи HMAC; пусто — без подписи
+	SecretEnv string `json:"secret_env,omitempty"`
+}
+
+type EmailConfig struct {
+	// SMTPHost — SMTP-сервер; пусто — письма не отправляются
+	SMTPHost string `json:"smtp_host"`
+	SMTPPort int    `json:"smtp_port"`
+	// Security — "starttls" или "plain" (без шифрования, например для локального SMTP)
+	Security string `json:"security"`
+	// Username — логин SMTP; пароль берется только из SMTP_PASSWORD
+	Username string `json:"username"`
+	From     string `json:"from"`
+	// To — адреса, которые получают все изменения без фильтров; подписанные чаты задают свой адрес через /email
+	To []string `json:"to"`
+}
+
+type StorageConfig struct {
+	// Dir — каталог для файлов состояния (подписки, расписания)
+	Dir string `json:"dir"`
+}
+
+// defaultAppConfig returns the settings used for fields missing in the file
+func defaultAppConfig() *AppConfig {
+	return &AppConfig{
+		Version: CONFIG_VERSION,
+		Providers: ProvidersConfig{
+			Vakhtangov: VakhtangovConfig{APIURL: "https://vakhtangov.ru/ticketland_afisha/data.json"},
+		},
+		Timeouts: TimeoutsConfig{
+			Fetch:           Duration{TIMEOUT * time.Second},
+			BalletPage:      Duration{BALET_TIMEOUT},
+			CacheTTL:        Duration{CACHE_TTL},
+			RefreshCooldown: Duration{REFRESH_COOLDOWN},
+		},
+		Bot: BotConfig{Mode: "polling"},
+		Notifications: NotificationsConfig{
+			DigestTime: "10:00",
+			Email:      EmailConfig{SMTPPort: 587, Security: "starttls"},
+		},
+		Storage: StorageConfig{Dir: "data"},
+	}
+}
+
+var appConfig atomic.Pointer[AppConfig]
+
+// currentConfig returns the active config; it may change after a reload,
+// so callers should not keep the pointer across long operations
+func currentConfig() *AppConfig {
+	if cfg := appConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return defaultAppConfig()
+}
+
+// configPath returns the config file path from CONFIG_FILE, config.json by default
+func configPath() string {
+	if p := os.Getenv("CONFIG_FILE"); p != "" {
+		return p
+	}
+	return "config.json"
+}
+
+// loadAppConfig reads, overrides from env and validates the config file
+func loadAppConfig(path string) (*AppConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := defaultAppConfig()
+	cfg.Version = 0
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, describeJSONError(data, err))
+	}
+	if err := applyEnvOverrides(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s is invalid:\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+// describeJSONError adds the line and column to syntax and type errors
+func describeJSONError(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := offset - int64(bytes.LastIndexByte(data[:offset], '\n'))
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+// applyEnvOverrides replaces config fields with values from the environment
+func applyEnvOverrides(cfg *AppConfig) error {
+	var errs []error
+	if v, ok := os.LookupEnv("ALLOWED_USERS"); ok {
+		cfg.Bot.AllowedUsers = nil
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				cfg.Bot.AllowedUsers = append(cfg.Bot.AllowedUsers, u)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("ADMIN_CHAT_IDS"); ok {
+		cfg.Bot.AdminChatIDs = nil
+		for _, raw := range strings.Split(v, ",") {
+			if raw = strings.TrimSpace(raw); raw == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("ADMIN_CHAT_IDS: invalid chat id %q", raw))
+				continue
+			}
+			cfg.Bot.AdminChatIDs = append(cfg.Bot.AdminChatIDs, id)
+		}
+	}
+	if v := os.Getenv("BOT_MODE"); v != "" {
+		cfg.Bot.Mode = strings.ToLower(v)
+	}
+	if v := os.Getenv("DIGEST_CHANNEL"); v != "" {
+		cfg.Notifications.Channel = v
+	}
+	if v := os.Getenv("STORAGE_DIR"); v != "" {
+		cfg.Storage.Dir = v
+	}
+	durations := []struct {
+		env string
+		dst *Duration
+	}{
+		{"FETCH_TIMEOUT", &cfg.Timeouts.Fetch},
+		{"BALLET_PAGE_TIMEOUT", &cfg.Timeouts.BalletPage},
+		{"CACHE_TTL", &cfg.Timeouts.CacheTTL},
+		{"REFRESH_COOLDOWN", &cfg.Timeouts.RefreshCooldown},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid duration %q", d.env, v))
+			continue
+		}
+		d.dst.Duration = parsed
+	}
+	return errors.Join(errs...)
+}
+
+// validate reports every problem at once, each prefixed with the field path
+func (c *AppConfig) validate() error {
+	var errs []error
+	add := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("  %s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Version != CONFIG_VERSION {
+		add("version", "expected %d, got %d (see config.json in the repository for the current format)", CONFIG_VERSION, c.Version)
+	}
+
+	checkURL := func(field, raw string) {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(field, "%q is not an http(s) URL", raw)
+		}
+	}
+	checkURL("providers.vakhtangov.api_url", c.Providers.Vakhtangov.APIURL)
+	checkSite := func(field string, site TicketlandSiteConfig) {
+		if site.BaseURL != "" {
+			checkURL(field+".base_url", site.BaseURL)
+		}
+		if site.BuyLink != "" && !strings.Contains(site.BuyLink, "{datetime}") {
+			add(field+".buy_link", "%q must contain {datetime} (and usually {stageuid})", site.BuyLink)
+		}
+	}
+	checkSite("providers.vakhtangov", c.Providers.Vakhtangov.TicketlandSiteConfig)
+	if len(c.Providers.Vakhtangov.URLs) == 0 {
+		add("providers.vakhtangov.urls", "at least one show page is required")
+	}
+	for i, u := range c.Providers.Vakhtangov.URLs {
+		checkURL(fmt.Sprintf("providers.vakhtangov.urls[%d]", i), u)
+	}
+	for i, u := range c.Providers.Ballet.URLs {
+		checkURL(fmt.Sprintf("providers.ballet.urls[%d]", i), u)
+	}
+	theaterIDs := make(map[string]bool, len(c.Providers.Theaters))
+	for i, t := range c.Providers.Theaters {
+		field := fmt.Sprintf("providers.theaters[%d]", i)
+		switch {
+		case !theaterIDPattern.MatchString(t.ID):
+			add(field+".id", "%q must be 1-%d characters of a-z, 0-9, _ and -", t.ID, THEATER_ID_MAX_LEN)
+		case theaterIDs[t.ID]:
+			add(field+".id", "%q is used by another theater", t.ID)
+		}
+		theaterIDs[t.ID] = true
+		if strings.TrimSpace(t.Name) == "" {
+			add(field+".name", "is required")
+		}
+		if !slices.Contains(theaterCities, t.City) {
+			add(field+".city", "%q is not one of %s", t.City, strings.Join(theaterCities, ", "))
+		}
+		if _, ok := theaterProviders[t.Provider]; !ok {
+			add(field+".provider", "%q is not one of %s", t.Provider, strings.Join(theaterProviderNames(), ", "))
+		}
+		if t.Provider == "ticketland" {
+			checkSite(field, t.TicketlandSiteConfig)
+		} else if t.BaseURL != "" || t.BuyLink != "" || len(t.Stages) > 0 {
+			add(field, "stages, base_url and buy_link are only used by the ticketland provider")
+		}
+		// Сохраненная копия афиши (file://) нужна для разработки по фикстурам из testdata/
+		if !strings.HasPrefix(t.URL, "file://") {
+			checkURL(field+".url", t.URL)
+		}
+	}
+
+	timeouts := []struct {
+		field string
+		value Duration
+	}{
+		{"timeouts.fetch", c.Timeouts.Fetch},
+		{"timeouts.ballet_page", c.Timeouts.BalletPage},
+		{"timeouts.cache_ttl", c.Timeouts.CacheTTL},
+		{"timeouts.refresh_cooldown", c.Timeouts.RefreshCooldown},
+	}
+	for _, t := range timeouts {
+		if t.value.Duration <= 0 {
+			add(t.field, "must be positive")
+		}
+	}
+
+	if c.Bot.Mode != "polling" && c.Bot.Mode != "webhook" {
+		add("bot.mode", "must be \"polling\" or \"webhook\", got %q", c.Bot.Mode)
+	}
+	if t, err := time.Parse("15:04", c.Notifications.DigestTime); err != nil {
+		add("notifications.digest_time", "expected HH:MM, got %q", c.Notifications.DigestTime)
+	} else {
+		// "9:00" приводится к "09:00", чтобы время можно было сравнивать как строки
+		c.Notifications.DigestTime = t.Format("15:04")
+	}
+	if ch := c.Notifications.Channel; ch != "" && !strings.HasPrefix(ch, "@") {
+		if _, err := strconv.ParseInt(ch, 10, 64); err != nil {
+			add("notifications.channel", "expected \"@username\" or a numeric chat id, got %q", ch)
+		}
+	}
+	if email := c.Notifications.Email; email.SMTPHost != "" || len(email.To) > 0 {
+		if email.SMTPHost == "" {
+			add("notifications.email.smtp_host", "required when recipients are set")
+		}
+		if email.SMTPPort <= 0 || email.SMTPPort > 65535 {
+			add("notifications.email.smtp_port", "expected 1-65535, got %d", email.SMTPPort)
+		}
+		if email.Security != "starttls" && email.Security != "plain" {
+			add("notifications.email.security", "must be \"starttls\" or \"plain\", got %q", email.Security)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			add("notifications.email.from", "invalid address %q", email.From)
+		}
+		for i, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				add(fmt.Sprintf("notifications.email.to[%d]", i), "invalid address %q", to)
+			}
+		}
+	}
+	for i, wh := range c.Notifications.Webhooks {
+		field := fmt.Sprintf("notifications.webhooks[%d]", i)
+		checkURL(field+".url", wh.URL)
+		if wh.SecretEnv != "" && os.Getenv(wh.SecretEnv) == "" {
+			add(field+".secret_env", "environment variable %s is empty", wh.SecretEnv)
+		}
+	}
+	if c.Storage.Dir == "" {
+		add("storage.dir", "must not be empty")
+	}
+	return errors.Join(errs...)
+}
+
+// isAllowedUser reports whether a Telegram username may use the bot
+func (c *AppConfig) isAllowedUser(username string) bool {
+	if len(c.Bot.AllowedUsers) == 0 {
+		return true
+	}
+	for _, u := range c.Bot.AllowedUsers {
+		if strings.EqualFold(strings.TrimPrefix(u, "@"), username) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchConfig reloads the config on SIGHUP or when the file changes until ctx is done.
+// An invalid file is reported and the previous config stays active.
+func watchConfig(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(CONFIG_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	modTime := fileModTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			configLog.Info("SIGHUP received, reloading config")
+		case <-ticker.C:
+			mt := fileModTime(path)
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+			configLog.Infof("%s changed, reloading config", path)
+		}
+		reloadConfig(path)
+	}
+}
+
+func reloadConfig(path string) {
+	cfg, err := loadAppConfig(path)
+	if err != nil {
+		configLog.Errorf("Config reload failed, keeping the previous config: %v", err)
+		return
+	}
+	appConfig.Store(cfg)
+	configLog.Infow("Config reloaded",
+		"vakhtangov_urls", len(cfg.Providers.Vakhtangov.URLs),
+		"ballet_urls", len(cfg.Providers.Ballet.URLs),
+		"theaters", len(cfg.Providers.Theaters),
+		"allowed_users", len(cfg.Bot.AllowedUsers),
+	)
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,265 @@
+// Package main содержит ленты Atom и RSS 2.0 с изменениями афиши для RSS-читалок.
+//
+// Этот файл реализует:
+// - feedEntries() - записи ленты из журнала изменений: новые даты, начало и окончание продаж
+// - renderAtom() и renderRSS() - XML ленты в форматах Atom 1.0 и RSS 2.0
+// - GET /api/feed.atom и GET /api/feed.rss - ленты в режиме serve
+// - writeFeedFile() - запись ленты в файл командой "showsparser feed <файл>"
+//
+// ID записи строится из stage UID, DateTimeKey и типа изменения, поэтому не меняется
+// между запусками: читалка не покажет одно и то же изменение дважды. Если событие
+// повторилось (билеты снова пропали из продажи), запись обновляется, а не дублируется.
+//
+// Журнал изменений пополняют бот и режим serve (storage.dir/changes.json);
+// команда feed только читает его и сайты не загружает.
+//
+// Взаимодействует с:
+// - afisha_cache.go: записи берутся из журнала cache.Changes()
+// - api_server.go: эндпоинты лент регистрируются рядом с JSON API
+// - main.go: команда "showsparser [-feed-format rss] feed <файл>"
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// FEED_ENTRIES_LIMIT — сколько последних изменений попадает в ленту
+const FEED_ENTRIES_LIMIT = 100
+
+// FEED_TITLE — заголовок ленты
+const FEED_TITLE = "Афиша театра Вахтангова: новые даты и билеты"
+
+// FEED_SITE_URL — ссылка канала RSS
+const FEED_SITE_URL = "https://vakhtangov.ru/"
+
+// FEED_ID_PREFIX — пространство имен ID ленты и записей (tag URI, RFC 4151)
+const FEED_ID_PREFIX = "tag:showsparser,2024:"
+
+// feedEntry — одна запись ленты независимо от формата
+type feedEntry struct {
+	ID      string
+	Title   string
+	Summary string
+	Link    string
+	Updated time.Time
+}
+
+// feedEntryID returns the stable ID of a change: the session plus the event type
+func feedEntryID(ch PerformanceChange) string {
+	return FEED_ID_PREFIX + ch.StageUID + "/" + ch.DateTimeKey + "/" + ch.Event
+}
+
+// feedEntries converts the change log into entries, newest first, one per session and event
+func feedEntries(changes []PerformanceChange) []feedEntry {
+	latest := make(map[string]PerformanceChange)
+	for _, ch := range changes {
+		id := feedEntryID(ch)
+		if prev, ok := latest[id]; !ok || ch.At.After(prev.At) {
+			latest[id] = ch
+		}
+	}
+
+	entries := make([]feedEntry, 0, len(latest))
+	for id, ch := range latest {
+		entries = append(entries, feedEntry{
+			ID:      id,
+			Title:   feedEntryTitle(ch),
+			Summary: feedEntrySummary(ch),
+			Link:    ch.BuyLink,
+			Updated: ch.At,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Updated.Equal(entries[j].Updated) {
+			return entries[i].Updated.After(entries[j].Updated)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	if len(entries) > FEED_ENTRIES_LIMIT {
+		entries = entries[:FEED_ENTRIES_LIMIT]
+	}
+	return entries
+}
+
+// feedEntryTitle renders "Билеты в продаже: Идиот, 12 марта 2025"
+func feedEntryTitle(ch PerformanceChange) string {
+	return fmt.Sprintf("%s: %s, %s", changeEventTitle(ch.Event), ch.Title, stringifyDateWithYear(ch.Start))
+}
+
+// feedEntrySummary describes the session in plain text
+func feedEntrySummary(ch PerformanceChange) string {
+	summary := sessionWhen(ch.Start, ch.Stage)
+	if ch.NewOnSale {
+		summary += ". Билеты в продаже."
+	} else {
+		summary += ". Билетов в продаже нет."
+	}
+	return summary
+}
+
+// feedUpdated is the time of the newest entry, or now for an empty feed
+func feedUpdated(entries []feedEntry) time.Time {
+	if len(entries) == 0 {
+		return time.Now()
+	}
+	return entries[0].Updated
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated string    `xml:"updated"`
+	Link    *atomLink `xml:"link,omitempty"`
+	Summary string    `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Link    *atomLink   `xml:"link,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// renderAtom renders an Atom 1.0 feed; selfURL may be empty
+func renderAtom(entries []feedEntry, selfURL string) ([]byte, error) {
+	feed := atomFeed{
+		ID:      FEED_ID_PREFIX + "feed",
+		Title:   FEED_TITLE,
+		Updated: feedUpdated(entries).Format(time.RFC3339),
+		Author:  "showsparser",
+	}
+	if selfURL != "" {
+		feed.Link = &atomLink{Href: selfURL, Rel: "self", Type: "application/atom+xml"}
+	}
+	for _, e := range entries {
+		entry := atomEntry{ID: e.ID, Title: e.Title, Updated: e.Updated.Format(time.RFC3339), Summary: e.Summary}
+		if e.Link != "" {
+			entry.Link = &atomLink{Href: e.Link, Rel: "alternate"}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalFeed(feed)
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+// renderRSS renders an RSS 2.0 feed
+func renderRSS(entries []feedEntry) ([]byte, error) {
+	feed := rssFeed{
+		Version:       "2.0",
+		Title:         FEED_TITLE,
+		Link:          FEED_SITE_URL,
+		Description:   "Новые даты, начало и окончание продаж билетов",
+		LastBuildDate: feedUpdated(entries).Format(time.RFC1123Z),
+	}
+	for _, e := range entries {
+		feed.Items = append(feed.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			Description: e.Summary,
+			GUID:        rssGUID{Value: e.ID},
+			PubDate:     e.Updated.Format(time.RFC1123Z),
+		})
+	}
+	return marshalFeed(feed)
+}
+
+func marshalFeed(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to render feed: %w", err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// renderFeed renders entries in the given format: "atom" or "rss"; selfURL is used by Atom only
+func renderFeed(format string, entries []feedEntry, selfURL string) ([]byte, error) {
+	switch format {
+	case "atom":
+		return renderAtom(entries, selfURL)
+	case "rss":
+		return renderRSS(entries)
+	}
+	return nil, fmt.Errorf("unknown feed format %q: expected atom or rss", format)
+}
+
+// handleFeed serves the feed in the given format; ?since=RFC3339 limits the entries
+func handleFeed(format, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "invalid since: expected RFC3339 timestamp")
+				return
+			}
+			since = t
+		}
+
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		data, err := renderFeed(format, feedEntries(cache.Changes(since)), scheme+"://"+r.Host+r.URL.Path)
+		if err != nil {
+			logError(err)
+			writeAPIError(w, http.StatusInternalServerError, "failed to render feed")
+			return
+		}
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.Write(data)
+	}
+}
+
+// writeFeedFile renders the stored change log into path.
+// Файл заменяется атомарно, поэтому веб-сервер, раздающий его, не отдаст ленту наполовину.
+func writeFeedFile(path, format string) error {
+	var changes []PerformanceChange
+	if err := readJSONFile(storagePath("changes.json"), &changes); err != nil {
+		return err
+	}
+	data, err := renderFeed(format, feedEntries(changes), "")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedChange builds a change of the session "<stage>/<dt>" made minutes after a fixed moment
+func feedChange(minutes int, event, stage, dt string) PerformanceChange {
+	at := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	return PerformanceChange{
+		At:          at,
+		Event:       event,
+		Title:       "Ревизор & <Чайка>",
+		Start:       time.Date(2026, time.November, 20, 19, 0, 0, 0, time.UTC),
+		Stage:       "Основная сцена",
+		StageUID:    stage,
+		DateTimeKey: dt,
+		NewOnSale:   event == ChangeOnSale,
+		BuyLink:     "https://vakhtangov.ru/tickets/buy/?datetime=" + dt + "&stageuid=" + stage,
+	}
+}
+
+func TestFeedEntryID(t *testing.T) {
+	ch := feedChange(0, ChangeOnSale, "main", "2026-11-20-19-00-00")
+	want := "tag:showsparser,2024:main/2026-11-20-19-00-00/on_sale"
+	if got := feedEntryID(ch); got != want {
+		t.Errorf("feedEntryID = %q, want %q", got, want)
+	}
+
+	// Время изменения, название и ссылка в ID не входят
+	later := ch
+	later.At = ch.At.Add(24 * time.Hour)
+	later.Title = "Чайка"
+	later.BuyLink = ""
+	if feedEntryID(later) != want {
+		t.Errorf("ID changed with the change time or title: %q", feedEntryID(later))
+	}
+	for _, other := range []PerformanceChange{
+		feedChange(0, ChangeSoldOut, "main", "2026-11-20-19-00-00"),
+		feedChange(0, ChangeOnSale, "small", "2026-11-20-19-00-00"),
+		feedChange(0, ChangeOnSale, "main", "2026-11-21-19-00-00"),
+	} {
+		if feedEntryID(other) == want {
+			t.Errorf("%s %s/%s shares the ID", other.Event, other.StageUID, other.DateTimeKey)
+		}
+	}
+}
+
+func TestFeedEntries(t *testing.T) {
+	changes := []PerformanceChange{
+		feedChange(0, ChangeAdded, "main", "a"),
+		feedChange(10, ChangeOnSale, "main", "a"),
+		feedChange(20, ChangeSoldOut, "main", "a"),
+		feedChange(30, ChangeOnSale, "main", "a"), // повтор: та же запись, но новее
+		feedChange(25, ChangeOnSale, "small", "b"),
+		feedChange(5, ChangeOnSale, "main", "a"), // старый повтор в конце журнала не откатывает запись
+		feedChange(25, ChangeAdded, "small", "b"),
+	}
+	entries := feedEntries(changes)
+
+	var got []string
+	for _, e := range entries {
+		got = append(got, strings.TrimPrefix(e.ID, FEED_ID_PREFIX)+"@"+e.Updated.Format("15:04"))
+	}
+	want := []string{
+		"main/a/on_sale@12:30",
+		"small/b/added@12:25", // при равном времени — по ID
+		"small/b/on_sale@12:25",
+		"main/a/sold_out@12:20",
+		"main/a/added@12:00",
+	}
+	compareLines(t, got, want)
+
+	first := entries[0]
+	if first.Link != changes[3].BuyLink || !strings.Contains(first.Summary, "Билеты в продаже") || !strings.HasPrefix(first.Title, changeEventTitle(ChangeOnSale)+": Ревизор & <Чайка>, ") {
+		t.Errorf("first entry = %+v", first)
+	}
+	if len(feedEntries(nil)) != 0 {
+		t.Error("entries from an empty log")
+	}
+}
+
+func TestFeedEntriesLimit(t *testing.T) {
+	var changes []PerformanceChange
+	for i := 0; i < FEED_ENTRIES_LIMIT+20; i++ {
+		changes = append(changes, feedChange(i, ChangeAdded, "main", fmt.Sprintf("s%03d", i)))
+	}
+	entries := feedEntries(changes)
+	if len(entries) != FEED_ENTRIES_LIMIT {
+		t.Fatalf("got %d entries, want %d", len(entries), FEED_ENTRIES_LIMIT)
+	}
+	// Остаются самые новые изменения
+	if newest, oldest := entries[0].ID, entries[len(entries)-1].ID; !strings.HasSuffix(newest, fmt.Sprintf("s%03d/added", FEED_ENTRIES_LIMIT+19)) || !strings.HasSuffix(oldest, "s020/added") {
+		t.Errorf("entries from %s to %s", newest, oldest)
+	}
+}
+
+func TestRenderAtom(t *testing.T) {
+	entries := feedEntries([]PerformanceChange{
+		feedChange(10, ChangeOnSale, "main", "a"),
+		feedChange(0, ChangeAdded, "small", "b"),
+	})
+	entries[1].Link = ""
+	data, err := renderFeed("atom", entries, "http://localhost:8080/api/feed.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("no XML header:\n%s", data)
+	}
+
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Link    atomLink `xml:"link"`
+		Entries []struct {
+			ID      string     `xml:"id"`
+			Title   string     `xml:"title"`
+			Updated string     `xml:"updated"`
+			Links   []atomLink `xml:"link"`
+			Summary string     `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("not well-formed: %v\n%s", err, data)
+	}
+	if feed.ID != FEED_ID_PREFIX+"feed" || feed.Updated != "2026-10-18T12:10:00Z" || feed.Link.Rel != "self" || feed.Link.Href != "http://localhost:8080/api/feed.atom" {
+		t.Errorf("feed = %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("got %d entries", len(feed.Entries))
+	}
+	e := feed.Entries[0]
+	if e.ID != entries[0].ID || e.Title != entries[0].Title || e.Summary != entries[0].Summary || e.Updated != "2026-10-18T12:10:00Z" {
+		t.Errorf("entry = %+v", e)
+	}
+	if len(e.Links) != 1 || e.Links[0].Href != entries[0].Link || e.Links[0].Rel != "alternate" {
+		t.Errorf("entry links = %+v", e.Links)
+	}
+	if len(feed.Entries[1].Links) != 0 {
+		t.Errorf("entry without a buy link has links %+v", feed.Entries[1].Links)
+	}
+
+	// Без selfURL ссылки на ленту нет
+	data, err = renderAtom(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "<link") {
+		t.Errorf("empty feed has a link:\n%s", data)
+	}
+}
+
+func TestRenderRSS(t *testing.T) {
+	entries := feedEntries([]PerformanceChange{
+		feedChange(10, ChangeOnSale, "main", "a"),
+		feedChange(0, ChangeSoldOut, "small", "b"),
+	})
+	data, err := renderFeed("rss", entries, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Title         string `xml:"title"`
+			Link          string `xml:"link"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Description string `xml:"description"`
+				GUID        struct {
+					Value       string `xml:",chardata"`
+					IsPermaLink string `xml:"isPermaLink,attr"`
+				} `xml:"guid"`
+				PubDate string `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("not well-formed: %v\n%s", err, data)
+	}
+	if feed.Version != "2.0" || feed.Channel.Title != FEED_TITLE || feed.Channel.Link != FEED_SITE_URL {
+		t.Errorf("channel = %+v", feed.Channel)
+	}
+	if _, err := time.Parse(time.RFC1123Z, feed.Channel.LastBuildDate); err != nil {
+		t.Errorf("lastBuildDate: %v", err)
+	}
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("got %d items", len(feed.Channel.Items))
+	}
+	for i, item := range feed.Channel.Items {
+		if item.GUID.Value != entries[i].ID || item.GUID.IsPermaLink != "false" || item.Title != entries[i].Title || item.Link != entries[i].Link || item.Description != entries[i].Summary {
+			t.Errorf("item %d = %+v", i, item)
+		}
+		if pub, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil || !pub.Equal(entries[i].Updated) {
+			t.Errorf("item %d pubDate = %q, %v", i, item.PubDate, err)
+		}
+	}
+	if !strings.Contains(feed.Channel.Items[1].Description, "Билетов в продаже нет") {
+		t.Errorf("sold out description = %q", feed.Channel.Items[1].Description)
+	}
+
+	if _, err := renderFeed("json", entries, ""); err == nil {
+		t.Error("unknown format is accepted")
+	}
+}
@@ -0,0 +1,287 @@
+// Package main содержит фильтры афиши по датам, дням недели, времени начала и продаже.
+//
+// Этот файл реализует:
+// - ShowFilter - фильтр нормализованного списка спектаклей ShowEntry
+// - Готовые фильтры "выходные", "неделя", "в продаже" для команд и кнопок бота
+// - parseFilterFlags() - разбор флагов командной строки в ShowFilter
+//
+// Взаимодействует с:
+// - vakhtangov_formatter.go: FetchAllShows() применяет фильтр к данным API перед парсингом страниц
+// - main.go: CLI-режим строит фильтр из флагов -from, -to, -weekdays, -time, -on-sale, -stage
+// - api_server.go: те же параметры принимаются в query-строке HTTP API
+// - telegram.go: команды /weekend, /week, /on_sale и кнопки фильтров под афишей
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EVENING_START_HOUR — спектакли, начинающиеся с этого часа, считаются вечерними
+const EVENING_START_HOUR = 17
+
+const (
+	TimeOfDayAny     = ""
+	TimeOfDayEvening = "evening"
+	TimeOfDayMatinee = "matinee"
+)
+
+// ShowFilter ограничивает список спектаклей; нулевое значение пропускает все
+type ShowFilter struct {
+	From       time.Time // включительно, нулевое значение — без ограничения
+	To         time.Time // не включительно, нулевое значение — без ограничения
+	Weekdays   []time.Weekday
+	TimeOfDay  string // TimeOfDayAny, TimeOfDayEvening или TimeOfDayMatinee
+	OnlyOnSale bool
+	Stage      string // stage UID или название сцены из config.json
+}
+
+// IsEmpty reports whether the filter lets every show through
+func (f ShowFilter) IsEmpty() bool {
+	return f.From.IsZero() && f.To.IsZero() && len(f.Weekdays) == 0 &&
+		f.TimeOfDay == TimeOfDayAny && !f.OnlyOnSale && f.Stage == ""
+}
+
+// Match reports whether a single performance passes the filter.
+// Start из API — московское время без зоны, поэтому границы тоже задаются в "настенном" MSK.
+func (f ShowFilter) Match(e ShowEntry) bool {
+	if f.Stage != "" && f.Stage != e.StageUID {
+		return false
+	}
+	return f.matches(e.Start, e.Detail.HasTickets || e.Detail.SalesOn)
+}
+
+// MatchInfo reports whether a parsed session passes the filter
+func (f ShowFilter) MatchInfo(inf ShowInfo) bool {
+	if f.Stage != "" && f.Stage != inf.StageUID && !strings.EqualFold(f.Stage, inf.Stage) {
+		return false
+	}
+	return f.matches(inf.Start, inf.CanBuy)
+}
+
+func (f ShowFilter) matches(start time.Time, onSale bool) bool {
+	if !f.From.IsZero() && start.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !start.Before(f.To) {
+		return false
+	}
+	if len(f.Weekdays) > 0 {
+		found := false
+		for _, w := range f.Weekdays {
+			if start.Weekday() == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch f.TimeOfDay {
+	case TimeOfDayEvening:
+		if start.Hour() < EVENING_START_HOUR {
+			return false
+		}
+	case TimeOfDayMatinee:
+		if start.Hour() >= EVENING_START_HOUR {
+			return false
+		}
+	}
+	if f.OnlyOnSale && !onSale {
+		return false
+	}
+	return true
+}
+
+// Apply returns the performances that pass the filter
+func (f ShowFilter) Apply(entries []ShowEntry) []ShowEntry {
+	if f.IsEmpty() {
+		return entries
+	}
+	var out []ShowEntry
+	for _, e := range entries {
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ApplyShows filters the sessions of already parsed shows,
+// dropping shows left without sessions when the filter is not empty
+func (f ShowFilter) ApplyShows(shows []Show) []Show {
+	if f.IsEmpty() {
+		return shows
+	}
+	var out []Show
+	for _, sh := range shows {
+		var info []ShowInfo
+		for _, inf := range sh.Info {
+			if f.MatchInfo(inf) {
+				info = append(info, inf)
+			}
+		}
+		if len(info) == 0 {
+			continue
+		}
+		sh.Info = info
+		out = append(out, sh)
+	}
+	return out
+}
+
+// mskWallClock returns the Moscow wall-clock time of t labelled as UTC,
+// matching how ShowEntry.Start is parsed from the API keys
+func mskWallClock(t time.Time) time.Time {
+	msk := t.In(time.FixedZone("MSK", 3*60*60))
+	return time.Date(msk.Year(), msk.Month(), msk.Day(), msk.Hour(), msk.Minute(), msk.Second(), 0, time.UTC)
+}
+
+// mskTime attaches the Moscow zone to a wall-clock time parsed from the API
+func mskTime(wall time.Time) time.Time {
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, time.FixedZone("MSK", 3*60*60))
+}
+
+// startOfDay truncates a wall-clock time to midnight
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekendFilter covers the upcoming (or current) Saturday and Sunday
+func weekendFilter(now time.Time) ShowFilter {
+	today := startOfDay(mskWallClock(now))
+	daysToSaturday := (int(time.Saturday) - int(today.Weekday()) + 7) % 7
+	if today.Weekday() == time.Sunday {
+		// В воскресенье показываем оставшийся день выходных
+		daysToSaturday = -1
+	}
+	saturday := today.AddDate(0, 0, daysToSaturday)
+	from := saturday
+	if from.Before(today) {
+		from = today
+	}
+	return ShowFilter{From: from, To: saturday.AddDate(0, 0, 2)}
+}
+
+// weekFilter covers the next seven days starting today
+func weekFilter(now time.Time) ShowFilter {
+	today := startOfDay(mskWallClock(now))
+	return ShowFilter{From: today, To: today.AddDate(0, 0, 7)}
+}
+
+// onSaleFilter keeps only performances with tickets on sale
+func onSaleFilter(time.Time) ShowFilter {
+	return ShowFilter{OnlyOnSale: true}
+}
+
+// filterPreset — готовый фильтр для команд и кнопок бота; подпись кнопки — "filter.<Name>" в каталоге
+type filterPreset struct {
+	Name  string
+	Build func(now time.Time) ShowFilter
+}
+
+// filterPresets перечислены в порядке кнопок под афишей
+var filterPresets = []filterPreset{
+	{Name: "all", Build: func(time.Time) ShowFilter { return ShowFilter{} }},
+	{Name: "weekend", Build: weekendFilter},
+	{Name: "week", Build: weekFilter},
+	{Name: "on_sale", Build: onSaleFilter},
+}
+
+// findFilterPreset looks a preset up by name
+func findFilterPreset(name string) (filterPreset, bool) {
+	for _, p := range filterPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return filterPreset{}, false
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"mon": time.Monday, "пн": time.Monday,
+	"tue": time.Tuesday, "вт": time.Tuesday,
+	"wed": time.Wednesday, "ср": time.Wednesday,
+	"thu": time.Thursday, "чт": time.Thursday,
+	"fri": time.Friday, "пт": time.Friday,
+	"sat": time.Saturday, "сб": time.Saturday,
+	"sun": time.Sunday, "вс": time.Sunday,
+}
+
+// parseWeekdays parses a comma-separated list like "sat,sun" or "сб,вс"
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var out []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		w, ok := weekdayNames[part]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", part)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+// filterFlags хранит значения флагов командной строки до разбора
+type filterFlags struct {
+	from       string
+	to         string
+	weekdays   string
+	timeOfDay  string
+	onlyOnSale bool
+	stage      string
+}
+
+// registerFilterFlags declares the afisha filter flags on fs
+func registerFilterFlags(fs *flag.FlagSet) *filterFlags {
+	ff := &filterFlags{}
+	fs.StringVar(&ff.from, "from", "", "показывать спектакли начиная с даты YYYY-MM-DD")
+	fs.StringVar(&ff.to, "to", "", "показывать спектакли до даты YYYY-MM-DD включительно")
+	fs.StringVar(&ff.weekdays, "weekdays", "", "дни недели через запятую, например sat,sun или сб,вс")
+	fs.StringVar(&ff.timeOfDay, "time", "", "evening (с 17:00) или matinee (до 17:00)")
+	fs.BoolVar(&ff.onlyOnSale, "on-sale", false, "только спектакли с билетами в продаже")
+	fs.StringVar(&ff.stage, "stage", "", "stage UID или название сцены")
+	return ff
+}
+
+// parseFilterFlags converts parsed flag values (or API query parameters) into a ShowFilter
+func parseFilterFlags(ff *filterFlags) (ShowFilter, error) {
+	var f ShowFilter
+	if ff.from != "" {
+		t, err := time.Parse(time.DateOnly, ff.from)
+		if err != nil {
+			return f, fmt.Errorf("invalid from: %w", err)
+		}
+		f.From = t
+	}
+	if ff.to != "" {
+		t, err := time.Parse(time.DateOnly, ff.to)
+		if err != nil {
+			return f, fmt.Errorf("invalid to: %w", err)
+		}
+		// Дата "до" включительно — берем начало следующего дня
+		f.To = t.AddDate(0, 0, 1)
+	}
+	if ff.weekdays != "" {
+		w, err := parseWeekdays(ff.weekdays)
+		if err != nil {
+			return f, fmt.Errorf("invalid weekdays: %w", err)
+		}
+		f.Weekdays = w
+	}
+	switch ff.timeOfDay {
+	case TimeOfDayAny, TimeOfDayEvening, TimeOfDayMatinee:
+		f.TimeOfDay = ff.timeOfDay
+	default:
+		return f, fmt.Errorf("invalid time %q: expected evening or matinee", ff.timeOfDay)
+	}
+	f.OnlyOnSale = ff.onlyOnSale
+	f.Stage = strings.TrimSpace(ff.stage)
+	return f, nil
+}
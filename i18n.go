@@ -0,0 +1,275 @@
+// Package main содержит каталог строк интерфейса бота на русском и английском.
+//
+// Этот файл реализует:
+//   - normalizeLang() - язык интерфейса по language_code из Telegram или аргументу /lang
+//   - tr() - строка из каталога по ключу для языка, с подстановкой аргументов fmt
+//   - stringifyDateLang(), weekdayName(), sessionWhenLang() - даты на языке интерфейса рядом
+//     с русскими stringifyDate() и weekdayRu(), которые по-прежнему нужны для разбора сайтов
+//   - seatsWordLang() - "место" или "seat" с согласованием числа
+//
+// Ключи сгруппированы по экранам: "afisha.*", "subscribe.*", "alerts.*" и так далее.
+// Русский — язык по умолчанию: если строки нет на нужном языке, берется русская.
+// Названия спектаклей, сцен и состав приходят с сайтов театров и не переводятся.
+//
+// Взаимодействует с:
+// - telegram_renderer.go: TelegramRenderer.Lang() - язык сообщения, которое рендерится
+// - telegram_lang.go: язык чата и пользователя, команда /lang
+// - main.go: stringifyDate(), stringifyDateWithYear() и weekdayRu() для русского языка
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Языки интерфейса
+const (
+	langRu = "ru"
+	langEn = "en"
+)
+
+// supportedLangs — языки в порядке кнопок /lang
+var supportedLangs = []struct{ code, label string }{
+	{langRu, "🇷🇺 Русский"},
+	{langEn, "🇬🇧 English"},
+}
+
+// normalizeLang maps a Telegram language_code ("ru", "en-US") to a supported language:
+// "ru" and an empty code mean Russian, anything else English
+func normalizeLang(code string) string {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+	if base == "" || base == langRu {
+		return langRu
+	}
+	return langEn
+}
+
+// tr returns the catalog string for lang, formatted with args when given
+func tr(lang, key string, args ...any) string {
+	texts, ok := catalog[key]
+	if !ok {
+		return key
+	}
+	text, ok := texts[normalizeLang(lang)]
+	if !ok {
+		text = texts[langRu]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// stringifyDateLang returns "12 марта" or "12 March"
+func stringifyDateLang(lang string, date time.Time) string {
+	if normalizeLang(lang) == langEn {
+		return fmt.Sprintf("%d %s", date.Day(), date.Month())
+	}
+	return stringifyDate(date)
+}
+
+// stringifyDateWithYearLang returns "12 марта 2025" or "12 March 2025"
+func stringifyDateWithYearLang(lang string, date time.Time) string {
+	if normalizeLang(lang) == langEn {
+		return fmt.Sprintf("%d %s %d", date.Day(), date.Month(), date.Year())
+	}
+	return stringifyDateWithYear(date)
+}
+
+// weekdayName returns "Среда" or "Wednesday"
+func weekdayName(lang string, w time.Weekday) string {
+	if normalizeLang(lang) == langEn {
+		return w.String()
+	}
+	return weekdayRu(w)
+}
+
+// sessionWhenLang renders "12 марта 2025, Среда 19:00 — Основная сцена" in the given language
+func sessionWhenLang(lang string, start time.Time, stage string) string {
+	when := stringifyDateWithYearLang(lang, start) + ", " + weekdayName(lang, start.Weekday()) + " " + start.Format("15:04")
+	if stage != "" {
+		when += " — " + stage
+	}
+	return when
+}
+
+// sessionDate renders the date part of a session line: "12 марта 2025, Среда, 19:00".
+// По-русски берутся строки с сайта, как и раньше; по-английски дата собирается из Start.
+func sessionDate(lang string, inf ShowInfo) string {
+	if normalizeLang(lang) == langEn && !inf.Start.IsZero() {
+		return fmt.Sprintf("%s, %s, %s", stringifyDateWithYearLang(lang, inf.Start), weekdayName(lang, inf.Start.Weekday()), inf.Time)
+	}
+	return fmt.Sprintf("%s, %s, %s", inf.Date, inf.Weekday, inf.Time)
+}
+
+// seatsWordLang agrees "место" or "seat" with the number
+func seatsWordLang(lang string, n int) string {
+	if normalizeLang(lang) == langEn {
+		if n == 1 {
+			return "seat"
+		}
+		return "seats"
+	}
+	return seatsWord(n)
+}
+
+// catalog — строки интерфейса: ключ → язык → текст. Аргументы подставляются через fmt.
+var catalog = map[string]map[string]string{
+	// Общие ошибки и отказы
+	"error.save":          {langRu: "Не удалось сохранить настройки. Попробуйте позже.", langEn: "Couldn't save the settings. Please try again later."},
+	"error.parse":         {langRu: "Не понял: %s\nПример: %s", langEn: "Didn't get that: %s\nExample: %s"},
+	"error.unknown_param": {langRu: "неизвестный параметр %s", langEn: "unknown parameter %s"},
+	"access.denied":       {langRu: "⛔️ Доступ запрещен. Бот работает только для авторизованных пользователей.", langEn: "⛔️ Access denied. The bot is available to authorized users only."},
+	"access.denied_short": {langRu: "⛔️ Доступ запрещен", langEn: "⛔️ Access denied"},
+	"rate.limited":        {langRu: "⏳ Слишком часто. Попробуйте через %d с.", langEn: "⏳ Too often. Try again in %d s."},
+
+	// Меню и афиша
+	"menu.start":               {langRu: "Посмотреть афишу в:", langEn: "See the afisha of:"},
+	"menu.choose":              {langRu: "Выберите афишу:", langEn: "Choose an afisha:"},
+	"menu.vakhtangov":          {langRu: "Театр Вахтангова", langEn: "Vakhtangov Theatre"},
+	"menu.ballet":              {langRu: "Балет", langEn: "Ballet"},
+	"menu.city.moscow":         {langRu: "🏛 Москва", langEn: "🏛 Moscow"},
+	"menu.city.spb":            {langRu: "🏛 Санкт-Петербург", langEn: "🏛 Saint Petersburg"},
+	"afisha.title.vakhtangov":  {langRu: "Афиша театра Вахтангова:", langEn: "Vakhtangov Theatre afisha:"},
+	"afisha.title.ballet":      {langRu: "Афиша балета:", langEn: "Ballet afisha:"},
+	"afisha.title.theater":     {langRu: "Афиша — %s:", langEn: "%s afisha:"},
+	"afisha.filter":            {langRu: "Фильтр: %s", langEn: "Filter: %s"},
+	"afisha.updated":           {langRu: "Обновлено: %s", langEn: "Updated: %s"},
+	"afisha.load_error":        {langRu: "Ошибка загрузки афиши. Попробуйте позже.", langEn: "Couldn't load the afisha. Please try again later."},
+	"afisha.ballet_load_error": {langRu: "Ошибка загрузки афиши балета. Попробуйте позже.", langEn: "Couldn't load the ballet afisha. Please try again later."},
+	"afisha.no_matches":        {langRu: "Нет спектаклей, подходящих под фильтр.", langEn: "No performances match the filter."},
+	"button.shows":             {langRu: "📋 Спектакли", langEn: "📋 Performances"},
+	"button.refresh":           {langRu: "🔄 Обновить", langEn: "🔄 Refresh"},
+	"button.back":              {langRu: "⬅️ Назад", langEn: "⬅️ Back"},
+	"filter.all":               {langRu: "Все", langEn: "All"},
+	"filter.weekend":           {langRu: "Выходные", langEn: "Weekend"},
+	"filter.week":              {langRu: "Неделя", langEn: "Week"},
+	"filter.on_sale":           {langRu: "В продаже", langEn: "On sale"},
+	"shows.choose":             {langRu: "Выберите спектакль:", langEn: "Choose a performance:"},
+	"shows.not_found":          {langRu: "Спектакли не найдены.", langEn: "No performances found."},
+	"shows.gone":               {langRu: "Спектакль не найден. Обновите афишу.", langEn: "Performance not found. Refresh the afisha."},
+
+	// Карточка спектакля
+	"show.available":     {langRu: "✅ Билеты доступны", langEn: "✅ Tickets available"},
+	"show.unavailable":   {langRu: "❌ Билеты недоступны", langEn: "❌ No tickets available"},
+	"show.buy_options":   {langRu: "Опции покупки:", langEn: "Buying options:"},
+	"show.buy":           {langRu: "Купить билет", langEn: "Buy a ticket"},
+	"show.cast":          {langRu: "В ролях:", langEn: "Cast:"},
+	"show.sessions":      {langRu: "Сеансы:", langEn: "Sessions:"},
+	"show.no_tickets":    {langRu: "❌ Нет билетов", langEn: "❌ No tickets"},
+	"show.more":          {langRu: "все сеансы на сайте театра", langEn: "all sessions on the theater site"},
+	"tickets.from_price": {langRu: "от %d ₽", langEn: "from %d ₽"},
+	"tickets.seats_left": {langRu: "осталось ~%d %s", langEn: "~%d %s left"},
+	"inline.no_sessions": {langRu: "Нет ближайших сеансов", langEn: "No upcoming sessions"},
+	"inline.sessions":    {langRu: "Сеансов: %d, в продаже: %d · ближайший %s, %s", langEn: "Sessions: %d, on sale: %d · next %s, %s"},
+
+	// Подписка на изменения
+	"subscribe.admin_only":       {langRu: "Подписку в группе может включить только администратор.", langEn: "Only an administrator can subscribe a group."},
+	"subscribe.save_error":       {langRu: "Не удалось сохранить подписку. Попробуйте позже.", langEn: "Couldn't save the subscription. Please try again later."},
+	"subscribe.already":          {langRu: "Чат уже подписан. /unsubscribe — отписаться.", langEn: "This chat is already subscribed. /unsubscribe to stop."},
+	"subscribe.done":             {langRu: "🔔 Чат подписан на новые даты и начало продаж. /maxprice — ограничить цену, /unsubscribe — отписаться.", langEn: "🔔 This chat is subscribed to new dates and sale starts. /maxprice to limit the price, /unsubscribe to stop."},
+	"unsubscribe.admin_only":     {langRu: "Отключить подписку в группе может только администратор.", langEn: "Only an administrator can unsubscribe a group."},
+	"unsubscribe.not_subscribed": {langRu: "Чат не подписан. /subscribe — подписаться.", langEn: "This chat is not subscribed. /subscribe to start."},
+	"unsubscribe.done":           {langRu: "🔕 Подписка отключена.", langEn: "🔕 Unsubscribed."},
+	"maxprice.not_subscribed":    {langRu: "Ограничение цены действует для уведомлений. Сначала подпишитесь: /subscribe", langEn: "The price limit applies to notifications. Subscribe first: /subscribe"},
+	"maxprice.none":              {langRu: "Ограничения цены нет. /maxprice 3000 — присылать начало продаж, только если есть билеты до 3000 ₽.", langEn: "No price limit. /maxprice 3000 — report sale starts only when there are tickets up to 3000 ₽."},
+	"maxprice.current":           {langRu: "Начало продаж приходит, только если есть билеты до %d ₽. /maxprice off — снять ограничение.", langEn: "Sale starts are reported only when there are tickets up to %d ₽. /maxprice off to remove the limit."},
+	"maxprice.admin_only":        {langRu: "Менять ограничение цены в группе может только администратор.", langEn: "Only an administrator can change the group's price limit."},
+	"maxprice.bad_price":         {langRu: "Не понял цену. Пример: /maxprice 3000", langEn: "Didn't get the price. Example: /maxprice 3000"},
+	"maxprice.removed":           {langRu: "Ограничение цены снято.", langEn: "Price limit removed."},
+	"email.disabled":             {langRu: "Отправка писем не настроена.", langEn: "Email delivery is not configured."},
+	"email.not_subscribed":       {langRu: "Письма дублируют уведомления чата. Сначала подпишитесь: /subscribe", langEn: "Emails duplicate the chat's notifications. Subscribe first: /subscribe"},
+	"email.none":                 {langRu: "Уведомления приходят только в чат. /email адрес@example.com — дублировать их письмом.", langEn: "Notifications come to this chat only. /email name@example.com to get them by email too."},
+	"email.current":              {langRu: "Уведомления дублируются письмом на %s с теми же фильтрами. /email off — отключить.", langEn: "Notifications are also emailed to %s with the same filters. /email off to stop."},
+	"email.admin_only":           {langRu: "Менять адрес для писем в группе может только администратор.", langEn: "Only an administrator can change the group's email address."},
+	"email.bad_address":          {langRu: "Не понял адрес. Пример: /email afisha@example.com", langEn: "Didn't get the address. Example: /email afisha@example.com"},
+	"email.removed":              {langRu: "Письма отключены.", langEn: "Emails turned off."},
+	"email.set":                  {langRu: "✉️ Уведомления будут дублироваться письмом на %s.", langEn: "✉️ Notifications will also be emailed to %s."},
+	"maxprice.set":               {langRu: "💰 Начало продаж будет приходить, только если есть билеты до %d ₽.", langEn: "💰 Sale starts will be reported only when there are tickets up to %d ₽."},
+	"changes.title":              {langRu: "Изменения в афише:", langEn: "Afisha changes:"},
+	"changes.added":              {langRu: "🆕 Новая дата", langEn: "🆕 New date"},
+	"changes.on_sale":            {langRu: "🎟 Билеты в продаже", langEn: "🎟 Tickets on sale"},
+	"changes.buy":                {langRu: "Купить билеты", langEn: "Buy tickets"},
+
+	// Сводка
+	"digest.title":          {langRu: "🗓 Сводка афиши", langEn: "🗓 Afisha digest"},
+	"digest.settings_title": {langRu: "Сводка афиши", langEn: "Afisha digest"},
+	"digest.on_sale":        {langRu: "🎟 В продаже на 7 дней:", langEn: "🎟 On sale for the next 7 days:"},
+	"digest.on_sale_empty":  {langRu: "Билетов на ближайшую неделю нет.", langEn: "No tickets for the coming week."},
+	"digest.added":          {langRu: "🆕 Новые даты за неделю:", langEn: "🆕 New dates this week:"},
+	"digest.added_empty":    {langRu: "Новых дат не было.", langEn: "No new dates."},
+	"digest.off":            {langRu: "Сводка выключена.", langEn: "The digest is off."},
+	"digest.daily":          {langRu: "Сводка приходит каждый день в %s (МСК).", langEn: "The digest comes every day at %s (Moscow time)."},
+	"digest.cron":           {langRu: "Сводка приходит по расписанию cron «%s» (МСК).", langEn: "The digest follows the cron schedule “%s” (Moscow time)."},
+	"digest.help":           {langRu: "Каждое утро — билеты в продаже на 7 дней, по понедельникам — новые даты за неделю.\nСвое расписание: /digest <cron>, например /digest 0 9 * * 1-5", langEn: "Every morning: tickets on sale for the next 7 days; on Mondays also the week's new dates.\nCustom schedule: /digest <cron>, e.g. /digest 0 9 * * 1-5"},
+	"digest.button_off":     {langRu: "🔕 Выключить", langEn: "🔕 Turn off"},
+	"digest.admin_only":     {langRu: "Менять сводку в группе может только администратор.", langEn: "Only an administrator can change the group's digest."},
+	"digest.bad_cron":       {langRu: "Не понял расписание: %s\nПример: /digest 0 9 * * 1-5", langEn: "Didn't get the schedule: %s\nExample: /digest 0 9 * * 1-5"},
+
+	// Оповещения
+	"alerts.title":               {langRu: "🔔 Отслеживаемые спектакли:", langEn: "🔔 Watched performances:"},
+	"alerts.price_drop":          {langRu: "📉 Цена снизилась", langEn: "📉 Price dropped"},
+	"alerts.last_seats":          {langRu: "⏳ Последние места", langEn: "⏳ Last seats"},
+	"alerts.returns":             {langRu: "🔁 Появились билеты на проданный сеанс", langEn: "🔁 Tickets are back for a sold-out session"},
+	"alerts.bad_price":           {langRu: "цена должна быть числом: %s", langEn: "the price must be a number: %s"},
+	"alerts.bad_seats":           {langRu: "число мест должно быть больше нуля: %s", langEn: "the number of seats must be above zero: %s"},
+	"alerts.threshold_price":     {langRu: "цена до %d ₽", langEn: "price up to %d ₽"},
+	"alerts.threshold_seats":     {langRu: "меньше %d %s", langEn: "fewer than %d %s"},
+	"alerts.returns_only":        {langRu: "только возвраты", langEn: "returns only"},
+	"alerts.defaults":            {langRu: "Пороги по умолчанию: ", langEn: "Default thresholds: "},
+	"alerts.defaults_none":       {langRu: "не заданы", langEn: "not set"},
+	"alerts.no_watches":          {langRu: "Отслеживаемых спектаклей нет.", langEn: "No watched performances."},
+	"alerts.watches":             {langRu: "Отслеживаемые спектакли:", langEn: "Watched performances:"},
+	"alerts.no_returns":          {langRu: ", без возвратов", langEn: ", no returns"},
+	"alerts.help":                {langRu: "/watch <название> [цена=3000] [места=20] [возвраты=нет] — следить за спектаклем\n/unwatch <название> — перестать\n/alerts цена=3000 места=20 — пороги по умолчанию", langEn: "/watch <title> [price=3000] [seats=20] [returns=off] — watch a performance\n/unwatch <title> — stop watching\n/alerts price=3000 seats=20 — default thresholds"},
+	"alerts.watch_example":       {langRu: "/watch Идиот цена=3000 места=20", langEn: "/watch Идиот price=3000 seats=20"},
+	"alerts.alerts_example":      {langRu: "/alerts цена=3000 места=20", langEn: "/alerts price=3000 seats=20"},
+	"alerts.watch_admin_only":    {langRu: "Менять отслеживание в группе может только администратор.", langEn: "Only an administrator can change what the group watches."},
+	"alerts.defaults_admin_only": {langRu: "Менять пороги в группе может только администратор.", langEn: "Only an administrator can change the group's thresholds."},
+	"alerts.defaults_only":       {langRu: "здесь задаются только цена= и места=", langEn: "only price= and seats= can be set here"},
+	"alerts.not_found":           {langRu: "Спектакль «%s» не найден в афише.", langEn: "“%s” is not in the afisha."},
+	"alerts.ambiguous":           {langRu: "Подходит несколько спектаклей, уточните название:", langEn: "Several performances match, please be more specific:"},
+	"alerts.watching":            {langRu: "👀 Слежу за спектаклем «%s»: %s", langEn: "👀 Watching “%s”: %s"},
+	"alerts.with_returns":        {langRu: ", возвраты на проданные сеансы", langEn: ", returns for sold-out sessions"},
+	"alerts.unwatch_usage":       {langRu: "Укажите спектакль: /unwatch Идиот", langEn: "Name the performance: /unwatch Идиот"},
+	"alerts.not_watched":         {langRu: "Такой спектакль не отслеживается. /watch — список.", langEn: "That performance isn't watched. /watch shows the list."},
+	"alerts.unwatched":           {langRu: "Больше не слежу: %s.", langEn: "No longer watching: %s."},
+
+	// Настройки уведомлений
+	"settings.title":          {langRu: "⚙️ Настройки уведомлений", langEn: "⚙️ Notification settings"},
+	"settings.quiet":          {langRu: "Тихие часы: %s (%s)", langEn: "Quiet hours: %s (%s)"},
+	"settings.quiet_off":      {langRu: "выключены", langEn: "off"},
+	"settings.mode":           {langRu: "Изменения афиши: %s", langEn: "Afisha changes: %s"},
+	"settings.mode_instant":   {langRu: "сразу", langEn: "right away"},
+	"settings.mode_digest":    {langRu: "сводкой раз в день в %02d:00", langEn: "in a daily summary at %02d:00"},
+	"settings.held":           {langRu: "Отложено уведомлений: %d", langEn: "Held notifications: %d"},
+	"settings.help":           {langRu: "В тихие часы уведомления копятся и приходят утром одним сообщением.\nСвои значения: /settings тишина=23-8 пояс=Europe/Berlin режим=сводка", langEn: "During quiet hours notifications are held and come in the morning as one message.\nCustom values: /settings quiet=23-8 tz=Europe/Berlin mode=digest"},
+	"settings.example":        {langRu: "/settings тишина=23-8 пояс=Europe/Moscow режим=сразу", langEn: "/settings quiet=23-8 tz=Europe/Moscow mode=instant"},
+	"settings.held_title":     {langRu: "📬 Отложенные уведомления", langEn: "📬 Held notifications"},
+	"settings.button_quiet":   {langRu: "🌙 Тишина: %s", langEn: "🌙 Quiet: %s"},
+	"settings.button_instant": {langRu: "⚡️ Сразу", langEn: "⚡️ Right away"},
+	"settings.button_digest":  {langRu: "🗓 Сводкой", langEn: "🗓 Daily summary"},
+	"settings.stream.changes": {langRu: "Изменения", langEn: "Changes"},
+	"settings.stream.alerts":  {langRu: "Оповещения", langEn: "Alerts"},
+	"settings.stream.digest":  {langRu: "Сводка", langEn: "Digest"},
+	"settings.event.added":    {langRu: "Новые даты", langEn: "New dates"},
+	"settings.event.on_sale":  {langRu: "Начало продаж", langEn: "Sale starts"},
+	"settings.admin_only":     {langRu: "Менять настройки в группе может только администратор.", langEn: "Only an administrator can change the group's settings."},
+	"settings.bad_quiet":      {langRu: "тихие часы задаются как 23-8: %s", langEn: "quiet hours look like 23-8: %s"},
+	"settings.bad_hour":       {langRu: "час должен быть от 0 до 23: %s", langEn: "the hour must be between 0 and 23: %s"},
+	"settings.bad_field":      {langRu: "параметр задается как ключ=значение: %s", langEn: "parameters look like key=value: %s"},
+	"settings.bad_timezone":   {langRu: "неизвестный часовой пояс %s, пример: Europe/Berlin", langEn: "unknown time zone %s, e.g. Europe/Berlin"},
+	"settings.bad_mode":       {langRu: "режим бывает «сразу» или «сводка»: %s", langEn: "the mode is either instant or digest: %s"},
+	"tz.Europe/Moscow":        {langRu: "МСК", langEn: "Moscow"},
+	"tz.Europe/Kaliningrad":   {langRu: "Калининград", langEn: "Kaliningrad"},
+	"tz.Europe/Samara":        {langRu: "Самара", langEn: "Samara"},
+	"tz.Asia/Yekaterinburg":   {langRu: "Екатеринбург", langEn: "Yekaterinburg"},
+	"tz.Asia/Novosibirsk":     {langRu: "Новосибирск", langEn: "Novosibirsk"},
+	"tz.Asia/Vladivostok":     {langRu: "Владивосток", langEn: "Vladivostok"},
+
+	// Язык
+	"lang.title":      {langRu: "🌐 Язык интерфейса", langEn: "🌐 Interface language"},
+	"lang.hint":       {langRu: "Названия спектаклей и состав остаются как на сайте театра. Сменить язык: /lang en", langEn: "Titles and cast stay as on the theatre's website. Switch language: /lang ru"},
+	"lang.admin_only": {langRu: "Менять язык группы может только администратор.", langEn: "Only an administrator can change the group's language."},
+}
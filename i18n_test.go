@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestNormalizeLang(t *testing.T) {
+	tests := map[string]string{
+		"":      langRu,
+		"ru":    langRu,
+		"RU-ru": langRu,
+		" ru ":  langRu,
+		"en":    langEn,
+		"en-US": langEn,
+		"uk":    langEn,
+		"be":    langEn,
+		"kk":    langEn,
+		"de":    langEn,
+	}
+	for code, want := range tests {
+		if got := normalizeLang(code); got != want {
+			t.Errorf("normalizeLang(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// Имена полей контекста, общие для всех модулей
+const (
+	RequestIDKey = "request_id"
+	ChatIDKey    = "chat_id"
+	ProviderKey  = "provider"
+)
+
+type ctxKey struct{}
+
+// With returns a context whose logger carries the given key-value pairs
+func With(ctx context.Context, keysAndValues ...any) context.Context {
+	return context.WithValue(ctx, ctxKey{}, From(ctx).With(keysAndValues...))
+}
+
+// From returns the logger stored in ctx, or the global one
+func From(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return Get()
+}
+
+// WithRequestID tags every log entry made through ctx with a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return With(ctx, RequestIDKey, id)
+}
+
+// WithChatID tags every log entry made through ctx with a Telegram chat ID
+func WithChatID(ctx context.Context, chatID int64) context.Context {
+	return With(ctx, ChatIDKey, chatID)
+}
+
+// WithProvider tags every log entry made through ctx with a data provider name
+func WithProvider(ctx context.Context, provider string) context.Context {
+	return With(ctx, ProviderKey, provider)
+}
+
+// NewRequestID returns a random 16-character hex ID
+func NewRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -1,53 +1,103 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var sugar *zap.SugaredLogger
+// Config describes where and how logs are written
+type Config struct {
+	Level  string // debug, info, warn, error
+	Format string // console (цветной, для терминала) или json (для сбора логов)
+
+	// File — путь к файлу логов; пустой путь отключает запись в файл.
+	// Файл ротируется по размеру, stdout продолжает получать логи.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+
+	// Sampling ограничивает поток одинаковых сообщений: в секунду пишутся
+	// первые 100 записей с одним текстом, дальше — каждая сотая
+	Sampling bool
+}
+
+// ConfigFromEnv reads LOG_LEVEL, LOG_FORMAT, LOG_FILE, LOG_FILE_MAX_SIZE_MB,
+// LOG_FILE_MAX_BACKUPS, LOG_FILE_MAX_AGE_DAYS and LOG_SAMPLING
+func ConfigFromEnv() Config {
+	return Config{
+		Level:      envOr("LOG_LEVEL", "info"),
+		Format:     envOr("LOG_FORMAT", "console"),
+		File:       os.Getenv("LOG_FILE"),
+		MaxSizeMB:  envInt("LOG_FILE_MAX_SIZE_MB", 100),
+		MaxBackups: envInt("LOG_FILE_MAX_BACKUPS", 5),
+		MaxAgeDays: envInt("LOG_FILE_MAX_AGE_DAYS", 14),
+		Sampling:   envBool("LOG_SAMPLING"),
+	}
+}
+
+var (
+	sugar *zap.SugaredLogger
+	level = zap.NewAtomicLevel()
+	// current — ядро, собранное последним вызовом Init; логгеры, полученные
+	// через Get() до Init (например, в глобальных переменных), пишут в него же
+	current atomic.Pointer[zapcore.Core]
+)
 
 // Init initializes the global logger
-func Init(level string) error {
-	logLevel := zap.InfoLevel
-	switch strings.ToLower(level) {
-	case "debug":
-		logLevel = zap.DebugLevel
-	case "info":
-		logLevel = zap.InfoLevel
-	case "warn":
-		logLevel = zap.WarnLevel
-	case "error":
-		logLevel = zap.ErrorLevel
+func Init(cfg Config) error {
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"} {
+		AddSecretURL(os.Getenv(key))
 	}
+	level.SetLevel(parseLevel(cfg.Level))
 
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // Colored levels
 	encoderConfig.TimeKey = "timestamp"
 	encoderConfig.LevelKey = "level"
 	encoderConfig.MessageKey = "message"
 	encoderConfig.CallerKey = "caller"
 	encoderConfig.StacktraceKey = "stacktrace"
 
-	// Use ConsoleEncoder for "more presentable" human-readable logs,
-	// or JSONEncoder for structured logs.
-	// The user asked for "presentable", so console encoder with colors is usually better for reading in terminal.
-	encoder := zapcore.NewConsoleEncoder(encoderConfig)
-
-	core := zapcore.NewCore(
-		encoder,
-		zapcore.AddSync(os.Stdout),
-		logLevel,
-	)
+	var encoder zapcore.Encoder
+	if strings.ToLower(cfg.Format) == "json" {
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		// Console encoder with colored levels is easier to read in a terminal
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
 
-	// Add caller skip to correctly identify the caller when wrapping (though we are returning the logger)
-	logger := zap.New(core, zap.AddCaller())
+	// Все выходы проходят через redactingWriter: секреты из AddSecret() не попадают ни в stdout, ни в файл
+	cores := []zapcore.Core{zapcore.NewCore(encoder, redactingWriter{zapcore.AddSync(os.Stdout)}, level)}
+	if cfg.File != "" {
+		// В файл всегда пишем JSON: цветные коды уровней там только мешают
+		fileConfig := encoderConfig
+		fileConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		cores = append(cores, zapcore.NewCore(
+			zapcore.NewJSONEncoder(fileConfig),
+			redactingWriter{zapcore.AddSync(newRotatingFile(cfg))},
+			level,
+		))
+	}
+	core := zapcore.NewTee(cores...)
+	if cfg.Sampling {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	}
+	current.Store(&core)
 
-	sugar = logger.Sugar()
+	if sugar == nil {
+		sugar = zap.New(&switchCore{}, zap.AddCaller()).Sugar()
+	}
 	return nil
 }
 
@@ -55,10 +105,91 @@ func Init(level string) error {
 func Get() *zap.SugaredLogger {
 	if sugar == nil {
 		// Fallback if Init wasn't called
-		Init("info")
+		Init(Config{Level: "info"})
 	}
 	return sugar
 }
 
+// Sync flushes buffered log entries; call it before the process exits
+func Sync() error {
+	if sugar == nil {
+		return nil
+	}
+	return sugar.Sync()
+}
 
+func parseLevel(l string) zapcore.Level {
+	switch strings.ToLower(l) {
+	case "debug":
+		return zap.DebugLevel
+	case "warn":
+		return zap.WarnLevel
+	case "error":
+		return zap.ErrorLevel
+	}
+	return zap.InfoLevel
+}
 
+func newRotatingFile(cfg Config) io.Writer {
+	return &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+	}
+}
+
+// switchCore forwards entries to the core built by the latest Init
+type switchCore struct {
+	fields []zapcore.Field
+}
+
+func (c *switchCore) core() zapcore.Core {
+	core := *current.Load()
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	return core
+}
+
+func (c *switchCore) Enabled(l zapcore.Level) bool {
+	return level.Enabled(l)
+}
+
+func (c *switchCore) With(fields []zapcore.Field) zapcore.Core {
+	return &switchCore{fields: append(append([]zapcore.Field(nil), c.fields...), fields...)}
+}
+
+func (c *switchCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return c.core().Check(ent, ce)
+}
+
+func (c *switchCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.core().Write(ent, fields)
+}
+
+func (c *switchCore) Sync() error {
+	return (*current.Load()).Sync()
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envBool(key string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(key))
+	return b
+}
@@ -1,28 +1,36 @@
 // Package main содержит основной парсер спектаклей театра Вахтангова.
 //
 // Этот файл реализует:
-// - Загрузку конфигурации из config.json
+// - Загрузку конфигурации из config.json (формат и проверки — config.go)
 // - Парсинг HTML-страниц спектаклей с извлечением дат, времени и информации о билетах
 // - Форматирование вывода результатов в консоль
-// - Функцию main() которая может работать как бот или как обычный парсер
+// - Функцию main() которая может работать как бот, HTTP API (serve), запись ленты (feed), вывод других театров (theaters) или как обычный парсер
+// - Корректное завершение по SIGINT/SIGTERM (см. shutdown.go)
+// - Флаги командной строки для фильтрации афиши (см. filters.go)
 //
 // Взаимодействует с:
 // - vakhtangov_api.go: использует GetAvailableShows() для получения списка доступных спектаклей из API
 // - telegram.go: вызывает RunTelegramBot() при запуске в режиме бота (через переменную окружения RUN_BOT)
+// - api_server.go: вызывает RunAPIServer() при запуске с аргументом serve
+// - feed.go: вызывает writeFeedFile() при запуске с аргументом feed
+// - notifier_email.go: вызывает sendTestEmail() при запуске с аргументом email-test
+// - theaters.go: вызывает printTheaters() при запуске с аргументом theaters
 package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -30,77 +38,77 @@ import (
 	"parser/logger"
 )
 
+// TIMEOUT — таймаут загрузки афиши в CLI в секундах по умолчанию (timeouts.fetch в конфиге)
 const TIMEOUT = 5
 
-type Config struct {
-	URLs []string `json:"urls"`
-}
-
 type ShowInfo struct {
 	Date    string
 	Weekday string
 	Time    string
+	Stage   string
 	CanBuy  bool
 	BuyLink string
+	// Нормализованные данные сеанса из API
+	Start       time.Time // московское время без зоны, как в ShowEntry
+	StageUID    string
+	DateTimeKey string
+	// Цены и свободные места со страницы покупки; nil — не загружались
+	Tickets *TicketInfo
 }
 type Show struct {
 	Title string
+	URL   string
+	Cast  []string
 	Info  []ShowInfo
 }
 
-func loadConfig(path string) (*Config, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			logError(err)
-		}
-	}(f)
-	var cfg Config
-	if err = json.NewDecoder(f).Decode(&cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
-}
-
 func logError(err error) {
 	logger.Get().Errorf("Error occurred: %v", err)
 }
 
-func parsePages(ctx context.Context, url string, availableShows []ShowEntry) Show {
-	logger.Get().Named("parser").Infof("Parsing %s", url)
+func parsePages(ctx context.Context, url string, availableShows []ShowEntry, stages map[string]string) Show {
+	ctx = logger.WithProvider(ctx, providerVakhtangovPage)
+	log := logger.From(ctx).Named("parser")
+	log.Infof("Parsing %s", url)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		logError(err)
+		log.Errorf("Error loading %s: %v", url, err)
 		return Show{
-			Title: "Error"}
+			Title: "Error",
+			URL:   url}
 	}
+	start := time.Now()
 	resp, err := http.DefaultClient.Do(req)
+	observeFetch(providerVakhtangovPage, start, resp)
 	if err != nil {
-		logError(err)
+		log.Errorf("Error loading %s: %v", url, err)
 		return Show{
-			Title: "Error"}
+			Title: "Error",
+			URL:   url}
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			logError(err)
+			log.Errorf("Error closing response body: %v", err)
 		}
 	}(resp.Body)
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		logError(err)
+		parseFailures.WithLabelValues(providerVakhtangovPage).Inc()
+		log.Errorf("Error parsing %s: %v", url, err)
 		return Show{
-			Title: "Error"}
+			Title: "Error",
+			URL:   url}
 	}
 
 	var showsInfo []ShowInfo
 
 	title := strings.TrimSpace(doc.Find("header.cover-header h1").Text())
+	if title == "" {
+		parseFailures.WithLabelValues(providerVakhtangovPage).Inc()
+	}
+	cast := parseCast(doc)
 
 	// Проходим по каждому <li> внутри .show-afisha
 	// doc.Find("ul.show-afisha > li").Each(func(i int, s *goquery.Selection) {
@@ -141,40 +149,106 @@ func parsePages(ctx context.Context, url string, availableShows []ShowEntry) Sho
 	// 	})
 	// })
 	for _, show := range availableShows {
-		if show.Detail.Title == title || strings.ReplaceAll(show.Detail.Title, "е", "ё") == title {
+		if titlesMatch(show.Detail.Title, title) {
 			canBuy := show.Detail.HasTickets || show.Detail.SalesOn
 			buyLink := ""
 			if canBuy {
-				buyLink = buildVakhtangovBuyLink(show.StageUID, show.DateTimeKey)
+				buyLink = vakhtangovFeed().BuyLink(show.StageUID, show.DateTimeKey)
 			}
 			showsInfo = append(showsInfo, ShowInfo{
 				Date:    stringifyDateWithYear(show.Start),
 				Weekday: weekdayRu(show.Start.Weekday()),
 				Time:    show.Start.Format("15:04"),
+				Stage:   stages[show.StageUID],
 				CanBuy:  canBuy,
 				BuyLink: buyLink,
+
+				Start:       show.Start,
+				StageUID:    show.StageUID,
+				DateTimeKey: show.DateTimeKey,
 			})
 		}
 	}
+	if len(showsInfo) > 0 {
+		titleMatches.WithLabelValues(providerVakhtangovPage, "matched").Inc()
+	} else {
+		titleMatches.WithLabelValues(providerVakhtangovPage, "unmatched").Inc()
+	}
 	// Выводим результат
 	return Show{
 		Title: title,
+		URL:   url,
+		Cast:  cast,
 		Info:  showsInfo,
 	}
 }
 
-func buildVakhtangovBuyLink(stageUID, datetimeKey string) string {
-	stage := strings.TrimSpace(stageUID)
-	datetime := strings.TrimSpace(datetimeKey)
-	if stage == "" || datetime == "" {
-		return ""
-	}
+// normalizeTitle lowercases a title and replaces "ё" with "е":
+// в API театра и на страницах спектаклей одно и то же название пишется по-разному
+func normalizeTitle(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.ReplaceAll(s, "ё", "е")
+}
+
+// titlesMatch compares show titles ignoring case and the ё/е spelling
+func titlesMatch(a, b string) bool {
+	return normalizeTitle(a) == normalizeTitle(b)
+}
+
+// parseCast collects actor names from the cast section of a show page
+func parseCast(doc *goquery.Document) []string {
+	var cast []string
+	seen := make(map[string]bool)
+	doc.Find(".show-cast .name, .cast-list .name, .show-persons .person-name").Each(func(i int, s *goquery.Selection) {
+		name := strings.Join(strings.Fields(s.Text()), " ")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			cast = append(cast, name)
+		}
+	})
+	return cast
+}
+
+// formatShowConsole draws a show and its sessions in a frame for the console
+func formatShowConsole(show Show) string {
+	// Ширина рамки (не включая символы границ)
+	frameWidth := 50
+
+	// Верхняя рамка
+	topBorder := fmt.Sprintf("┌%s┐\n", strings.Repeat("─", frameWidth))
 
-	values := url.Values{}
-	values.Set("stageuid", stage)
-	values.Set("datetime", datetime)
+	// Строка с названием
+	titleLine := fmt.Sprintf("│ Спектакль: %-"+strconv.Itoa(frameWidth-12)+"s│\n", show.Title)
 
-	return "https://vakhtangov.ru/tickets/buy/?" + values.Encode()
+	// Нижняя рамка
+	bottomBorder := fmt.Sprintf("└%s┘\n", strings.Repeat("─", frameWidth))
+
+	result := topBorder + titleLine + bottomBorder
+
+	// Форматирование для сеансов
+	sessionFormat :=
+		"Дата:        %s\n" +
+			"День недели: %s\n" +
+			"Время:       %s\n" +
+			"Билеты в продаже: %s\n" +
+			strings.Repeat("─", frameWidth+2) + "\n" // +2 учитывает граничные символы
+
+	for _, inf := range show.Info {
+		status := "нет"
+		if inf.CanBuy {
+			status = "да"
+		}
+		result += fmt.Sprintf(sessionFormat,
+			inf.Date,
+			inf.Weekday,
+			inf.Time,
+			status,
+		)
+		if inf.CanBuy && inf.BuyLink != "" {
+			result += fmt.Sprintf("Ссылка для покупки: %s\n", inf.BuyLink)
+		}
+	}
+	return result
 }
 
 func stringifyDate(date time.Time) string {
@@ -214,6 +288,21 @@ func stringifyDateWithYear(date time.Time) string {
 	return fmt.Sprintf("%d %s %d", date.Day(), d[date.Month()], date.Year())
 }
 
+// sessionWhen renders "12 марта 2025, Среда 19:00 — Основная сцена"
+func sessionWhen(start time.Time, stage string) string {
+	return sessionWhenLang(langRu, start, stage)
+}
+
+// showID returns the show slug from its page URL, e.g. "dead_souls" for .../show/dead_souls/
+func showID(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	return parts[len(parts)-1]
+}
+
 // weekdayRu converts time.Weekday to Russian name used on the site
 func weekdayRu(w time.Weekday) string {
 	switch w {
@@ -237,90 +326,156 @@ func weekdayRu(w time.Weekday) string {
 }
 
 func main() {
-	if err := logger.Init("info"); err != nil {
+	filterOpts := registerFilterFlags(flag.CommandLine)
+	listen := flag.String("listen", ":8090", "адрес HTTP API в режиме serve")
+	logLevel := flag.String("log-level", "", "уровень логов: debug, info, warn, error (по умолчанию LOG_LEVEL или info)")
+	logFormat := flag.String("log-format", "", "формат логов: console или json (по умолчанию LOG_FORMAT или console)")
+	logFile := flag.String("log-file", "", "файл логов с ротацией (по умолчанию LOG_FILE)")
+	configFile := flag.String("config", "", "файл конфигурации (по умолчанию CONFIG_FILE или config.json)")
+	feedFormat := flag.String("feed-format", "atom", "формат ленты для команды feed: atom или rss")
+	flag.Parse()
+
+	// Загружаем переменные окружения из .env файла до логгера, чтобы учесть LOG_* из него.
+	// Игнорируем ошибку, если файл не найден (переменные могут быть установлены другим способом)
+	envErr := godotenv.Load()
+
+	logConfig := logger.ConfigFromEnv()
+	if *logLevel != "" {
+		logConfig.Level = *logLevel
+	}
+	if *logFormat != "" {
+		logConfig.Format = *logFormat
+	}
+	if *logFile != "" {
+		logConfig.File = *logFile
+	}
+	if err := logger.Init(logConfig); err != nil {
 		panic(err)
 	}
 	log := logger.Get().Named("main")
+	if envErr != nil {
+		log.Warnf("Warning: .env file not found or error loading: %v", envErr)
+	}
 
-	// Загружаем переменные окружения из .env файла
-	// Игнорируем ошибку, если файл не найден (переменные могут быть установлены другим способом)
-	if err := godotenv.Load(); err != nil {
-		log.Warnf("Warning: .env file not found or error loading: %v", err)
+	if *configFile == "" {
+		*configFile = configPath()
 	}
+	cfg, err := loadAppConfig(*configFile)
+	if err != nil {
+		log.Errorf("Cannot start: %v", err)
+		_ = logger.Sync()
+		os.Exit(2)
+	}
+	appConfig.Store(cfg)
 
-	// Если запущено как бот
-	if os.Getenv("RUN_BOT") == "1" && os.Getenv("TELEGRAM_BOT_TOKEN") != "" {
-		log.Info("Running as bot")
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		if err := RunTelegramBot(ctx); err != nil {
+	filter, err := parseFilterFlags(filterOpts)
+	if err != nil {
+		logError(err)
+		os.Exit(2)
+	}
+
+	// Корневой контекст отменяется по SIGINT/SIGTERM (в том числе при docker stop)
+	rootCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Режим HTTP API: showsparser [-listen :8090] serve
+	if flag.Arg(0) == "serve" {
+		log.Info("Running as API server")
+		shutdown.Go(rootCtx, func(ctx context.Context) {
+			watchConfig(ctx, *configFile)
+		})
+		if err := RunAPIServer(rootCtx, *listen); err != nil {
+			logError(err)
+		}
+		if err := shutdown.Drain(SHUTDOWN_TIMEOUT); err != nil {
 			logError(err)
 		}
+		_ = logger.Sync()
 		return
 	}
 
-	cfg, err := loadConfig("config.json")
-	if err != nil {
-		logError(errors.Join(errors.New("failed to load config:\t"), err))
+	// Лента изменений в файл: showsparser [-feed-format rss] feed afisha.atom
+	if flag.Arg(0) == "feed" {
+		path := flag.Arg(1)
+		if path == "" {
+			log.Error("Usage: showsparser [-feed-format atom|rss] feed <file>")
+			_ = logger.Sync()
+			os.Exit(2)
+		}
+		if err := writeFeedFile(path, *feedFormat); err != nil {
+			logError(err)
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+		_ = logger.Sync()
+		return
+	}
+
+	// Тестовое письмо на адреса из notifications.email.to: showsparser email-test
+	if flag.Arg(0) == "email-test" {
+		if err := sendTestEmail(rootCtx); err != nil {
+			logError(err)
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+		log.Info("Test email sent")
+		_ = logger.Sync()
 		return
 	}
 
-	availableShows, err := GetAvailableShows()
+	// Афиша театров из providers.theaters в консоль: showsparser theaters [id]
+	if flag.Arg(0) == "theaters" {
+		if err := printTheaters(rootCtx, flag.Arg(1)); err != nil {
+			logError(err)
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+		_ = logger.Sync()
+		return
+	}
+
+	// Если запущено как бот
+	if os.Getenv("RUN_BOT") == "1" && os.Getenv("TELEGRAM_BOT_TOKEN") != "" {
+		log.Info("Running as bot")
+		shutdown.Go(rootCtx, func(ctx context.Context) {
+			watchConfig(ctx, *configFile)
+		})
+		if err := RunTelegramBot(rootCtx); err != nil {
+			logError(err)
+		}
+		log.Info("Bot stopped, draining in-flight work")
+		if err := shutdown.Drain(SHUTDOWN_TIMEOUT); err != nil {
+			logError(err)
+		}
+		log.Info("Shutdown complete")
+		// Ошибку синхронизации stdout игнорируем: на части систем она не поддерживается
+		_ = logger.Sync()
+		return
+	}
+
+	vakhtangov := cfg.Providers.Vakhtangov
+	availableShows, err := GetAvailableShows(rootCtx)
 	if err != nil {
 		logError(errors.Join(errors.New("failed to get available shows:\t"), err))
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT*time.Second)
+	ctx, cancel := context.WithTimeout(rootCtx, cfg.Timeouts.Fetch.Duration)
 	defer cancel()
 
 	wg := &sync.WaitGroup{}
-	wg.Add(len(cfg.URLs))
+	wg.Add(len(vakhtangov.URLs))
 
 	resultChan := make(chan string)
 
-	for _, url := range cfg.URLs {
+	for _, url := range vakhtangov.URLs {
 		go func(url string) {
 			defer wg.Done()
-			show := parsePages(ctx, url, availableShows)
-			// Ширина рамки (не включая символы границ)
-			frameWidth := 50
-
-			// Верхняя рамка
-			topBorder := fmt.Sprintf("┌%s┐\n", strings.Repeat("─", frameWidth))
-
-			// Строка с названием
-			titleLine := fmt.Sprintf("│ Спектакль: %-"+strconv.Itoa(frameWidth-12)+"s│\n", show.Title)
-
-			// Нижняя рамка
-			bottomBorder := fmt.Sprintf("└%s┘\n", strings.Repeat("─", frameWidth))
-
-			result := topBorder + titleLine + bottomBorder
-
-			// Форматирование для сеансов
-			sessionFormat :=
-				"Дата:        %s\n" +
-					"День недели: %s\n" +
-					"Время:       %s\n" +
-					"Билеты в продаже: %s\n" +
-					strings.Repeat("─", frameWidth+2) + "\n" // +2 учитывает граничные символы
-
-			for _, inf := range show.Info {
-				status := "нет"
-				if inf.CanBuy {
-					status = "да"
-				}
-				result += fmt.Sprintf(sessionFormat,
-					inf.Date,
-					inf.Weekday,
-					inf.Time,
-					status,
-				)
-				if inf.CanBuy && inf.BuyLink != "" {
-					result += fmt.Sprintf("Ссылка для покупки: %s\n", inf.BuyLink)
-				}
+			// С фильтром спектакли без подходящих сеансов не выводим
+			filtered := filter.ApplyShows([]Show{parsePages(ctx, url, availableShows, vakhtangov.Stages)})
+			if len(filtered) == 0 {
+				return
 			}
-			resultChan <- result
-
+			resultChan <- formatShowConsole(filtered[0])
 		}(url)
 	}
 
@@ -331,7 +486,7 @@ func main() {
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Get().Errorf("%v SECOND DEADLINE EXCEEDED", TIMEOUT)
+			logger.Get().Errorf("%v DEADLINE EXCEEDED", cfg.Timeouts.Fetch.Duration)
 			return
 		case result, ok := <-resultChan:
 			if !ok {
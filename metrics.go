@@ -0,0 +1,267 @@
+// Package main содержит метрики Prometheus и проверки здоровья процесса.
+//
+// Этот файл реализует:
+// - Метрики загрузки по провайдерам: длительность, HTTP-статусы, ошибки парсинга, совпадения названий и число найденных сеансов
+// - Счетчики обновлений бота по командам и доставок уведомлений, размер очереди исходящих сообщений
+// - registerOpsHandlers() - /metrics, /healthz и /readyz (готовность по возрасту последней успешной загрузки каждого провайдера)
+// - runOpsServer() - отдельный HTTP-сервер для этих эндпоинтов в режиме бота (METRICS_ADDR)
+//
+// Взаимодействует с:
+// - main.go, vakhtangov_api.go, vakhtangov_tickets.go, ballet.go: учитывают загрузки страниц и API
+// - afisha_cache.go: отмечает успешные загрузки для /readyz
+// - telegram_middleware.go: metricsMiddleware() считает обновления бота
+// - api_server.go: в режиме serve эндпоинты доступны на том же сервере
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// READY_MAX_AGE_TTLS — /readyz отвечает 503, если успешной загрузки не было дольше
+// этого числа интервалов обновления кеша
+const READY_MAX_AGE_TTLS = 3
+
+// Провайдеры данных для меток метрик
+const (
+	providerVakhtangovAPI     = "vakhtangov_api"     // JSON с расписанием и продажами
+	providerVakhtangovPage    = "vakhtangov_page"    // страницы спектаклей
+	providerBallet            = "ballet"             // страницы балетов
+	providerVakhtangovTickets = "vakhtangov_tickets" // страницы покупки билетов
+)
+
+var (
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "showsparser_fetch_duration_seconds",
+		Help:    "Duration of a single page or API fetch, by provider.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20},
+	}, []string{"provider"})
+
+	fetchResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_fetch_responses_total",
+		Help: "HTTP responses from theater sites by provider and status code; status \"error\" for transport failures.",
+	}, []string{"provider", "status"})
+
+	parseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_parse_failures_total",
+		Help: "Responses that could not be parsed, by provider.",
+	}, []string{"provider"})
+
+	titleMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_title_matches_total",
+		Help: "Show pages whose title matched (or did not match) any performance from the API.",
+	}, []string{"provider", "result"})
+
+	sessionsFound = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "showsparser_sessions_found",
+		Help: "Sessions found during the last successful fetch, by provider.",
+	}, []string{"provider"})
+
+	lastSuccessTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "showsparser_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful fetch, by provider.",
+	}, []string{"provider"})
+
+	botUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_bot_updates_total",
+		Help: "Telegram updates handled, by command or callback action.",
+	}, []string{"command"})
+
+	notificationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_notification_deliveries_total",
+		Help: "Notification deliveries by channel and result; Telegram messages count once queued.",
+	}, []string{"channel", "result"})
+
+	outboxQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "showsparser_outbox_messages",
+		Help: "Telegram messages waiting in the outbound queue.",
+	})
+
+	outboxSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "showsparser_outbox_sends_total",
+		Help: "Attempts to send queued Telegram messages, by result: sent, retry, dropped.",
+	}, []string{"result"})
+)
+
+// observeFetch records duration and HTTP status of one fetch; resp may be nil on transport errors
+func observeFetch(provider string, start time.Time, resp *http.Response) {
+	fetchDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	fetchResponses.WithLabelValues(provider, status).Inc()
+}
+
+// scrapeHealth remembers the last successful fetch per provider for /readyz
+var scrapeHealth = struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// markFetchSuccess records a successful fetch and the number of sessions found
+func markFetchSuccess(provider string, sessions int) {
+	now := time.Now()
+	scrapeHealth.mu.Lock()
+	scrapeHealth.last[provider] = now
+	scrapeHealth.mu.Unlock()
+	lastSuccessTimestamp.WithLabelValues(provider).Set(float64(now.Unix()))
+	sessionsFound.WithLabelValues(provider).Set(float64(sessions))
+}
+
+// metricCommands — команды, которые попадают в метку как есть; остальные считаются как "other".
+// Команды меню отвечает defaultHandler(), остальные добавляет registerCommand().
+var metricCommands = struct {
+	mu    sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{"start": true, "shows": true, "afisha": true, "help": true}}
+
+// metricCallbackActions — действия callback-кнопок, которые разбирает callbackHandler()
+var metricCallbackActions = map[string]bool{
+	"afisha_noop":               true,
+	"afisha_theatre_vakhtangov": true,
+	"afisha_ballet":             true,
+	"afisha_theater":            true,
+	"afisha_filter":             true,
+	"afisha_page":               true,
+	"afisha_list":               true,
+	"afisha_show":               true,
+	"afisha_digest":             true,
+	"afisha_settings":           true,
+	"afisha_lang":               true,
+	"afisha_update":             true,
+}
+
+// addMetricCommand lets updates with the command keep their own label
+func addMetricCommand(name string) {
+	metricCommands.mu.Lock()
+	metricCommands.names[name] = true
+	metricCommands.mu.Unlock()
+}
+
+// updateCommand turns an update into a low-cardinality label: "/weekend" for
+// known commands, "afisha_page" for callback "afisha_page:...:2", "other" for
+// anything unknown
+func updateCommand(update *models.Update) string {
+	switch {
+	case update.Message != nil:
+		// Метрики считаются до authMiddleware, поэтому произвольные команды от кого угодно
+		// не должны плодить новые значения метки
+		if !strings.HasPrefix(strings.TrimSpace(update.Message.Text), "/") {
+			return "text"
+		}
+		name, ok := parseCommand(update.Message)
+		if !ok {
+			return "other"
+		}
+		metricCommands.mu.RLock()
+		known := metricCommands.names[name]
+		metricCommands.mu.RUnlock()
+		if !known {
+			return "other"
+		}
+		return "/" + name
+	case update.CallbackQuery != nil:
+		action, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		if !metricCallbackActions[action] {
+			return "other"
+		}
+		return action
+	case update.InlineQuery != nil:
+		return "inline"
+	}
+	return "other"
+}
+
+// metricsMiddleware counts handled updates by command
+func metricsMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		botUpdates.WithLabelValues(updateCommand(update)).Inc()
+		next(ctx, b, update)
+	}
+}
+
+type readyStatus struct {
+	Ready     bool               `json:"ready"`
+	Providers map[string]float64 `json:"last_success_age_seconds"`
+	// Stale — провайдеры без успешной загрузки за READY_MAX_AGE_TTLS интервалов
+	Stale []string `json:"stale,omitempty"`
+}
+
+// readyProviders lists the providers the cache refresher scrapes on every round.
+// Страницы покупки (vakhtangov_tickets) загружаются по требованию и в готовность не входят.
+func readyProviders() []string {
+	providers := []string{providerVakhtangovAPI, providerBallet}
+	for _, t := range currentConfig().Providers.Theaters {
+		providers = append(providers, theaterMetricsLabel(t))
+	}
+	return providers
+}
+
+// handleReady reports ready when every scraped provider was loaded successfully recently
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	maxAge := READY_MAX_AGE_TTLS * cacheTTL()
+	providers := readyProviders()
+
+	scrapeHealth.mu.Lock()
+	status := readyStatus{Providers: make(map[string]float64, len(scrapeHealth.last))}
+	for provider, at := range scrapeHealth.last {
+		status.Providers[provider] = time.Since(at).Seconds()
+	}
+	for _, provider := range providers {
+		at, ok := scrapeHealth.last[provider]
+		if !ok || time.Since(at) > maxAge {
+			status.Stale = append(status.Stale, provider)
+		}
+	}
+	scrapeHealth.mu.Unlock()
+
+	status.Ready = len(status.Stale) == 0
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// registerOpsHandlers adds /metrics, /healthz and /readyz to mux
+func registerOpsHandlers(mux *http.ServeMux) {
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", handleReady)
+}
+
+// runOpsServer serves the ops endpoints on addr until ctx is done
+func runOpsServer(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	registerOpsHandlers(mux)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), API_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	apiLog.Infof("Metrics server listening on %s", addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		apiLog.Errorf("Metrics server failed: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestUpdateCommand(t *testing.T) {
+	addMetricCommand("weekend")
+	prev := botUsername
+	botUsername = "afisha_bot"
+	t.Cleanup(func() { botUsername = prev })
+
+	message := func(text string) *models.Update {
+		return &models.Update{Message: &models.Message{Text: text}}
+	}
+	callback := func(data string) *models.Update {
+		return &models.Update{CallbackQuery: &models.CallbackQuery{Data: data}}
+	}
+	tests := []struct {
+		name   string
+		update *models.Update
+		want   string
+	}{
+		{"registered command", message("/weekend"), "/weekend"},
+		{"command with args and bot name", message("/Weekend@afisha_bot next"), "/weekend"},
+		{"menu command", message("/start"), "/start"},
+		{"unknown command", message("/x" + strings.Repeat("a", 40)), "other"},
+		{"command for another bot", message("/weekend@other_bot"), "other"},
+		{"plain text", message("привет"), "text"},
+		{"known callback", callback("afisha_page:afisha_ballet:2"), "afisha_page"},
+		{"theater callback", callback("afisha_theater:mxat"), "afisha_theater"},
+		{"forged callback", callback("random_" + strings.Repeat("b", 40)), "other"},
+		{"inline query", &models.Update{InlineQuery: &models.InlineQuery{Query: "чайка"}}, "inline"},
+		{"empty update", &models.Update{}, "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateCommand(tt.update); got != tt.want {
+				t.Errorf("updateCommand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	withConfig(t, func(c *AppConfig) {
+		c.Timeouts.CacheTTL = Duration{10 * time.Minute}
+		c.Providers.Theaters = []TheaterConfig{{ID: "mxat"}}
+	})
+	scrapeHealth.mu.Lock()
+	prev := scrapeHealth.last
+	scrapeHealth.mu.Unlock()
+	t.Cleanup(func() {
+		scrapeHealth.mu.Lock()
+		scrapeHealth.last = prev
+		scrapeHealth.mu.Unlock()
+	})
+
+	now := time.Now()
+	fresh, old := now.Add(-time.Minute), now.Add(-31*time.Minute)
+	tests := []struct {
+		name  string
+		last  map[string]time.Time
+		want  int
+		stale string
+	}{
+		{
+			name:  "all fresh",
+			last:  map[string]time.Time{"vakhtangov_api": fresh, "ballet": fresh, "theater_mxat": fresh},
+			want:  http.StatusOK,
+			stale: "",
+		},
+		{
+			name:  "ticket pages do not count",
+			last:  map[string]time.Time{"vakhtangov_api": fresh, "ballet": fresh, "theater_mxat": fresh, "vakhtangov_tickets": old},
+			want:  http.StatusOK,
+			stale: "",
+		},
+		{
+			name:  "one stale provider",
+			last:  map[string]time.Time{"vakhtangov_api": fresh, "ballet": old, "theater_mxat": fresh},
+			want:  http.StatusServiceUnavailable,
+			stale: "ballet",
+		},
+		{
+			name:  "theater never loaded",
+			last:  map[string]time.Time{"vakhtangov_api": fresh, "ballet": fresh},
+			want:  http.StatusServiceUnavailable,
+			stale: "theater_mxat",
+		},
+		{
+			name:  "nothing loaded",
+			last:  map[string]time.Time{},
+			want:  http.StatusServiceUnavailable,
+			stale: "vakhtangov_api ballet theater_mxat",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scrapeHealth.mu.Lock()
+			scrapeHealth.last = tt.last
+			scrapeHealth.mu.Unlock()
+
+			rec := httptest.NewRecorder()
+			handleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var status readyStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want || status.Ready != (tt.want == http.StatusOK) {
+				t.Errorf("status = %d ready=%v, want %d", rec.Code, status.Ready, tt.want)
+			}
+			if got := strings.Join(status.Stale, " "); got != tt.stale {
+				t.Errorf("stale = %q, want %q", got, tt.stale)
+			}
+		})
+	}
+}
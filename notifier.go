@@ -0,0 +1,109 @@
+// Package main содержит рассылку изменений афиши по каналам доставки.
+//
+// Этот файл реализует:
+// - Notifier - канал доставки уведомлений одному получателю (Telegram-чат, почтовый адрес, webhook)
+// - notificationTargets() - все получатели: подписанные чаты и их адреса из /email, notifications.email.to и notifications.webhooks
+// - runChangeNotifier() - рассылка новых дат и начала продаж всем получателям
+//
+// Взаимодействует с:
+// - afisha_cache.go: изменения берутся из журнала cache.Changes()
+// - telegram_subscriptions.go: telegramNotifier и подписки чатов
+// - notifier_email.go: emailNotifier отправляет письма через SMTP
+// - notifier_webhook.go: webhookNotifier отправляет JSON во внешние сервисы
+// - vakhtangov_tickets.go: цены и места для уведомлений о начале продаж
+// - metrics.go: учет доставок по каналам
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// Notifier delivers afisha changes to one recipient
+type Notifier interface {
+	// Channel names the delivery channel for metrics: "telegram", "email", "webhook"
+	Channel() string
+	Notify(ctx context.Context, changes []PerformanceChange) error
+}
+
+// notificationTarget — получатель уведомлений и его ограничение цены (0 — без ограничения)
+type notificationTarget struct {
+	notifier Notifier
+	maxPrice int
+}
+
+// notificationTargets lists the current recipients; b may be nil when the bot is not running
+func notificationTargets(b *bot.Bot) []notificationTarget {
+	var targets []notificationTarget
+	notifications := currentConfig().Notifications
+	if subscriptions != nil {
+		for _, sub := range subscriptions.all() {
+			if b != nil {
+				targets = append(targets, notificationTarget{
+					notifier: telegramNotifier{chatID: sub.ChatID},
+					maxPrice: sub.MaxPrice,
+				})
+			}
+			if sub.Email != "" && notifications.Email.SMTPHost != "" {
+				targets = append(targets, notificationTarget{
+					notifier: emailNotifier{cfg: notifications.Email, to: sub.Email, chatID: sub.ChatID},
+					maxPrice: sub.MaxPrice,
+				})
+			}
+		}
+	}
+	// Адреса из конфига получают все изменения без фильтров, например администратор афиши
+	for _, to := range notifications.Email.To {
+		targets = append(targets, notificationTarget{notifier: emailNotifier{cfg: notifications.Email, to: to}})
+	}
+	for i, wh := range notifications.Webhooks {
+		targets = append(targets, notificationTarget{notifier: webhookNotifier{cfg: wh, index: i}})
+	}
+	return targets
+}
+
+// runChangeNotifier sends new dates and sale starts to every recipient until ctx is done
+func runChangeNotifier(ctx context.Context, b *bot.Bot) {
+	cursor := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cacheTTL()):
+		}
+
+		// Загружает сайты, если кеш устарел; изменения попадают в журнал кеша
+		if _, _, err := cache.Shows(ctx, cacheTTL()); err != nil {
+			logError(err)
+			continue
+		}
+		var changes []PerformanceChange
+		for _, ch := range cache.Changes(cursor) {
+			if ch.At.After(cursor) {
+				cursor = ch.At
+			}
+			if notifiableChange(ch) {
+				changes = append(changes, ch)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		tickets.annotateChanges(ctx, changes)
+
+		for _, t := range notificationTargets(b) {
+			targetChanges := withinMaxPrice(changes, t.maxPrice)
+			if len(targetChanges) == 0 {
+				continue
+			}
+			result := "ok"
+			if err := t.notifier.Notify(ctx, targetChanges); err != nil {
+				log.Errorw("Error delivering notification", "channel", t.notifier.Channel(), "error", err)
+				result = "error"
+			}
+			notificationDeliveries.WithLabelValues(t.notifier.Channel(), result).Inc()
+		}
+	}
+}
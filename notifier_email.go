@@ -0,0 +1,311 @@
+// Package main содержит рассылку изменений афиши по электронной почте.
+//
+// Этот файл реализует:
+// - emailNotifier - Notifier, который отправляет письмо одному адресу: из /email подписанного чата или из notifications.email.to
+// - renderEmail() - письмо из двух частей (текст и HTML) по шаблонам из тех же данных, что и в Telegram
+// - sendSMTP() - отправка через SMTP без шифрования (plain) или со STARTTLS
+// - sendTestEmail() - тестовое письмо командой "showsparser email-test"
+//
+// Пароль SMTP берется из SMTP_PASSWORD и скрывается в логах. Для проверки без настоящей почты
+// подойдет локальный SMTP вроде Mailpit: make mailpit, затем smtp_host "localhost",
+// smtp_port 1025 и security "plain".
+//
+// Взаимодействует с:
+// - notifier.go: runChangeNotifier() рассылает изменения всем адресам
+// - telegram_subscriptions.go: адрес чата из /email получает его уведомления с ограничением /maxprice
+// - telegram_settings.go: выключенные в /settings типы изменений не попадают и в письма чата
+// - config.go: настройки SMTP и адреса в notifications.email
+// - vakhtangov_tickets.go: ticketSummary() - цены и места в письме
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"parser/logger"
+)
+
+// EMAIL_SEND_TIMEOUT — сколько ждать SMTP-сервер при отправке одного письма
+const EMAIL_SEND_TIMEOUT = 30 * time.Second
+
+// emailChange — одно изменение в письме: строки уже отформатированы, шаблону остается разметка
+type emailChange struct {
+	Event   string
+	Title   string
+	When    string
+	Tickets string
+	BuyLink string
+}
+
+var emailTextTemplate = texttemplate.Must(texttemplate.New("text").Parse(`Изменения в афише
+{{range .}}
+{{.Event}}: {{.Title}}
+{{.When}}
+{{- if .Tickets}}
+{{.Tickets}}
+{{- end}}
+{{- if .BuyLink}}
+Купить билеты: {{.BuyLink}}
+{{- end}}
+{{end}}`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; line-height: 1.4">
+<h2>Изменения в афише</h2>
+{{range .}}<p>
+<span style="color: #666">{{.Event}}</span><br>
+<b>{{.Title}}</b><br>
+{{.When}}
+{{- if .Tickets}}<br>
+{{.Tickets}}
+{{- end}}
+{{- if .BuyLink}}<br>
+<a href="{{.BuyLink}}">Купить билеты</a>
+{{- end}}
+</p>
+{{end}}</body>
+</html>
+`))
+
+// emailNotifier sends changes to one address
+type emailNotifier struct {
+	cfg EmailConfig
+	to  string
+	// chatID — подписанный чат, чьи настройки применяются к письмам; 0 — адрес из конфига, без фильтров
+	chatID int64
+}
+
+func (n emailNotifier) Channel() string { return "email" }
+
+// Notify sends one email; for a chat's address the chat's /settings choose which changes go out.
+// Тихие часы к письмам не применяются: письмо не будит.
+func (n emailNotifier) Notify(ctx context.Context, changes []PerformanceChange) error {
+	if n.chatID != 0 {
+		prefs := preferences.get(n.chatID)
+		if !prefs.streamEnabled(streamChanges) {
+			return nil
+		}
+		if changes = prefs.wantedChanges(changes); len(changes) == 0 {
+			return nil
+		}
+	}
+	msg, err := renderEmail(n.cfg.From, n.to, emailSubject(changes), changes)
+	if err != nil {
+		return err
+	}
+	if err := sendSMTP(ctx, n.cfg, n.to, msg); err != nil {
+		return fmt.Errorf("email to %s: %w", n.to, err)
+	}
+	return nil
+}
+
+// emailSubject names the only change or counts several
+func emailSubject(changes []PerformanceChange) string {
+	if len(changes) == 1 {
+		ch := changes[0]
+		return fmt.Sprintf("%s: %s, %s", changeEventTitle(ch.Event), ch.Title, stringifyDateWithYear(ch.Start))
+	}
+	return fmt.Sprintf("Изменения в афише: %d", len(changes))
+}
+
+// emailChanges prepares template data from the same fields the Telegram message uses
+func emailChanges(changes []PerformanceChange) []emailChange {
+	out := make([]emailChange, 0, len(changes))
+	for _, ch := range changes {
+		e := emailChange{
+			Event:   changeEventTitle(ch.Event),
+			Title:   ch.Title,
+			When:    sessionWhen(ch.Start, ch.Stage),
+			Tickets: ticketSummary(langRu, TicketInfo{MinPrice: ch.MinPrice, Seats: ch.SeatsLeft}),
+		}
+		if ch.NewOnSale {
+			e.BuyLink = ch.BuyLink
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// renderEmail builds a multipart/alternative message with text and HTML bodies
+func renderEmail(from, to, subject string, changes []PerformanceChange) ([]byte, error) {
+	data := emailChanges(changes)
+	var text, html bytes.Buffer
+	if err := emailTextTemplate.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+	if err := emailHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(p.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	// mail.Address кодирует имя отправителя, например "Афиша <bot@example.com>"
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	var msg bytes.Buffer
+	headers := []string{
+		"From: " + sender.String(),
+		"To: " + to,
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + newMessageID(from),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// newMessageID returns a unique Message-ID in the sender's domain
+func newMessageID(from string) string {
+	domain := "showsparser"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// smtpPassword returns SMTP_PASSWORD and registers it for redaction in logs
+func smtpPassword() string {
+	password := os.Getenv("SMTP_PASSWORD")
+	logger.AddSecret(password)
+	return password
+}
+
+// smtpRootCAs verifies the SMTP server certificate; nil means the system roots
+var smtpRootCAs *x509.CertPool
+
+// sendSMTP delivers one message; STARTTLS is required when security is "starttls"
+func sendSMTP(ctx context.Context, cfg EmailConfig, to string, msg []byte) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", cfg.From, err)
+	}
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	dialer := net.Dialer{Timeout: EMAIL_SEND_TIMEOUT}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(EMAIL_SEND_TIMEOUT))
+
+	c, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session with %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if cfg.Security == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS; set security to \"plain\" only for a local server")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.SMTPHost, RootCAs: smtpRootCAs}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		// PlainAuth сам откажется передавать пароль без TLS, если сервер не localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, smtpPassword(), cfg.SMTPHost)); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT TO rejected: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+	return c.Quit()
+}
+
+// sendTestEmail sends a sample notification to every configured address
+func sendTestEmail(ctx context.Context) error {
+	cfg := currentConfig().Notifications.Email
+	if len(cfg.To) == 0 {
+		return errors.New("notifications.email.to is empty")
+	}
+	start := mskTime(startOfDay(mskWallClock(time.Now())).AddDate(0, 0, 7).Add(19 * time.Hour))
+	sample := []PerformanceChange{{
+		At:        time.Now(),
+		Event:     ChangeOnSale,
+		Title:     "Тестовое уведомление",
+		Start:     start,
+		Stage:     "Основная сцена",
+		NewOnSale: true,
+		BuyLink:   FEED_SITE_URL,
+		MinPrice:  1500,
+		SeatsLeft: 40,
+	}}
+	var errs []error
+	for _, to := range cfg.To {
+		if err := (emailNotifier{cfg: cfg, to: to}).Notify(ctx, sample); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the stub server received in one connection
+type smtpSession struct {
+	tls  bool
+	auth string
+	from string
+	rcpt []string
+	data []byte
+}
+
+// startSMTPStub serves one SMTP session on 127.0.0.1; with cert set it offers STARTTLS
+func startSMTPStub(t *testing.T, cert *tls.Certificate) (port int, done <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var s smtpSession
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 stub ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				if cert != nil && !s.tls {
+					tp.PrintfLine("250-stub\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+				} else {
+					tp.PrintfLine("250-stub\r\n250 AUTH PLAIN")
+				}
+			case "STARTTLS":
+				tp.PrintfLine("220 ready")
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*cert}})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn, s.tls = tlsConn, true
+				tp = textproto.NewConn(conn)
+			case "AUTH":
+				s.auth = arg
+				tp.PrintfLine("235 ok")
+			case "MAIL":
+				s.from = arg
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, arg)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go on")
+				s.data, err = io.ReadAll(tp.DotReader())
+				if err != nil {
+					return
+				}
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				sessions <- s
+				return
+			default:
+				tp.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, sessions
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 and a pool that trusts it
+func selfSignedCert(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp stub"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func testEmailChanges() []PerformanceChange {
+	return []PerformanceChange{{
+		Event:     ChangeOnSale,
+		Title:     "Ревизор & <Чайка>",
+		Start:     time.Date(2026, time.November, 20, 19, 0, 0, 0, time.UTC),
+		Stage:     "Основная сцена",
+		NewOnSale: true,
+		BuyLink:   "https://x.ru/buy?a=1&b=2",
+		MinPrice:  1500,
+		SeatsLeft: 40,
+	}}
+}
+
+func TestSendSMTP(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	tests := []struct {
+		name     string
+		security string
+		cert     *tls.Certificate
+		username string
+	}{
+		{name: "plain", security: "plain"},
+		{name: "starttls", security: "starttls", cert: cert, username: "bot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := smtpRootCAs
+			smtpRootCAs = pool
+			t.Cleanup(func() { smtpRootCAs = prev })
+			t.Setenv("SMTP_PASSWORD", "pa55")
+
+			port, sessions := startSMTPStub(t, tt.cert)
+			cfg := EmailConfig{
+				SMTPHost: "127.0.0.1",
+				SMTPPort: port,
+				Security: tt.security,
+				Username: tt.username,
+				From:     "Афиша <afisha@example.com>",
+			}
+			changes := testEmailChanges()
+			msg, err := renderEmail(cfg.From, "reader@example.com", emailSubject(changes), changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sendSMTP(context.Background(), cfg, "reader@example.com", msg); err != nil {
+				t.Fatal(err)
+			}
+
+			var s smtpSession
+			select {
+			case s = <-sessions:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the stub got no session")
+			}
+			if s.tls != (tt.security == "starttls") {
+				t.Errorf("tls = %v", s.tls)
+			}
+			if (s.auth != "") != (tt.username != "") {
+				t.Errorf("auth = %q", s.auth)
+			}
+			if s.from != "FROM:<afisha@example.com>" || len(s.rcpt) != 1 || s.rcpt[0] != "TO:<reader@example.com>" {
+				t.Errorf("envelope = %q %q", s.from, s.rcpt)
+			}
+			checkEmailParts(t, s.data)
+		})
+	}
+}
+
+// checkEmailParts reads the text and HTML parts of a received message
+func checkEmailParts(t *testing.T, data []byte) {
+	t.Helper()
+	m, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || !strings.Contains(subject, "Ревизор & <Чайка>") {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Errorf("part %q is not quoted-printable", p.Header.Get("Content-Type"))
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[p.Header.Get("Content-Type")] = string(body)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want text and HTML", len(parts))
+	}
+
+	text := parts["text/plain; charset=UTF-8"]
+	for _, want := range []string{"Ревизор & <Чайка>", "Купить билеты: https://x.ru/buy?a=1&b=2", "1500"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part has no %q:\n%s", want, text)
+		}
+	}
+	html := parts["text/html; charset=UTF-8"]
+	for _, want := range []string{"<b>Ревизор &amp; &lt;Чайка&gt;</b>", `<a href="https://x.ru/buy?a=1&amp;b=2">Купить билеты</a>`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML part has no %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestNotificationTargetsEmailFollowsSubscription(t *testing.T) {
+	store, err := newSubscriptionStore(t.TempDir() + "/subscriptions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := subscriptions
+	subscriptions = store
+	t.Cleanup(func() { subscriptions = prev })
+	store.add(1, "reader")
+	store.setMaxPrice(1, 1000)
+	store.setEmail(1, "reader@example.com")
+	store.add(2, "no email")
+
+	withConfig(t, func(c *AppConfig) {
+		c.Notifications.Email = EmailConfig{SMTPHost: "127.0.0.1", SMTPPort: 25, From: "afisha@example.com", To: []string{"admin@example.com"}}
+	})
+
+	var got []string
+	for _, target := range notificationTargets(nil) {
+		n, ok := target.notifier.(emailNotifier)
+		if !ok {
+			continue
+		}
+		got = append(got, n.to+":"+strconv.FormatInt(n.chatID, 10)+":"+strconv.Itoa(target.maxPrice))
+	}
+	want := "reader@example.com:1:1000|admin@example.com:0:0"
+	if strings.Join(got, "|") != want {
+		t.Errorf("email targets = %q, want %q", got, want)
+	}
+}
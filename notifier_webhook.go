@@ -0,0 +1,232 @@
+// Package main содержит рассылку изменений афиши во внешние webhook (Slack, n8n, Home Assistant).
+//
+// Этот файл реализует:
+// - webhookNotifier - Notifier, который отправляет POST с JSON на адрес из notifications.webhooks
+// - signWebhook() - подпись HMAC-SHA256 тела запроса
+// - postWithRetries() - повторы при сетевых ошибках, 429 и 5xx с экспоненциальной паузой
+// - deadLetter() - запись неотправленных уведомлений в storage.dir/webhook_dead_letter.jsonl
+//
+// Тело запроса: {"text": "...", "changes": [...]}. Поле text — готовый текст для Slack-совместимых
+// входящих webhook, changes — те же объекты, что отдает /api/changes.
+//
+// Если у webhook задан secret_env, секрет берется из этой переменной окружения и запрос
+// подписывается: X-Showsparser-Timestamp — Unix-время, X-Showsparser-Signature —
+// "sha256=" + hex(HMAC-SHA256(секрет, timestamp + "." + тело)). Получатель должен сверить
+// подпись и отклонять запросы со старым timestamp.
+//
+// Взаимодействует с:
+// - notifier.go: runChangeNotifier() рассылает изменения всем webhook
+// - config.go: адреса и имена переменных с секретами в notifications.webhooks
+// - storage.go: дописывание строк в журнал неотправленных уведомлений
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"parser/logger"
+)
+
+// WEBHOOK_MAX_ATTEMPTS — сколько раз пытаться доставить уведомление в один webhook
+const WEBHOOK_MAX_ATTEMPTS = 4
+
+// WEBHOOK_RETRY_DELAY — пауза перед первым повтором, дальше она удваивается
+const WEBHOOK_RETRY_DELAY = time.Second
+
+// WEBHOOK_MAX_RETRY_AFTER — больше этого Retry-After не ждем, уведомление уходит в журнал неотправленных
+const WEBHOOK_MAX_RETRY_AFTER = time.Minute
+
+// WEBHOOK_TIMEOUT — время на один запрос
+const WEBHOOK_TIMEOUT = 10 * time.Second
+
+// webhookPayload — тело запроса
+type webhookPayload struct {
+	Text    string              `json:"text"`
+	Changes []PerformanceChange `json:"changes"`
+}
+
+// webhookNotifier posts changes to one URL
+type webhookNotifier struct {
+	cfg   WebhookConfig
+	index int // позиция в notifications.webhooks
+}
+
+// name identifies the webhook without its URL, which may carry a token
+func (n webhookNotifier) name() string {
+	if n.cfg.Name != "" {
+		return n.cfg.Name
+	}
+	return fmt.Sprintf("notifications.webhooks[%d]", n.index)
+}
+
+func (n webhookNotifier) Channel() string { return "webhook" }
+
+func (n webhookNotifier) Notify(ctx context.Context, changes []PerformanceChange) error {
+	body, err := json.Marshal(webhookPayload{Text: webhookText(changes), Changes: changes})
+	if err != nil {
+		return err
+	}
+	attempts, err := postWithRetries(ctx, n.cfg, body)
+	if err == nil {
+		return nil
+	}
+	if dlErr := deadLetter(n.name(), webhookHost(n.cfg.URL), attempts, err, body); dlErr != nil {
+		logError(dlErr)
+	}
+	return fmt.Errorf("webhook %s (%s): %w", n.name(), webhookHost(n.cfg.URL), err)
+}
+
+// webhookText renders changes as plain text for Slack-compatible receivers
+func webhookText(changes []PerformanceChange) string {
+	lines := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		line := changeEventTitle(ch.Event) + ": " + ch.Title + ", " + sessionWhen(ch.Start, ch.Stage)
+		if summary := ticketSummary(langRu, TicketInfo{MinPrice: ch.MinPrice, Seats: ch.SeatsLeft}); summary != "" {
+			line += " (" + summary + ")"
+		}
+		if ch.NewOnSale && ch.BuyLink != "" {
+			line += " " + ch.BuyLink
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// signWebhook returns the signature header value for body sent at timestamp
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSecret reads the signing secret from the configured variable and hides it in logs
+func webhookSecret(cfg WebhookConfig) string {
+	if cfg.SecretEnv == "" {
+		return ""
+	}
+	secret := os.Getenv(cfg.SecretEnv)
+	logger.AddSecret(secret)
+	return secret
+}
+
+// postWithRetries sends body until it is accepted, the error is permanent or attempts run out.
+// Повторяются сетевые ошибки, 429 и 5xx; остальные 4xx означают, что повтор не поможет.
+func postWithRetries(ctx context.Context, cfg WebhookConfig, body []byte) (int, error) {
+	delay := WEBHOOK_RETRY_DELAY
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		var retry bool
+		retryAfter, retry, err = postWebhook(ctx, cfg, body)
+		if err == nil || !retry || attempt == WEBHOOK_MAX_ATTEMPTS {
+			return attempt, err
+		}
+		wait := delay
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > WEBHOOK_MAX_RETRY_AFTER {
+			return attempt, err
+		}
+		log.Warnw("Webhook delivery failed, retrying", "host", webhookHost(cfg.URL), "attempt", attempt, "wait", wait, "error", err)
+		if !webhookWait(ctx, wait) {
+			return attempt, err
+		}
+		delay *= 2
+	}
+}
+
+// webhookWait pauses between attempts and reports false if ctx is done first.
+// Тесты подменяют ее, чтобы не ждать настоящих пауз.
+var webhookWait = func(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// postWebhook makes one attempt and reports whether it is worth retrying
+func postWebhook(ctx context.Context, cfg WebhookConfig, body []byte) (retryAfter time.Duration, retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, WEBHOOK_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "showsparser")
+	if secret := webhookSecret(cfg); secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Showsparser-Timestamp", timestamp)
+		req.Header.Set("X-Showsparser-Signature", signWebhook(secret, timestamp, body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// url.Error содержит полный адрес, а в нем токен webhook
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = fmt.Errorf("status %d", resp.StatusCode)
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return retryAfter, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// webhookHost returns only the host for logs: Slack-style URLs carry the token in the path
+func webhookHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "invalid-url"
+	}
+	return u.Host
+}
+
+// deadLetterEntry — строка журнала неотправленных уведомлений.
+// Полный адрес не пишется: в пути Slack-совместимых webhook лежит токен, адрес берется из конфига по имени.
+type deadLetterEntry struct {
+	At       time.Time       `json:"at"`
+	Webhook  string          `json:"webhook"`
+	Host     string          `json:"host"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// deadLetter records a payload that could not be delivered so it can be replayed by hand
+func deadLetter(name, host string, attempts int, deliveryErr error, body []byte) error {
+	log.Errorw("Webhook delivery gave up, writing to dead letter log", "webhook", name, "host", host, "attempts", attempts)
+	return appendJSONLine(storagePath("webhook_dead_letter.jsonl"), deadLetterEntry{
+		At:       time.Now(),
+		Webhook:  name,
+		Host:     host,
+		Attempts: attempts,
+		Error:    deliveryErr.Error(),
+		Payload:  body,
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withConfig runs the test with a copy of the current config changed by fn
+func withConfig(t *testing.T, fn func(c *AppConfig)) {
+	t.Helper()
+	prev := appConfig.Load()
+	cfg := *currentConfig()
+	fn(&cfg)
+	appConfig.Store(&cfg)
+	t.Cleanup(func() { appConfig.Store(prev) })
+}
+
+func TestWebhookDeadLetterHidesURL(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, func(c *AppConfig) { c.Storage.Dir = dir })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	const token = "T000/B000/XXXXSECRET"
+	tests := []struct {
+		notifier webhookNotifier
+		want     string
+	}{
+		{webhookNotifier{cfg: WebhookConfig{Name: "slack", URL: srv.URL + "/services/" + token}}, "slack"},
+		{webhookNotifier{cfg: WebhookConfig{URL: srv.URL + "/hooks/" + token}, index: 2}, "notifications.webhooks[2]"},
+	}
+	for _, tt := range tests {
+		err := tt.notifier.Notify(t.Context(), testEmailChanges())
+		if err == nil || strings.Contains(err.Error(), token) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Notify error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(dir + "/webhook_dead_letter.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Errorf("dead letter log keeps the webhook token:\n%s", data)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("got %d dead letters, want %d", len(lines), len(tests))
+	}
+	host := webhookHost(srv.URL)
+	for i, line := range lines {
+		var e deadLetterEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Webhook != tests[i].want || e.Host != host || e.Attempts != 1 || e.Error != "status 403" {
+			t.Errorf("dead letter %d = %+v", i, e)
+		}
+		var p webhookPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil || len(p.Changes) != 1 {
+			t.Errorf("dead letter %d payload = %s, %v", i, e.Payload, err)
+		}
+	}
+}
+
+// withWebhookWaits records retry pauses instead of sleeping
+func withWebhookWaits(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	prev := webhookWait
+	webhookWait = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return ctx.Err() == nil
+	}
+	t.Cleanup(func() { webhookWait = prev })
+	return &waits
+}
+
+func TestWebhookSignature(t *testing.T) {
+	withWebhookWaits(t)
+	t.Setenv("TEST_WEBHOOK_SECRET", "s3cret")
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Clone(), body}
+	}))
+	defer srv.Close()
+
+	changes := testEmailChanges()
+	signed := webhookNotifier{cfg: WebhookConfig{URL: srv.URL, SecretEnv: "TEST_WEBHOOK_SECRET"}}
+	if err := signed.Notify(t.Context(), changes); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	ts := req.header.Get("X-Showsparser-Timestamp")
+	sent, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)).Abs() > time.Minute {
+		t.Errorf("timestamp = %q", ts)
+	}
+	sig := req.header.Get("X-Showsparser-Signature")
+	if sig != signWebhook("s3cret", ts, req.body) {
+		t.Errorf("signature %q does not match the received body", sig)
+	}
+	// Получатель считает подпись сам: HMAC-SHA256 от "timestamp.тело"
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "." + string(req.body)))
+	if sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature %q is not HMAC-SHA256 of timestamp.body", sig)
+	}
+	if signWebhook("other", ts, req.body) == sig || signWebhook("s3cret", ts+"1", req.body) == sig {
+		t.Error("signature ignores the secret or the timestamp")
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(req.body, &p); err != nil || len(p.Changes) != 1 || p.Text != webhookText(changes) {
+		t.Errorf("payload = %s, %v", req.body, err)
+	}
+
+	// Без secret_env подписи нет
+	if err := (webhookNotifier{cfg: WebhookConfig{URL: srv.URL}}).Notify(t.Context(), changes); err != nil {
+		t.Fatal(err)
+	}
+	req = <-requests
+	if req.header.Get("X-Showsparser-Signature") != "" || req.header.Get("X-Showsparser-Timestamp") != "" {
+		t.Errorf("unsigned webhook sent %v", req.header)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int  // ответы по порядку, дальше 200
+		retryAfter string // заголовок Retry-After у 429
+		attempts   int
+		waits      string
+		deadLetter string // ошибка в журнале неотправленных; пусто — доставлено
+	}{
+		{
+			name:     "5xx then success",
+			statuses: []int{500, 502},
+			attempts: 3,
+			waits:    "[1s 2s]",
+		},
+		{
+			name:       "5xx every time",
+			statuses:   []int{503, 503, 503, 503, 503},
+			attempts:   WEBHOOK_MAX_ATTEMPTS,
+			waits:      "[1s 2s 4s]",
+			deadLetter: "status 503",
+		},
+		{
+			name:       "429 waits for Retry-After",
+			statuses:   []int{429},
+			retryAfter: "7",
+			attempts:   2,
+			waits:      "[7s]",
+		},
+		{
+			name:       "429 shorter than the backoff",
+			statuses:   []int{500, 429},
+			retryAfter: "1",
+			attempts:   3,
+			waits:      "[1s 2s]",
+		},
+		{
+			name:       "429 every time",
+			statuses:   []int{429, 429, 429, 429},
+			retryAfter: "3",
+			attempts:   WEBHOOK_MAX_ATTEMPTS,
+			waits:      "[3s 3s 4s]",
+			deadLetter: "status 429",
+		},
+		{
+			name:       "Retry-After too long",
+			statuses:   []int{429},
+			retryAfter: "3600",
+			attempts:   1,
+			waits:      "[]",
+			deadLetter: "status 429",
+		},
+		{
+			name:       "4xx is not retried",
+			statuses:   []int{400},
+			attempts:   1,
+			waits:      "[]",
+			deadLetter: "status 400",
+		},
+		{
+			name:       "404 is not retried",
+			statuses:   []int{404},
+			attempts:   1,
+			waits:      "[]",
+			deadLetter: "status 404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			withConfig(t, func(c *AppConfig) { c.Storage.Dir = dir })
+			waits := withWebhookWaits(t)
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				if n > len(tt.statuses) {
+					return
+				}
+				status := tt.statuses[n-1]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			err := webhookNotifier{cfg: WebhookConfig{Name: "n8n", URL: srv.URL}}.Notify(t.Context(), testEmailChanges())
+			if (err != nil) != (tt.deadLetter != "") {
+				t.Errorf("Notify error = %v", err)
+			}
+			if got := int(calls.Load()); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+			if got := fmt.Sprint(*waits); got != tt.waits {
+				t.Errorf("waits = %s, want %s", got, tt.waits)
+			}
+
+			data, err := os.ReadFile(dir + "/webhook_dead_letter.jsonl")
+			if tt.deadLetter == "" {
+				if err == nil {
+					t.Errorf("delivered notification is in the dead letter log:\n%s", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var e deadLetterEntry
+			if err := json.Unmarshal(data, &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Webhook != "n8n" || e.Attempts != tt.attempts || e.Error != tt.deadLetter {
+				t.Errorf("dead letter = %+v", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Package main содержит корректное завершение процесса по сигналам ОС.
+//
+// Этот файл реализует:
+// - shutdownGroup - учет выполняющихся обработчиков и фоновых задач
+// - drainMiddleware() - дает обработчикам Telegram завершить редактирование сообщений после сигнала
+// - Хуки OnShutdown() для сохранения состояния перед выходом; бот сохраняет так все свои хранилища
+//
+// Порядок остановки: SIGINT/SIGTERM отменяет корневой контекст в main(), бот перестает
+// принимать обновления, Drain() ждет текущие обработчики и задачи не дольше SHUTDOWN_TIMEOUT,
+// затем выполняются хуки и сбрасываются буферы логгера.
+//
+// Взаимодействует с:
+// - main.go: создает корневой контекст через signal.NotifyContext() и вызывает shutdown.Drain()
+// - telegram.go: подключает drainMiddleware() в цепочку middleware и регистрирует хуки сохранения хранилищ
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// SHUTDOWN_TIMEOUT — сколько ждать завершения обработчиков и задач после сигнала
+const SHUTDOWN_TIMEOUT = 20 * time.Second
+
+// shutdownGroup tracks in-flight work that must finish before the process exits
+type shutdownGroup struct {
+	wg sync.WaitGroup
+	// draining выставляется в Drain() под mu; после этого wg.Add() не вызывается,
+	// иначе он гонялся бы с wg.Wait()
+	draining bool
+
+	// drainCtx отменяется, когда истекает время на завершение работы
+	drainCtx    context.Context
+	cancelDrain context.CancelFunc
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+var shutdown = newShutdownGroup()
+
+func newShutdownGroup() *shutdownGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &shutdownGroup{drainCtx: ctx, cancelDrain: cancel}
+}
+
+// detach returns a context that survives cancellation of ctx
+// but is canceled once the drain deadline passes
+func (g *shutdownGroup) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(g.drainCtx, cancel)
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
+
+// track counts one more piece of in-flight work; false once Drain has started
+func (g *shutdownGroup) track() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.draining {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// Go runs a background job that Drain waits for.
+// The job's context is canceled when ctx is done; it must return promptly after that.
+// После начала Drain() новые задачи не запускаются.
+func (g *shutdownGroup) Go(ctx context.Context, job func(ctx context.Context)) {
+	if !g.track() {
+		log.Warn("Shutdown in progress, background job not started")
+		return
+	}
+	go func() {
+		defer g.wg.Done()
+		job(ctx)
+	}()
+}
+
+// OnShutdown registers a hook run after in-flight work is drained, e.g. to flush state
+func (g *shutdownGroup) OnShutdown(name string, fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.hooks = append(g.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Drain waits for in-flight handlers and jobs up to timeout, then runs the hooks
+func (g *shutdownGroup) Drain(timeout time.Duration) error {
+	g.mu.Lock()
+	g.draining = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Info("All in-flight work finished")
+	case <-time.After(timeout):
+		err = errors.New("shutdown timeout exceeded, abandoning in-flight work")
+		log.Warn(err.Error())
+	}
+	g.cancelDrain()
+
+	g.mu.Lock()
+	hooks := g.hooks
+	g.mu.Unlock()
+
+	hookCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, h := range hooks {
+		if hookErr := h.fn(hookCtx); hookErr != nil {
+			log.Errorf("Shutdown hook %s failed: %v", h.name, hookErr)
+			err = errors.Join(err, hookErr)
+		}
+	}
+	return err
+}
+
+// drainMiddleware lets handlers already running finish after the bot context is canceled.
+// Обновления, пришедшие после начала Drain(), не обрабатываются.
+func drainMiddleware(g *shutdownGroup) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if !g.track() {
+				log.Warnw("Shutdown in progress, update dropped", "update_id", update.ID)
+				return
+			}
+			defer g.wg.Done()
+			handlerCtx, cancel := g.detach(ctx)
+			defer cancel()
+			next(handlerCtx, b, update)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestDrainWaitsForHandlersThenRunsHooks(t *testing.T) {
+	g := newShutdownGroup()
+	var order []string
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := drainMiddleware(g)(func(ctx context.Context, _ *bot.Bot, _ *models.Update) {
+		close(started)
+		<-release
+		order = append(order, "handler")
+	})
+	g.OnShutdown("flush", func(context.Context) error {
+		order = append(order, "hook")
+		return nil
+	})
+
+	go handler(context.Background(), nil, &models.Update{ID: 1})
+	<-started
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	if err := g.Drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "handler" || order[1] != "hook" {
+		t.Fatalf("order = %v, want handler then hook", order)
+	}
+
+	// После Drain() новые обновления и задачи не принимаются
+	var ran atomic.Bool
+	drainMiddleware(g)(func(context.Context, *bot.Bot, *models.Update) { ran.Store(true) })(context.Background(), nil, &models.Update{ID: 2})
+	g.Go(context.Background(), func(context.Context) { ran.Store(true) })
+	time.Sleep(10 * time.Millisecond)
+	if ran.Load() {
+		t.Error("work started after Drain")
+	}
+}
+
+func TestDrainConcurrentWithUpdates(t *testing.T) {
+	g := newShutdownGroup()
+	handler := drainMiddleware(g)(func(context.Context, *bot.Bot, *models.Update) {})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				handler(context.Background(), nil, &models.Update{})
+			}
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if err := g.Drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	<-done
+}
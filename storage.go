@@ -0,0 +1,94 @@
+// Package main содержит хранение состояния бота в JSON-файлах.
+//
+// Этот файл реализует:
+// - storagePath() - путь к файлу в каталоге storage.dir из конфига
+// - readJSONFile() / writeJSONFile() - чтение и атомарная запись (через временный файл и rename)
+// - writeFileAtomic() - атомарная запись произвольного файла, например ленты Atom
+// - appendJSONLine() - дописывание строки JSON в журнал, например неотправленных webhook
+//
+// Взаимодействует с:
+// - config.go: каталог берется из storage.dir (или STORAGE_DIR)
+// - telegram_subscriptions.go: подписки чатов на изменения афиши
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// storagePath returns the path of a state file inside the storage directory
+func storagePath(name string) string {
+	return filepath.Join(currentConfig().Storage.Dir, name)
+}
+
+// readJSONFile decodes path into v; a missing file leaves v untouched and is not an error
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile replaces path with v encoded as JSON
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// appendJSONLine appends v as one JSON line, creating the file if needed
+func appendJSONLine(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir for %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data.
+// Запись идет во временный файл рядом, поэтому при сбое старое содержимое сохраняется.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir for %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
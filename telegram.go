@@ -1,12 +1,30 @@
 // Package main содержит реализацию Telegram-бота для получения информации о спектаклях.
 //
 // Этот файл реализует:
-// - Long polling для получения обновлений от Telegram API
-// - Обработку команд /start, /shows, /afisha, /help
+// - Long polling или webhook для получения обновлений от Telegram API
+// - Обработку команд /start, /shows, /afisha, /help, фильтров /weekend, /week, /on_sale подписок /subscribe, /unsubscribe, /maxprice, /email, сводки /digest, оповещений /watch, /unwatch, /alerts, настроек /settings и языка /lang в личных чатах и группах
 // - Отправку форматированных сообщений с информацией о спектаклях
+// - Постраничный вывод длинной афиши с кнопками листания
 //
 // Взаимодействует с:
-// - vakhtangov_formatter.go: использует FetchAllShows() для получения списка спектаклей и RenderShowsMarkdown() для форматирования
+// - vakhtangov_formatter.go: использует RenderShowsMarkdown() для форматирования
+// - afisha_cache.go: спектакли берутся из общего кеша, "Обновить" загружает их заново
+// - theaters.go: театры из providers.theaters в меню, сгруппированном по городам
+// - telegram_renderer.go: все сообщения размечаются через botRenderer (HTML)
+// - telegram_lang.go: язык интерфейса пользователя или чата, команда /lang; строки берутся из i18n.go
+// - telegram_filters.go: фильтр афиши, выбранный в чате, и кнопки фильтров
+// - telegram_navigation.go: меню спектаклей и подробная карточка спектакля
+// - telegram_pages.go: разбиение афиши на страницы и кнопки "◀️ 1/3 ▶️"
+// - telegram_commands.go: команды с суффиксом @имя_бота и права в группах
+// - telegram_subscriptions.go: подписки чатов, рассылку изменений ведет notifier.go
+// - telegram_digest.go: сводки по расписанию в чаты и канал, команда /digest
+// - telegram_alerts.go: оповещения о снижении цены, последних местах и возвратах
+// - telegram_inline.go: поиск спектаклей через "@имя_бота запрос" из любого чата
+// - telegram_settings.go: тихие часы, часовой пояс, режим сводкой и выключенные виды уведомлений
+// - telegram_outbox.go: очередь уведомлений, оповещений и сводок с повторами и ограничением частоты
+// - telegram_webhook.go: режим webhook, если он включен через BOT_MODE=webhook
+// - metrics.go: счетчик обновлений по командам и HTTP-эндпоинты метрик (METRICS_ADDR)
+// - telegram_middleware.go: авторизация, логирование, ограничение частоты и перехват паник для всех обработчиков
 package main
 
 import (
@@ -22,7 +40,6 @@ import (
 	"github.com/go-telegram/bot/models"
 )
 
-var allowedUsers = make(map[string]bool)
 var log = logger.Get().Named("bot")
 
 func RunTelegramBot(ctx context.Context) error {
@@ -34,68 +51,349 @@ func RunTelegramBot(ctx context.Context) error {
 	if token == "" {
 		return fmt.Errorf("TELEGRAM_BOT_TOKEN is not set")
 	}
-	log.Infof("token: %s", token)
+	logger.AddSecret(token)
 
-	users := os.Getenv("ALLOWED_USERS")
-	if users != "" {
-		for _, u := range strings.Split(users, ",") {
-			trimmed := strings.TrimSpace(strings.ToLower(u))
-			if trimmed != "" {
-				allowedUsers[trimmed] = true
-			}
-		}
+	log.Infow("Access list loaded",
+		"allowed_users", len(currentConfig().Bot.AllowedUsers),
+		"admin_chats", len(currentConfig().Bot.AdminChatIDs),
+	)
+
+	webhook, useWebhook, err := loadWebhookConfig()
+	if err != nil {
+		return err
+	}
+
+	// METRICS_ADDR включает /metrics, /healthz и /readyz; кеш обновляется в фоне,
+	// чтобы /readyz отражал возраст последней загрузки, а не последнего запроса к боту
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		shutdown.Go(ctx, func(ctx context.Context) {
+			runOpsServer(ctx, addr)
+		})
+		shutdown.Go(ctx, func(ctx context.Context) {
+			runCacheRefresher(ctx, cacheTTL())
+		})
 	}
 
 	opts := []bot.Option{
+		bot.WithMiddlewares(
+			drainMiddleware(shutdown),
+			recoverMiddleware,
+			loggingMiddleware,
+			metricsMiddleware,
+			languageMiddleware,
+			authMiddleware,
+			rateLimitMiddleware(newRefreshLimiter()),
+		),
 		bot.WithDefaultHandler(defaultHandler),
 		bot.WithCallbackQueryDataHandler("afisha", bot.MatchTypePrefix, callbackHandler),
 	}
+	if useWebhook && webhook.Secret != "" {
+		opts = append(opts, bot.WithWebhookSecretToken(webhook.Secret))
+	}
 
 	b, err := bot.New(token, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create bot: %w", err)
 	}
 	log.Info("bot created")
+
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get bot info: %w", err)
+	}
+	botUsername = me.Username
+
+	for _, preset := range filterPresets {
+		if preset.Name == "all" {
+			continue
+		}
+		registerCommand(b, preset.Name, filterCommandHandler(preset.Name))
+	}
+	registerCommand(b, "subscribe", subscribeHandler)
+	registerCommand(b, "unsubscribe", unsubscribeHandler)
+	registerCommand(b, "maxprice", maxPriceHandler)
+	registerCommand(b, "email", emailHandler)
+	registerCommand(b, "digest", digestCommandHandler)
+	registerCommand(b, "watch", watchHandler)
+	registerCommand(b, "unwatch", unwatchHandler)
+	registerCommand(b, "alerts", alertsHandler)
+	registerCommand(b, "settings", settingsCommandHandler)
+	registerCommand(b, "lang", langCommandHandler)
+	b.RegisterHandlerMatchFunc(isInlineQuery, inlineQueryHandler)
+
+	if err := cache.persistChanges(storagePath("changes.json")); err != nil {
+		return err
+	}
+	subscriptions, err = newSubscriptionStore(storagePath("subscriptions.json"))
+	if err != nil {
+		return err
+	}
+	digests, err = newDigestStore(storagePath("digests.json"))
+	if err != nil {
+		return err
+	}
+	alerts, err = newAlertStore(storagePath("alerts.json"))
+	if err != nil {
+		return err
+	}
+	outbox, err = newOutboxStore(storagePath("outbox.json"))
+	if err != nil {
+		return err
+	}
+	preferences, err = newPreferenceStore(storagePath("settings.json"))
+	if err != nil {
+		return err
+	}
+	languages, err = newLanguageStore(storagePath("languages.json"))
+	if err != nil {
+		return err
+	}
+	// Хранилища пишутся на диск при каждом изменении; при остановке они сохраняются еще раз,
+	// чтобы не потерять изменения, запись которых во время работы не удалась
+	for _, store := range []struct {
+		name  string
+		flush func() error
+	}{
+		{"outbox", outbox.flush},
+		{"alerts", alerts.flush},
+		{"settings", preferences.flush},
+		{"digests", digests.flush},
+		{"subscriptions", subscriptions.flush},
+		{"languages", languages.flush},
+		{"changes", cache.flushChanges},
+	} {
+		shutdown.OnShutdown("flush "+store.name, func(context.Context) error { return store.flush() })
+	}
+	shutdown.Go(ctx, func(ctx context.Context) {
+		outbox.run(ctx, b)
+	})
+	shutdown.Go(ctx, func(ctx context.Context) {
+		runChangeNotifier(ctx, b)
+	})
+	shutdown.Go(ctx, func(ctx context.Context) {
+		runDigestScheduler(ctx)
+	})
+	shutdown.Go(ctx, func(ctx context.Context) {
+		runAlertWatcher(ctx)
+	})
+	shutdown.Go(ctx, func(ctx context.Context) {
+		runHeldNotifier(ctx)
+	})
+
+	if useWebhook {
+		log.Info("Starting in webhook mode")
+		return runWebhook(ctx, b, webhook)
+	}
+
+	// Telegram не отдает обновления через getUpdates, пока зарегистрирован webhook
+	if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+		log.Warnf("Error deleting webhook before polling: %v", err)
+	}
+	log.Info("Starting in long polling mode")
 	b.Start(ctx)
 
 	return nil
 }
 
-func buildShowsMessage(ctx context.Context) string {
-	shows, err := FetchAllShows(ctx)
+var pageStore = newAfishaPageStore()
+
+// botRenderer задает режим разметки всех сообщений бота
+var botRenderer TelegramRenderer = HTMLRenderer{}
+
+// afishaTitles — ключи каталога с заголовками, с которых начинается каждая страница афиши
+var afishaTitles = map[string]string{
+	"afisha_theatre_vakhtangov": "afisha.title.vakhtangov",
+	"afisha_ballet":             "afisha.title.ballet",
+}
+
+// theaterAction is the callback data of a theater from providers.theaters
+func theaterAction(id string) string {
+	return "afisha_theater:" + id
+}
+
+// theaterForAction returns the configured theater an afisha action refers to
+func theaterForAction(action string) (TheaterConfig, bool) {
+	id, ok := strings.CutPrefix(action, "afisha_theater:")
+	if !ok {
+		return TheaterConfig{}, false
+	}
+	return findTheater(id)
+}
+
+// afishaHeader renders the page header, mentioning the active filter if any
+func afishaHeader(r TelegramRenderer, action string, filter filterPreset) string {
+	title := tr(r.Lang(), afishaTitles[action])
+	if t, ok := theaterForAction(action); ok {
+		title = tr(r.Lang(), "afisha.title.theater", t.Name)
+	}
+	header := r.Bold(title) + "\n"
+	if filter.Name != "" && filter.Name != "all" {
+		header += r.Italic(tr(r.Lang(), "afisha.filter", filterLabel(r.Lang(), filter))) + "\n"
+	}
+	return header + "\n"
+}
+
+// updatedFooter — строка со временем обновления в конце каждой страницы
+func updatedFooter(r TelegramRenderer, clock string) string {
+	return "\n\n" + r.Italic(tr(r.Lang(), "afisha.updated", clock))
+}
+
+func buildShowsPages(ctx context.Context, r TelegramRenderer, filter ShowFilter, maxAge time.Duration, limit int) ([]string, []afishaItem) {
+	shows, _, err := cache.Shows(ctx, maxAge)
 	if err != nil {
-		return "Ошибка загрузки афиши. Попробуйте позже."
+		logError(err)
+		return []string{r.Escape(tr(r.Lang(), "afisha.load_error"))}, nil
+	}
+	shows = filter.ApplyShows(shows)
+	if len(shows) == 0 {
+		return []string{r.Escape(tr(r.Lang(), "afisha.no_matches"))}, nil
 	}
-	markdown := RenderShowsMarkdown(shows)
-	// Ограничение Telegram ~4096 символов; если больше — обрезаем
-	if len(markdown) > 3800 {
-		return markdown[:3800] + "\n…"
+	pages := paginate(RenderShowsMarkdownBlocks(r, shows), showsSeparator, limit)
+	items := make([]afishaItem, 0, len(shows))
+	for _, sh := range shows {
+		items = append(items, afishaItem{title: sh.Title, detail: RenderShowDetailMarkdown(r, sh), show: &sh})
 	}
-	return markdown
+	return pages, items
 }
 
-func buildBaletMessage(ctx context.Context) string {
-	shows, err := RunBaletParser()
+func buildBaletPages(ctx context.Context, r TelegramRenderer, maxAge time.Duration, limit int) ([]string, []afishaItem) {
+	shows, _, err := cache.Ballet(ctx, maxAge)
 	if err != nil {
-		return "Ошибка загрузки афиши балета. Попробуйте позже."
+		logError(err)
+		return []string{r.Escape(tr(r.Lang(), "afisha.ballet_load_error"))}, nil
+	}
+	pages := paginate(RenderBaletShowsMarkdownBlocks(r, shows), showsSeparator, limit)
+	items := make([]afishaItem, 0, len(shows))
+	for _, sh := range shows {
+		items = append(items, afishaItem{title: sh.Title, detail: RenderBaletShowMarkdown(r, sh)})
 	}
-	markdown := RenderBaletShowsMarkdown(shows)
-	return markdown
+	return pages, items
 }
 
-func callbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if update.CallbackQuery == nil {
-		log.Warn("CallbackQuery is nil")
-		return
+// buildTheaterPages renders a theater from providers.theaters.
+// Карточки спектаклей собираются сразу: цен со страниц покупки у других театров нет.
+func buildTheaterPages(ctx context.Context, r TelegramRenderer, t TheaterConfig, maxAge time.Duration, limit int) ([]string, []afishaItem) {
+	shows, _, err := cache.Theater(ctx, t, maxAge)
+	if err != nil {
+		logError(err)
+		return []string{r.Escape(tr(r.Lang(), "afisha.load_error"))}, nil
+	}
+	if len(shows) == 0 {
+		return []string{r.Escape(tr(r.Lang(), "shows.not_found"))}, nil
+	}
+	pages := paginate(RenderShowsMarkdownBlocks(r, shows), showsSeparator, limit)
+	items := make([]afishaItem, 0, len(shows))
+	for _, sh := range shows {
+		items = append(items, afishaItem{title: sh.Title, detail: RenderShowDetailMarkdown(r, sh)})
 	}
+	return pages, items
+}
 
-	username := strings.ToLower(update.CallbackQuery.From.Username)
-	if len(allowedUsers) > 0 && !allowedUsers[username] {
-		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
-			CallbackQueryID: update.CallbackQuery.ID,
-			Text:            "⛔️ Доступ запрещен / Access denied",
-			ShowAlert:       true,
-		})
+// buildAfishaPages loads the afisha for action and splits it into pages
+// that still fit into one message together with the header and footer.
+// Фильтр чата применяется только к афише Вахтангова: у балета нет нормализованных дат.
+// Данные берутся из кеша не старше maxAge; maxAge = 0 загружает сайты заново.
+// Страницы собираются на языке обновления из ctx.
+func buildAfishaPages(ctx context.Context, chatID int64, action string, maxAge time.Duration) afishaPages {
+	r := rendererFor(ctx)
+	var filter filterPreset
+	if action == "afisha_theatre_vakhtangov" {
+		filter = chatFilters.get(chatID)
+	}
+	header := afishaHeader(r, action, filter)
+	limit := afishaPageLimit(r, header)
+
+	var pages []string
+	var items []afishaItem
+	switch action {
+	case "afisha_theatre_vakhtangov":
+		pages, items = buildShowsPages(ctx, r, filter.Build(time.Now()), maxAge, limit)
+	case "afisha_ballet":
+		pages, items = buildBaletPages(ctx, r, maxAge, limit)
+	default:
+		if t, ok := theaterForAction(action); ok {
+			pages, items = buildTheaterPages(ctx, r, t, maxAge, limit)
+		}
+	}
+	return afishaPages{header: header, filter: filter.Name, lang: r.Lang(), pages: pages, items: items, updatedAt: time.Now()}
+}
+
+// afishaPageLimit is the room left for afisha text after the header and footer
+func afishaPageLimit(r TelegramRenderer, header string) int {
+	return TELEGRAM_MESSAGE_LIMIT -
+		utf16Len(header) -
+		utf16Len(updatedFooter(r, "00:00:00"))
+}
+
+// loadAfishaPages returns the stored pages or builds them when they are missing,
+// e.g. after a bot restart, or were built in another language
+func loadAfishaPages(ctx context.Context, chatID int64, action string) afishaPages {
+	p, found := pageStore.get(chatID, action)
+	if !found || p.lang != langFrom(ctx) {
+		p = buildAfishaPages(ctx, chatID, action, cacheTTL())
+		pageStore.put(chatID, action, p)
+	}
+	return p
+}
+
+// renderAfishaPage assembles the message text and keyboard for one page
+func renderAfishaPage(action string, p afishaPages, page int) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(p.lang)
+	if page >= len(p.pages) {
+		page = len(p.pages) - 1
+	}
+
+	// Добавляем время обновления в конец сообщения, чтобы текст менялся
+	// Это предотвращает ошибку "message is not modified" если данные не изменились
+	// Используем фиксированную зону MSK (UTC+3), так как на сервере может быть UTC
+	mskZone := time.FixedZone("MSK", 3*60*60)
+	msg := p.header + p.pages[page] +
+		updatedFooter(r, p.updatedAt.In(mskZone).Format("15:04:05"))
+
+	var rows [][]models.InlineKeyboardButton
+	if nav := paginationKeyboard(action, page, len(p.pages)); nav != nil {
+		rows = append(rows, nav)
+	}
+	if action == "afisha_theatre_vakhtangov" {
+		rows = append(rows, filterKeyboard(r.Lang(), p.filter))
+	}
+	rows = append(rows,
+		[]models.InlineKeyboardButton{
+			{Text: tr(r.Lang(), "button.shows"), CallbackData: listCallbackData(action)},
+			{Text: tr(r.Lang(), "button.refresh"), CallbackData: action},
+		},
+		[]models.InlineKeyboardButton{
+			{Text: tr(r.Lang(), "button.back"), CallbackData: "afisha_update"},
+		},
+	)
+	return msg, &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// afishaMenuKeyboard lists the available afishas grouped by city, two buttons per row.
+// Строка с городом — заголовок группы, нажатие на нее ничего не делает.
+func afishaMenuKeyboard(lang string) *models.InlineKeyboardMarkup {
+	byCity := map[string][]models.InlineKeyboardButton{
+		"moscow": {{Text: tr(lang, "menu.vakhtangov"), CallbackData: "afisha_theatre_vakhtangov"}},
+		"spb":    {{Text: tr(lang, "menu.ballet"), CallbackData: "afisha_ballet"}},
+	}
+	for _, t := range currentConfig().Providers.Theaters {
+		byCity[t.City] = append(byCity[t.City], models.InlineKeyboardButton{Text: t.Name, CallbackData: theaterAction(t.ID)})
+	}
+
+	var rows [][]models.InlineKeyboardButton
+	for _, city := range theaterCities {
+		buttons := byCity[city]
+		rows = append(rows, []models.InlineKeyboardButton{{Text: tr(lang, "menu.city."+city), CallbackData: "afisha_noop"}})
+		for i := 0; i < len(buttons); i += 2 {
+			rows = append(rows, buttons[i:min(i+2, len(buttons))])
+		}
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func callbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery == nil {
+		logger.From(ctx).Warn("CallbackQuery is nil")
 		return
 	}
 
@@ -105,95 +403,133 @@ func callbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	})
 
 	var kb *models.InlineKeyboardMarkup
-	chatID := update.CallbackQuery.From.ID
-	isDisabled := true
+	// В группе сообщение с кнопками принадлежит группе, а не нажавшему пользователю
+	chatID := updateChatID(update)
+	data := update.CallbackQuery.Data
 
 	var msg string
-	var currentAction string
 
-	switch update.CallbackQuery.Data {
-	case "afisha_theatre_vakhtangov":
-		msg = "*Афиша театра Вахтангова:*\n\n" + buildShowsMessage(ctx)
-		currentAction = "afisha_theatre_vakhtangov"
-	case "afisha_ballet":
-		msg = "*Афиша балета:*\n\n" + buildBaletMessage(ctx)
-		currentAction = "afisha_ballet"
-	case "afisha_update":
-		// Если пришел общий update, показываем меню
-		msg = "Выберите афишу:"
-		// Клавиатура будет перезаписана ниже, если currentAction пустой
-	}
-
-	if currentAction != "" {
-		// Добавляем время обновления в конец сообщения, чтобы текст менялся
-		// Это предотвращает ошибку "message is not modified" если данные не изменились
-		// Используем фиксированную зону MSK (UTC+3), так как на сервере может быть UTC
-		mskZone := time.FixedZone("MSK", 3*60*60)
-		msg += fmt.Sprintf("\n\n_Обновлено: %s_", time.Now().In(mskZone).Format("15:04:05"))
-
-		kb = &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{
-					{Text: "🔄 Обновить", CallbackData: currentAction},
-				},
-				{
-					{Text: "⬅️ Назад", CallbackData: "afisha_update"},
-				},
-			},
+	switch {
+	case data == "afisha_noop":
+		// Кнопка с номером страницы и заголовок города в меню ничего не делают
+		return
+	case isRefreshAction(data):
+		p := buildAfishaPages(ctx, chatID, data, 0)
+		pageStore.put(chatID, data, p)
+		msg, kb = renderAfishaPage(data, p, 0)
+	case strings.HasPrefix(data, "afisha_filter:"):
+		preset, ok := findFilterPreset(strings.TrimPrefix(data, "afisha_filter:"))
+		if !ok {
+			logger.From(ctx).Warnf("Invalid filter callback: %s", data)
+			return
 		}
-	} else if update.CallbackQuery.Data == "afisha_update" {
-		kb = &models.InlineKeyboardMarkup{
-			InlineKeyboard: [][]models.InlineKeyboardButton{
-				{
-					{Text: "Театр Вахтангова", CallbackData: "afisha_theatre_vakhtangov"},
-					{Text: "Балет", CallbackData: "afisha_ballet"},
-				},
-			},
+		chatFilters.set(chatID, preset.Name)
+		p := buildAfishaPages(ctx, chatID, "afisha_theatre_vakhtangov", cacheTTL())
+		pageStore.put(chatID, "afisha_theatre_vakhtangov", p)
+		msg, kb = renderAfishaPage("afisha_theatre_vakhtangov", p, 0)
+	case strings.HasPrefix(data, "afisha_page:"):
+		action, page, ok := parsePageCallbackData(data)
+		if !ok || !isRefreshAction(action) {
+			logger.From(ctx).Warnf("Invalid page callback: %s", data)
+			return
+		}
+		msg, kb = renderAfishaPage(action, loadAfishaPages(ctx, chatID, action), page)
+	case strings.HasPrefix(data, "afisha_list:"):
+		action := strings.TrimPrefix(data, "afisha_list:")
+		if !isRefreshAction(action) {
+			logger.From(ctx).Warnf("Invalid list callback: %s", data)
+			return
+		}
+		msg, kb = renderShowList(action, loadAfishaPages(ctx, chatID, action))
+	case strings.HasPrefix(data, "afisha_show:"):
+		action, idx, ok := parseShowCallbackData(data)
+		if !ok || !isRefreshAction(action) {
+			logger.From(ctx).Warnf("Invalid show callback: %s", data)
+			return
+		}
+		msg, kb = renderShowDetail(ctx, action, loadAfishaPages(ctx, chatID, action), idx)
+	case strings.HasPrefix(data, "afisha_digest:"):
+		var ok bool
+		if msg, kb, ok = handleDigestCallback(ctx, b, update); !ok {
+			return
 		}
+	case strings.HasPrefix(data, "afisha_settings:"):
+		var ok bool
+		if msg, kb, ok = handleSettingsCallback(ctx, b, update); !ok {
+			return
+		}
+	case strings.HasPrefix(data, "afisha_lang:"):
+		var ok bool
+		if msg, kb, ok = handleLanguageCallback(ctx, b, update); !ok {
+			return
+		}
+	case data == "afisha_update":
+		// Если пришел общий update, показываем меню
+		msg = rendererFor(ctx).Escape(tr(langFrom(ctx), "menu.choose"))
+		kb = afishaMenuKeyboard(langFrom(ctx))
+	default:
+		logger.From(ctx).Warnf("Unknown callback: %s", data)
+		return
 	}
 
+	editOrSendMessage(ctx, b, chatID, update.CallbackQuery.Message.Message, msg, kb)
+}
+
+// sendText sends a plain text message
+func sendText(ctx context.Context, b *bot.Bot, chatID int64, text string) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text}); err != nil {
+		logger.From(ctx).Errorf("Error sending message: %v", err)
+	}
+}
+
+// splitPages splits blocks into as many message texts as needed, the header goes first
+func splitPages(header string, blocks []string) []string {
+	pages := paginate(blocks, showsSeparator, TELEGRAM_MESSAGE_LIMIT-utf16Len(header))
+	if len(pages) > 0 {
+		pages[0] = header + pages[0]
+	}
+	return pages
+}
+
+// editOrSendMessage edits the message in place, or sends a new one when editing is impossible
+func editOrSendMessage(ctx context.Context, b *bot.Bot, chatID int64, message *models.Message, msg string, kb *models.InlineKeyboardMarkup) {
+	isDisabled := true
+
 	// Редактируем сообщение вместо отправки нового
 	// Нужно получить MessageID из CallbackQuery
-	if update.CallbackQuery.Message.Message != nil {
+	if message != nil {
 		_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
 			ChatID:      chatID,
-			MessageID:   update.CallbackQuery.Message.Message.ID,
+			MessageID:   message.ID,
 			Text:        msg,
-			ParseMode:   models.ParseModeMarkdown,
+			ParseMode:   botRenderer.ParseMode(),
 			ReplyMarkup: kb,
 			LinkPreviewOptions: &models.LinkPreviewOptions{
 				IsDisabled: &isDisabled,
 			},
 		})
-		if err != nil {
-			log.Errorf("Error editing message: %v", err)
-			// Если не удалось отредактировать (например, сообщение слишком старое), отправляем новое
-			b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID:      chatID,
-				Text:        msg,
-				ParseMode:   models.ParseModeMarkdown,
-				ReplyMarkup: kb,
-				LinkPreviewOptions: &models.LinkPreviewOptions{
-					IsDisabled: &isDisabled,
-				},
-			})
+		if err == nil {
+			return
 		}
-	} else {
-		// Если сообщение недоступно, отправляем новое
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:      chatID,
-			Text:        msg,
-			ParseMode:   models.ParseModeMarkdown,
-			ReplyMarkup: kb,
-			LinkPreviewOptions: &models.LinkPreviewOptions{
-				IsDisabled: &isDisabled,
-			},
-		})
+		logger.From(ctx).Errorf("Error editing message: %v", err)
+		// Если не удалось отредактировать (например, сообщение слишком старое), отправляем новое
+	}
+
+	// Если сообщение недоступно, отправляем новое
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        msg,
+		ParseMode:   botRenderer.ParseMode(),
+		ReplyMarkup: kb,
+		LinkPreviewOptions: &models.LinkPreviewOptions{
+			IsDisabled: &isDisabled,
+		},
+	}); err != nil {
+		logger.From(ctx).Errorf("Error sending message: %v", err)
 	}
 }
 
 func defaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	log.Infof("Allowed users: %v", allowedUsers)
 	if update.Message == nil {
 		log.Warn("Message is nil")
 		return
@@ -202,32 +538,22 @@ func defaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.Message.From == nil {
 		return
 	}
-
-	username := strings.ToLower(update.Message.From.Username)
-	if len(allowedUsers) > 0 && !allowedUsers[username] {
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   "⛔️ Доступ запрещен. Бот работает только для авторизованных пользователей.",
-		})
+	// В группе отвечаем только на команды, адресованные боту, а не на каждое сообщение
+	if _, isCommand := parseCommand(update.Message); isGroupChat(update.Message.Chat) && !isCommand {
 		return
 	}
 
 	isDisabled := true
-	kb := &models.InlineKeyboardMarkup{
-		InlineKeyboard: [][]models.InlineKeyboardButton{
-			{
-				{Text: "Театр Вахтангова", CallbackData: "afisha_theatre_vakhtangov"},
-				{Text: "Балет", CallbackData: "afisha_ballet"},
-			},
-		},
-	}
+	kb := afishaMenuKeyboard(langFrom(ctx))
 
-	b.SendMessage(ctx, &bot.SendMessageParams{
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:      update.Message.Chat.ID,
-		Text:        "Посмотреть афишу в:",
+		Text:        tr(langFrom(ctx), "menu.start"),
 		ReplyMarkup: kb,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
 		},
-	})
+	}); err != nil {
+		logger.From(ctx).Errorf("Error sending message: %v", err)
+	}
 }
@@ -0,0 +1,623 @@
+// Package main содержит оповещения по отслеживаемым спектаклям: снижение цены, последние места и возвраты.
+//
+// Этот файл реализует:
+// - alertStore - отслеживаемые спектакли и пороги чатов, хранятся в storage.dir/alerts.json
+// - /watch <название> [цена=3000] [места=20] [возвраты=нет] - следить за спектаклем, /unwatch - перестать
+// - /alerts [цена=3000] [места=20] - пороги чата по умолчанию для всех отслеживаемых спектаклей
+// - runAlertWatcher() - проверка цен и мест отслеживаемых спектаклей и возвратов на проданные сеансы
+//
+// Пороги спектакля сильнее порогов чата: "цена=нет" выключает оповещение о цене только для этого спектакля.
+// Оповещение о сеансе приходит один раз; если цена снова выросла или места вернулись,
+// следующее снижение снова пришлет оповещение.
+//
+// Взаимодействует с:
+// - afisha_cache.go: спектакли и журнал изменений (возврат — билеты в продаже после sold_out)
+// - vakhtangov_tickets.go: цены и свободные места сеансов
+// - telegram_inline.go: searchShows() ищет спектакль по названию
+// - telegram_commands.go: в группе менять настройки может только администратор
+// - telegram_settings.go: в тихие часы оповещения откладываются до утра, в /settings их можно выключить
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Виды оповещений
+const (
+	alertPriceDrop = "price"   // самый дешевый билет не дороже порога
+	alertLastSeats = "seats"   // свободных мест меньше порога
+	alertReturns   = "returns" // на проданный сеанс снова появились билеты
+)
+
+// WATCH_SEARCH_LIMIT — сколько названий показать, если запросу /watch подходит несколько спектаклей
+const WATCH_SEARCH_LIMIT = 10
+
+// alertThresholds — пороги оповещений; 0 — не следить
+type alertThresholds struct {
+	MaxPrice int `json:"max_price,omitempty"` // оповестить, когда самый дешевый билет не дороже, ₽
+	MinSeats int `json:"min_seats,omitempty"` // оповестить, когда свободных мест меньше
+}
+
+// showWatch — отслеживаемый спектакль. Пороги 0 берутся из настроек чата, -1 — выключены.
+type showWatch struct {
+	Title     string `json:"title"`
+	MaxPrice  int    `json:"max_price,omitempty"`
+	MinSeats  int    `json:"min_seats,omitempty"`
+	NoReturns bool   `json:"no_returns,omitempty"`
+}
+
+// thresholds resolves the watch's thresholds against the chat defaults
+func (w showWatch) thresholds(defaults alertThresholds) alertThresholds {
+	resolve := func(own, def int) int {
+		switch {
+		case own < 0:
+			return 0
+		case own > 0:
+			return own
+		}
+		return def
+	}
+	return alertThresholds{
+		MaxPrice: resolve(w.MaxPrice, defaults.MaxPrice),
+		MinSeats: resolve(w.MinSeats, defaults.MinSeats),
+	}
+}
+
+// chatAlerts — настройки оповещений одного чата
+type chatAlerts struct {
+	ChatID   int64           `json:"chat_id"`
+	Defaults alertThresholds `json:"defaults"`
+	Watches  []showWatch     `json:"watches,omitempty"`
+	// Fired — отправленные оповещения "<вид>:<сеанс>" со временем начала сеанса; прошедшие сеансы удаляются
+	Fired map[string]time.Time `json:"fired,omitempty"`
+}
+
+type alertStore struct {
+	mu    sync.Mutex
+	path  string
+	chats map[int64]*chatAlerts
+}
+
+var alerts *alertStore
+
+// newAlertStore loads alert settings from path; a missing file means no watches
+func newAlertStore(path string) (*alertStore, error) {
+	var list []chatAlerts
+	if err := readJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	s := &alertStore{path: path, chats: make(map[int64]*chatAlerts, len(list))}
+	for i := range list {
+		s.chats[list[i].ChatID] = &list[i]
+	}
+	return s, nil
+}
+
+// get returns a copy of the chat's settings
+func (s *alertStore) get(chatID int64) chatAlerts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ca, ok := s.chats[chatID]; ok {
+		return ca.clone()
+	}
+	return chatAlerts{ChatID: chatID}
+}
+
+// update changes the chat's settings and saves the store; chats without settings are dropped
+func (s *alertStore) update(chatID int64, fn func(ca *chatAlerts)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ca, ok := s.chats[chatID]
+	if !ok {
+		ca = &chatAlerts{ChatID: chatID}
+	}
+	fn(ca)
+	if len(ca.Watches) == 0 && ca.Defaults == (alertThresholds{}) {
+		delete(s.chats, chatID)
+	} else {
+		s.chats[chatID] = ca
+	}
+	return s.saveLocked()
+}
+
+// migrate moves the chat's watches when a group is upgraded to a supergroup
+func (s *alertStore) migrate(oldID, newID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ca, ok := s.chats[oldID]
+	if !ok {
+		return nil
+	}
+	delete(s.chats, oldID)
+	ca.ChatID = newID
+	s.chats[newID] = ca
+	return s.saveLocked()
+}
+
+// remove drops the chat's watches, e.g. when the bot was removed from the chat
+func (s *alertStore) remove(chatID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; !ok {
+		return nil
+	}
+	delete(s.chats, chatID)
+	return s.saveLocked()
+}
+
+// flush writes the store to disk again, e.g. on shutdown
+func (s *alertStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk; s.mu must be held
+func (s *alertStore) saveLocked() error {
+	list := make([]chatAlerts, 0, len(s.chats))
+	for _, c := range s.chats {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ChatID < list[j].ChatID })
+	return writeJSONFile(s.path, list)
+}
+
+// all returns copies of every chat with watches
+func (s *alertStore) all() []chatAlerts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]chatAlerts, 0, len(s.chats))
+	for _, ca := range s.chats {
+		if len(ca.Watches) > 0 {
+			list = append(list, ca.clone())
+		}
+	}
+	return list
+}
+
+func (ca *chatAlerts) clone() chatAlerts {
+	out := *ca
+	out.Watches = append([]showWatch(nil), ca.Watches...)
+	out.Fired = make(map[string]time.Time, len(ca.Fired))
+	for k, v := range ca.Fired {
+		out.Fired[k] = v
+	}
+	return out
+}
+
+// runAlertWatcher checks watched shows every cache interval until ctx is done
+func runAlertWatcher(ctx context.Context) {
+	cursor := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cacheTTL()):
+		}
+
+		shows, _, err := cache.Shows(ctx, cacheTTL())
+		if err != nil {
+			logError(err)
+			continue
+		}
+		var returned map[string]bool
+		returned, cursor = returnedSessions(cursor)
+		upcoming := ShowFilter{From: startOfDay(mskWallClock(time.Now()))}.ApplyShows(shows)
+		for _, ca := range alerts.all() {
+			if !preferences.get(ca.ChatID).streamEnabled(streamAlerts) {
+				continue
+			}
+			checkChatAlerts(ctx, ca, upcoming, returned)
+		}
+	}
+}
+
+// returnedSessions finds sessions that went back on sale after being sold out since cursor,
+// and returns the new cursor
+func returnedSessions(cursor time.Time) (map[string]bool, time.Time) {
+	soldOut := make(map[string]bool)
+	for _, ch := range cache.Changes(time.Time{}) {
+		if ch.Event == ChangeSoldOut && !ch.At.After(cursor) {
+			soldOut[ch.StageUID+"/"+ch.DateTimeKey] = true
+		}
+	}
+	returned := make(map[string]bool)
+	for _, ch := range cache.Changes(cursor) {
+		if ch.At.After(cursor) {
+			cursor = ch.At
+		}
+		key := ch.StageUID + "/" + ch.DateTimeKey
+		switch ch.Event {
+		case ChangeSoldOut:
+			soldOut[key] = true
+		case ChangeOnSale:
+			if soldOut[key] {
+				returned[key] = true
+			}
+		}
+	}
+	return returned, cursor
+}
+
+// checkChatAlerts evaluates one chat's watches and queues the alerts that fired
+func checkChatAlerts(ctx context.Context, ca chatAlerts, shows []Show, returned map[string]bool) {
+	r := rendererForChat(ca.ChatID)
+	var blocks []string
+	fired := make(map[string]time.Time)
+	var rearmed []string
+	for _, w := range ca.Watches {
+		th := w.thresholds(ca.Defaults)
+		for _, sh := range shows {
+			if !titlesMatch(sh.Title, w.Title) {
+				continue
+			}
+			for _, inf := range sh.Info {
+				key := performanceKey(inf)
+				if returned[key] && !w.NoReturns {
+					blocks = append(blocks, renderAlert(r, alertReturns, sh.Title, inf, nil))
+				}
+				if !inf.CanBuy || (th.MaxPrice == 0 && th.MinSeats == 0) {
+					continue
+				}
+				t, ok := tickets.get(ctx, key, inf.BuyLink)
+				if !ok {
+					continue
+				}
+				checks := []struct {
+					kind   string
+					active bool // порог задан и значение известно
+					hit    bool
+				}{
+					{alertPriceDrop, th.MaxPrice > 0 && t.MinPrice > 0, t.MinPrice <= th.MaxPrice},
+					{alertLastSeats, th.MinSeats > 0 && t.Seats > 0, t.Seats < th.MinSeats},
+				}
+				for _, c := range checks {
+					id := c.kind + ":" + key
+					_, sent := ca.Fired[id]
+					switch {
+					case !c.active:
+					case c.hit && !sent:
+						blocks = append(blocks, renderAlert(r, c.kind, sh.Title, inf, &t))
+						fired[id] = mskTime(inf.Start)
+					case !c.hit && sent:
+						rearmed = append(rearmed, id)
+					}
+				}
+			}
+		}
+	}
+
+	if len(blocks) > 0 {
+		if err := deliverAlerts(ca.ChatID, r.Bold(tr(r.Lang(), "alerts.title"))+"\n\n", blocks); err != nil {
+			log.Errorw("Error queueing alerts", "chat_id", ca.ChatID, "error", err)
+			notificationDeliveries.WithLabelValues("telegram", "error").Inc()
+			return
+		}
+		notificationDeliveries.WithLabelValues("telegram", "ok").Inc()
+	}
+	if len(fired) == 0 && len(rearmed) == 0 {
+		return
+	}
+	err := alerts.update(ca.ChatID, func(c *chatAlerts) {
+		if c.Fired == nil {
+			c.Fired = make(map[string]time.Time)
+		}
+		for id, start := range fired {
+			c.Fired[id] = start
+		}
+		for _, id := range rearmed {
+			delete(c.Fired, id)
+		}
+		now := time.Now()
+		for id, start := range c.Fired {
+			if start.Before(now) {
+				delete(c.Fired, id)
+			}
+		}
+	})
+	if err != nil {
+		logError(err)
+	}
+}
+
+// renderAlert renders one alert block
+func renderAlert(r TelegramRenderer, kind, title string, inf ShowInfo, t *TicketInfo) string {
+	var b strings.Builder
+	switch kind {
+	case alertPriceDrop:
+		b.WriteString(r.Escape(tr(r.Lang(), "alerts.price_drop")) + "\n")
+	case alertLastSeats:
+		b.WriteString(r.Escape(tr(r.Lang(), "alerts.last_seats")) + "\n")
+	case alertReturns:
+		b.WriteString(r.Escape(tr(r.Lang(), "alerts.returns")) + "\n")
+	}
+	b.WriteString(r.Bold(title) + "\n")
+	b.WriteString(r.Escape(sessionWhenLang(r.Lang(), mskTime(inf.Start), inf.Stage)))
+	if t != nil {
+		if summary := ticketSummary(r.Lang(), *t); summary != "" {
+			b.WriteString("\n" + r.Escape("💰 "+summary))
+		}
+	}
+	if inf.BuyLink != "" {
+		b.WriteString("\n" + r.Link(tr(r.Lang(), "changes.buy"), inf.BuyLink))
+	}
+	return b.String()
+}
+
+// watchOptions — пороги из аргументов команды; nil — не указан
+type watchOptions struct {
+	maxPrice  *int
+	minSeats  *int
+	noReturns *bool
+}
+
+// parseWatchArgs splits "/watch" arguments into the title query and "ключ=значение" options.
+// Значение "нет" (или "off") выключает оповещение, для порогов это -1.
+func parseWatchArgs(lang, args string) (string, watchOptions, error) {
+	var query []string
+	var opts watchOptions
+	for _, field := range strings.Fields(args) {
+		key, value, isOption := strings.Cut(field, "=")
+		if !isOption {
+			query = append(query, field)
+			continue
+		}
+		value = strings.ToLower(value)
+		off := value == "нет" || value == "off"
+		switch strings.ToLower(key) {
+		case "цена", "price":
+			n := -1
+			if !off {
+				if n = parsePrice(value); n <= 0 {
+					return "", opts, errors.New(tr(lang, "alerts.bad_price", field))
+				}
+			}
+			opts.maxPrice = &n
+		case "места", "seats":
+			n := -1
+			if !off {
+				var err error
+				if n, err = strconv.Atoi(value); err != nil || n <= 0 {
+					return "", opts, errors.New(tr(lang, "alerts.bad_seats", field))
+				}
+			}
+			opts.minSeats = &n
+		case "возвраты", "returns":
+			noReturns := off
+			opts.noReturns = &noReturns
+		default:
+			return "", opts, errors.New(tr(lang, "error.unknown_param", key))
+		}
+	}
+	return strings.Join(query, " "), opts, nil
+}
+
+// findWatchedShow picks the show for a /watch query: an exact title, or the only match
+func findWatchedShow(shows []Show, query string) (string, []string) {
+	var titles []string
+	seen := make(map[string]bool)
+	for _, sh := range searchShows(shows, query) {
+		if titlesMatch(sh.Title, query) {
+			return sh.Title, nil
+		}
+		if !seen[sh.Title] {
+			seen[sh.Title] = true
+			titles = append(titles, sh.Title)
+		}
+	}
+	sort.Strings(titles)
+	if len(titles) == 1 {
+		return titles[0], nil
+	}
+	return "", titles
+}
+
+// describeThresholds renders thresholds as "цена до 3000 ₽, меньше 20 мест"
+func describeThresholds(lang string, th alertThresholds) string {
+	var parts []string
+	if th.MaxPrice > 0 {
+		parts = append(parts, tr(lang, "alerts.threshold_price", th.MaxPrice))
+	}
+	if th.MinSeats > 0 {
+		parts = append(parts, tr(lang, "alerts.threshold_seats", th.MinSeats, seatsWordLang(lang, th.MinSeats)))
+	}
+	if len(parts) == 0 {
+		return tr(lang, "alerts.returns_only")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderAlertSettings lists the chat's watches and thresholds
+func renderAlertSettings(lang string, ca chatAlerts) string {
+	var b strings.Builder
+	b.WriteString(tr(lang, "alerts.defaults"))
+	if ca.Defaults == (alertThresholds{}) {
+		b.WriteString(tr(lang, "alerts.defaults_none"))
+	} else {
+		b.WriteString(describeThresholds(lang, ca.Defaults))
+	}
+	b.WriteString(".\n\n")
+	if len(ca.Watches) == 0 {
+		b.WriteString(tr(lang, "alerts.no_watches") + "\n")
+	} else {
+		b.WriteString(tr(lang, "alerts.watches") + "\n")
+		for _, w := range ca.Watches {
+			line := "• " + w.Title + " — " + describeThresholds(lang, w.thresholds(ca.Defaults))
+			if w.NoReturns {
+				line += tr(lang, "alerts.no_returns")
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	b.WriteString("\n" + tr(lang, "alerts.help"))
+	return b.String()
+}
+
+func watchHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	query, opts, err := parseWatchArgs(lang, commandArgs(msg))
+	if err != nil {
+		sendText(ctx, b, chatID, tr(lang, "error.parse", err.Error(), tr(lang, "alerts.watch_example")))
+		return
+	}
+	if query == "" {
+		sendText(ctx, b, chatID, renderAlertSettings(lang, alerts.get(chatID)))
+		return
+	}
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, chatID, tr(lang, "alerts.watch_admin_only"))
+		return
+	}
+
+	shows, _, err := cache.Shows(ctx, cacheTTL())
+	if err != nil {
+		logError(err)
+		sendText(ctx, b, chatID, tr(lang, "afisha.load_error"))
+		return
+	}
+	title, candidates := findWatchedShow(shows, query)
+	if title == "" {
+		if len(candidates) == 0 {
+			sendText(ctx, b, chatID, tr(lang, "alerts.not_found", query))
+			return
+		}
+		if len(candidates) > WATCH_SEARCH_LIMIT {
+			candidates = candidates[:WATCH_SEARCH_LIMIT]
+		}
+		sendText(ctx, b, chatID, tr(lang, "alerts.ambiguous")+"\n• "+strings.Join(candidates, "\n• "))
+		return
+	}
+
+	var watch showWatch
+	err = alerts.update(chatID, func(ca *chatAlerts) {
+		idx := -1
+		for i, w := range ca.Watches {
+			if titlesMatch(w.Title, title) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			ca.Watches = append(ca.Watches, showWatch{Title: title})
+			idx = len(ca.Watches) - 1
+		}
+		w := &ca.Watches[idx]
+		if opts.maxPrice != nil {
+			w.MaxPrice = *opts.maxPrice
+		}
+		if opts.minSeats != nil {
+			w.MinSeats = *opts.minSeats
+		}
+		if opts.noReturns != nil {
+			w.NoReturns = *opts.noReturns
+		}
+		watch = *w
+	})
+	if err != nil {
+		logError(err)
+		sendText(ctx, b, chatID, tr(lang, "error.save"))
+		return
+	}
+	text := tr(lang, "alerts.watching", title, describeThresholds(lang, watch.thresholds(alerts.get(chatID).Defaults)))
+	if !watch.NoReturns {
+		text += tr(lang, "alerts.with_returns")
+	}
+	sendText(ctx, b, chatID, text+".")
+}
+
+func unwatchHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	query := normalizeTitle(commandArgs(msg))
+	if query == "" {
+		sendText(ctx, b, chatID, tr(lang, "alerts.unwatch_usage"))
+		return
+	}
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, chatID, tr(lang, "alerts.watch_admin_only"))
+		return
+	}
+
+	var removed []string
+	err := alerts.update(chatID, func(ca *chatAlerts) {
+		kept := ca.Watches[:0]
+		for _, w := range ca.Watches {
+			if strings.Contains(normalizeTitle(w.Title), query) {
+				removed = append(removed, w.Title)
+				continue
+			}
+			kept = append(kept, w)
+		}
+		ca.Watches = kept
+	})
+	switch {
+	case err != nil:
+		logError(err)
+		sendText(ctx, b, chatID, tr(lang, "error.save"))
+	case len(removed) == 0:
+		sendText(ctx, b, chatID, tr(lang, "alerts.not_watched"))
+	default:
+		sendText(ctx, b, chatID, tr(lang, "alerts.unwatched", strings.Join(removed, ", ")))
+	}
+}
+
+// alertsHandler shows the settings or changes the chat defaults: "/alerts цена=3000 места=20"
+func alertsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	query, opts, err := parseWatchArgs(lang, commandArgs(msg))
+	if err == nil && (query != "" || opts.noReturns != nil) {
+		err = errors.New(tr(lang, "alerts.defaults_only"))
+	}
+	if err != nil {
+		sendText(ctx, b, chatID, tr(lang, "error.parse", err.Error(), tr(lang, "alerts.alerts_example")))
+		return
+	}
+	if opts.maxPrice != nil || opts.minSeats != nil {
+		if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+			sendText(ctx, b, chatID, tr(lang, "alerts.defaults_admin_only"))
+			return
+		}
+		err := alerts.update(chatID, func(ca *chatAlerts) {
+			if opts.maxPrice != nil {
+				ca.Defaults.MaxPrice = max(*opts.maxPrice, 0)
+			}
+			if opts.minSeats != nil {
+				ca.Defaults.MinSeats = max(*opts.minSeats, 0)
+			}
+		})
+		if err != nil {
+			logError(err)
+			sendText(ctx, b, chatID, tr(lang, "error.save"))
+			return
+		}
+	}
+	sendText(ctx, b, chatID, renderAlertSettings(lang, alerts.get(chatID)))
+}
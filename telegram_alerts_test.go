@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShowWatchThresholds(t *testing.T) {
+	defaults := alertThresholds{MaxPrice: 3000, MinSeats: 20}
+	tests := []struct {
+		name  string
+		watch showWatch
+		want  alertThresholds
+	}{
+		{"chat defaults", showWatch{}, alertThresholds{MaxPrice: 3000, MinSeats: 20}},
+		{"own price", showWatch{MaxPrice: 1500}, alertThresholds{MaxPrice: 1500, MinSeats: 20}},
+		{"own seats", showWatch{MinSeats: 5}, alertThresholds{MaxPrice: 3000, MinSeats: 5}},
+		{"price off", showWatch{MaxPrice: -1}, alertThresholds{MinSeats: 20}},
+		{"both off", showWatch{MaxPrice: -1, MinSeats: -1}, alertThresholds{}},
+		{"off and own", showWatch{MaxPrice: -1, MinSeats: 10}, alertThresholds{MinSeats: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.watch.thresholds(defaults); got != tt.want {
+				t.Errorf("thresholds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if got := (showWatch{MaxPrice: 1500}).thresholds(alertThresholds{}); got != (alertThresholds{MaxPrice: 1500}) {
+		t.Errorf("without chat defaults = %+v", got)
+	}
+}
+
+func TestReturnedSessions(t *testing.T) {
+	cursor := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	change := func(minutes int, event, stage, dt string) PerformanceChange {
+		return PerformanceChange{At: cursor.Add(time.Duration(minutes) * time.Minute), Event: event, StageUID: stage, DateTimeKey: dt}
+	}
+	prev := cache
+	cache = &afishaCache{changes: []PerformanceChange{
+		change(-60, ChangeSoldOut, "main", "a"), // продан до курсора, вернулся после
+		change(-30, ChangeSoldOut, "main", "b"), // продан до курсора, но снова не продавался
+		change(-20, ChangeSoldOut, "main", "c"), // вернулся еще до курсора — уже оповещали
+		change(-10, ChangeOnSale, "main", "c"),
+		change(5, ChangeOnSale, "main", "a"),
+		change(10, ChangeSoldOut, "small", "d"), // продан и вернулся после курсора
+		change(15, ChangeOnSale, "small", "d"),
+		change(20, ChangeOnSale, "small", "e"), // просто начало продаж
+		change(25, ChangeAdded, "small", "f"),
+	}}
+	t.Cleanup(func() { cache = prev })
+
+	returned, next := returnedSessions(cursor)
+	want := map[string]bool{"main/a": true, "small/d": true}
+	if len(returned) != len(want) {
+		t.Errorf("returned = %v, want %v", returned, want)
+	}
+	for key := range want {
+		if !returned[key] {
+			t.Errorf("%s is not returned: %v", key, returned)
+		}
+	}
+	if !next.Equal(cursor.Add(25 * time.Minute)) {
+		t.Errorf("cursor = %v", next)
+	}
+
+	// Со сдвинутым курсором те же изменения больше не считаются
+	if returned, again := returnedSessions(next); len(returned) != 0 || !again.Equal(next) {
+		t.Errorf("second pass: %v, cursor %v", returned, again)
+	}
+}
+
+// withTicketInfo replaces the ticket cache with fresh information for the given sessions
+func withTicketInfo(t *testing.T, infos map[string]TicketInfo) {
+	t.Helper()
+	prev := tickets
+	tickets = newTicketStore()
+	for key, info := range infos {
+		tickets.entries[key] = ticketEntry{info: info, ok: true, at: time.Now()}
+	}
+	t.Cleanup(func() { tickets = prev })
+}
+
+func TestCheckChatAlertsFiresOnce(t *testing.T) {
+	withChatStores(t)
+	const chatID = 7
+	start := time.Now().AddDate(0, 1, 0).Truncate(time.Hour).UTC()
+	inf := ShowInfo{Start: start, Stage: "Основная сцена", StageUID: "main", DateTimeKey: start.Format("2006-01-02-15-04-05"), CanBuy: true, BuyLink: "https://vakhtangov.ru/tickets/buy/"}
+	key := performanceKey(inf)
+	shows := []Show{{Title: "Чайка", Info: []ShowInfo{inf}}, {Title: "Ревизор", Info: []ShowInfo{inf}}}
+	err := alerts.update(chatID, func(ca *chatAlerts) {
+		ca.Defaults = alertThresholds{MaxPrice: 2000}
+		ca.Watches = []showWatch{{Title: "Чайка", MinSeats: 20}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		info     TicketInfo
+		returned bool
+		want     string // оповещения в новом сообщении; пусто — сообщения нет
+		fired    string
+	}{
+		{"price and seats hit", TicketInfo{MinPrice: 1500, Seats: 10}, false, "price seats", "price seats"},
+		{"still hit: nothing new", TicketInfo{MinPrice: 1500, Seats: 10}, false, "", "price seats"},
+		{"price up re-arms", TicketInfo{MinPrice: 2500, Seats: 10}, false, "", "seats"},
+		{"price down again", TicketInfo{MinPrice: 1800, Seats: 10}, false, "price", "price seats"},
+		{"seats back re-arm", TicketInfo{MinPrice: 1800, Seats: 50}, false, "", "price"},
+		{"unknown seats keep state", TicketInfo{MinPrice: 1800}, false, "", "price"},
+		{"returned session", TicketInfo{MinPrice: 1800, Seats: 50}, true, "returns", "price"},
+	}
+	for _, step := range steps {
+		withTicketInfo(t, map[string]TicketInfo{key: step.info})
+		before := len(queuedTexts())
+		checkChatAlerts(context.Background(), alerts.get(chatID), shows, map[string]bool{key: step.returned})
+
+		var got []string
+		if texts := queuedTexts(); len(texts) > before {
+			text := strings.Join(texts[before:], "\n")
+			for kind, marker := range map[string]string{alertPriceDrop: "Цена снизилась", alertLastSeats: "Последние места", alertReturns: "Появились билеты"} {
+				if strings.Contains(text, marker) {
+					got = append(got, kind)
+				}
+			}
+			if strings.Contains(text, "Ревизор") {
+				t.Errorf("%s: alert for an unwatched show:\n%s", step.name, text)
+			}
+		}
+		if got, want := sortedJoin(got), step.want; got != want {
+			t.Errorf("%s: alerts = %q, want %q", step.name, got, want)
+		}
+
+		var fired []string
+		for id := range alerts.get(chatID).Fired {
+			kind, session, _ := strings.Cut(id, ":")
+			if session != key {
+				t.Errorf("%s: fired for %q", step.name, session)
+			}
+			fired = append(fired, kind)
+		}
+		if got := sortedJoin(fired); got != step.fired {
+			t.Errorf("%s: fired = %q, want %q", step.name, got, step.fired)
+		}
+	}
+}
+
+func TestCheckChatAlertsSkipsDisabled(t *testing.T) {
+	withChatStores(t)
+	const chatID = 8
+	start := time.Now().AddDate(0, 1, 0).Truncate(time.Hour).UTC()
+	inf := ShowInfo{Start: start, StageUID: "main", DateTimeKey: start.Format("2006-01-02-15-04-05"), CanBuy: true}
+	key := performanceKey(inf)
+	withTicketInfo(t, map[string]TicketInfo{key: {MinPrice: 1000, Seats: 3}})
+	err := alerts.update(chatID, func(ca *chatAlerts) {
+		ca.Defaults = alertThresholds{MaxPrice: 2000, MinSeats: 20}
+		ca.Watches = []showWatch{{Title: "Чайка", MaxPrice: -1, MinSeats: -1, NoReturns: true}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChatAlerts(context.Background(), alerts.get(chatID), []Show{{Title: "Чайка", Info: []ShowInfo{inf}}}, map[string]bool{key: true})
+	if texts := queuedTexts(); len(texts) != 0 {
+		t.Errorf("queued %q for a watch with every alert off", texts)
+	}
+}
+
+// sortedJoin joins alert kinds in a fixed order
+func sortedJoin(kinds []string) string {
+	var out []string
+	for _, kind := range []string{alertPriceDrop, alertLastSeats, alertReturns} {
+		for _, k := range kinds {
+			if k == kind {
+				out = append(out, kind)
+				break
+			}
+		}
+	}
+	return strings.Join(out, " ")
+}
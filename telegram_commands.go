@@ -0,0 +1,80 @@
+// Package main содержит разбор команд бота в личных чатах, группах и каналах.
+//
+// Этот файл реализует:
+// - parseCommand() - имя команды из "/cmd", "/cmd args" и "/cmd@имя_бота", commandArgs() - аргументы
+// - registerCommand() - обработчик команды, который понимает суффикс @имя_бота
+// - isGroupChat() и isChatAdmin() - проверки для групповых чатов
+//
+// В группе Telegram добавляет к командам имя бота (/weekend@ShowsBot), если в чате
+// несколько ботов. Команды, адресованные другому боту, игнорируются.
+//
+// Взаимодействует с:
+// - telegram.go: RunTelegramBot() узнает имя бота через getMe и регистрирует команды
+// - telegram_middleware.go: authMiddleware() не отвечает в группах на посторонние сообщения
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// botUsername — имя бота без "@", заполняется после getMe при запуске
+var botUsername string
+
+// parseCommand returns the lowercased command name of a message.
+// ok is false for plain text and for commands addressed to another bot.
+func parseCommand(msg *models.Message) (string, bool) {
+	if msg == nil || !strings.HasPrefix(msg.Text, "/") {
+		return "", false
+	}
+	cmd := strings.Fields(msg.Text)[0][1:]
+	name, target, addressed := strings.Cut(cmd, "@")
+	if addressed && !strings.EqualFold(target, botUsername) {
+		return "", false
+	}
+	if name == "" {
+		return "", false
+	}
+	return strings.ToLower(name), true
+}
+
+// commandArgs returns the text after the command word
+func commandArgs(msg *models.Message) string {
+	return strings.TrimSpace(strings.TrimPrefix(msg.Text, strings.Fields(msg.Text)[0]))
+}
+
+// commandMatch matches messages with the given command, with or without @botname
+func commandMatch(name string) bot.MatchFunc {
+	return func(update *models.Update) bool {
+		cmd, ok := parseCommand(update.Message)
+		return ok && cmd == name
+	}
+}
+
+// registerCommand routes "/name" and "/name@botname" to h
+func registerCommand(b *bot.Bot, name string, h bot.HandlerFunc) {
+	addMetricCommand(name)
+	b.RegisterHandlerMatchFunc(commandMatch(name), h)
+}
+
+// isGroupChat reports whether the chat is a group or a supergroup
+func isGroupChat(chat models.Chat) bool {
+	return chat.Type == models.ChatTypeGroup || chat.Type == models.ChatTypeSupergroup
+}
+
+// isChatAdmin reports whether the user may change chat-wide settings:
+// in private chats always, in groups only administrators and the owner
+func isChatAdmin(ctx context.Context, b *bot.Bot, chat models.Chat, userID int64) bool {
+	if !isGroupChat(chat) {
+		return true
+	}
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chat.ID, UserID: userID})
+	if err != nil {
+		log.Errorf("Error getting chat member: %v", err)
+		return false
+	}
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator
+}
@@ -0,0 +1,402 @@
+// Package main содержит сводки афиши по расписанию для чатов и канала.
+//
+// Этот файл реализует:
+// - digestBlocks() - сводка: билеты в продаже на 7 дней, по понедельникам еще новые даты за неделю
+// - digestStore - расписания чатов в формате cron, хранятся в storage.dir/digests.json
+// - runDigestScheduler() - планировщик: раз в минуту проверяет расписания чатов и канала
+// - /digest - настройка сводки в чате: кнопки с готовым временем или "/digest 0 9 * * 1-5", не чаще раза в час
+//
+// Расписания задаются в московском времени (MSK, UTC+3), как и время в афише.
+// Канал из notifications.channel получает сводку в notifications.digest_time;
+// бот должен быть администратором канала с правом публикации.
+//
+// Взаимодействует с:
+// - afisha_cache.go: спектакли и журнал изменений берутся из общего кеша
+// - filters.go: weekFilter() отбирает сеансы на неделю вперед
+// - telegram.go: callbackHandler() передает сюда нажатия "afisha_digest:<действие>"
+// - telegram_outbox.go: сводка уходит через очередь исходящих сообщений
+// - telegram_settings.go: сводку можно приостановить в /settings, не теряя расписания
+// - telegram_lang.go: сводка приходит на языке чата, канал получает ее по-русски
+// - telegram_commands.go: в группе настраивать сводку может только администратор
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/robfig/cron/v3"
+)
+
+// DIGEST_CHECK_INTERVAL — как часто планировщик проверяет, не пора ли отправлять сводки
+const DIGEST_CHECK_INTERVAL = time.Minute
+
+// DIGEST_MIN_INTERVAL — минимальный промежуток между сводками по расписанию чата
+const DIGEST_MIN_INTERVAL = time.Hour
+
+// DIGEST_CRON_SAMPLES — сколько срабатываний проверяется на минимальный промежуток
+const DIGEST_CRON_SAMPLES = 48
+
+// digestPresets — время сводки на кнопках /digest
+var digestPresets = []string{"08:00", "10:00", "19:00"}
+
+// chatDigest — расписание сводки одного чата
+type chatDigest struct {
+	ChatID int64  `json:"chat_id"`
+	Cron   string `json:"cron"` // пять полей cron в МСК, например "0 10 * * *"
+}
+
+// digestBlocks renders tickets on sale for the next seven days and,
+// on Mondays, the dates announced during the past week
+func digestBlocks(ctx context.Context, r TelegramRenderer, now time.Time) (string, []string, error) {
+	lang := r.Lang()
+	header := r.Bold(tr(lang, "digest.title")) + "\n\n"
+	shows, _, err := cache.Shows(ctx, cacheTTL())
+	if err != nil {
+		return "", nil, err
+	}
+
+	filter := weekFilter(now)
+	filter.OnlyOnSale = true
+	blocks := digestSection(r, tr(lang, "digest.on_sale"),
+		RenderShowsMarkdownBlocks(r, filter.ApplyShows(shows)),
+		tr(lang, "digest.on_sale_empty"))
+
+	if mskWallClock(now).Weekday() == time.Monday {
+		blocks = append(blocks, digestSection(r, tr(lang, "digest.added"),
+			renderChanges(r, addedSince(now.AddDate(0, 0, -7))),
+			tr(lang, "digest.added_empty"))...)
+	}
+	return header, blocks, nil
+}
+
+// digestSection prefixes the first block with a section title, or returns the empty text
+func digestSection(r TelegramRenderer, title string, blocks []string, empty string) []string {
+	if len(blocks) == 0 {
+		return []string{r.Bold(title) + "\n" + r.Escape(empty)}
+	}
+	blocks[0] = r.Bold(title) + "\n\n" + blocks[0]
+	return blocks
+}
+
+// addedSince returns performances announced after since, each once, ordered by start
+func addedSince(since time.Time) []PerformanceChange {
+	seen := make(map[string]bool)
+	var out []PerformanceChange
+	for _, ch := range cache.Changes(since) {
+		key := ch.StageUID + "/" + ch.DateTimeKey
+		if ch.Event != ChangeAdded || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+type digestStore struct {
+	mu    sync.Mutex
+	path  string
+	chats map[int64]chatDigest
+}
+
+var digests *digestStore
+
+// newDigestStore loads chat schedules from path; a missing file means no schedules
+func newDigestStore(path string) (*digestStore, error) {
+	var list []chatDigest
+	if err := readJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	s := &digestStore{path: path, chats: make(map[int64]chatDigest, len(list))}
+	for _, d := range list {
+		if _, err := parseDigestCron(d.Cron); err != nil {
+			log.Warnw("Skipping invalid digest schedule", "chat_id", d.ChatID, "cron", d.Cron, "error", err)
+			continue
+		}
+		s.chats[d.ChatID] = d
+	}
+	return s, nil
+}
+
+func (s *digestStore) get(chatID int64) (chatDigest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.chats[chatID]
+	return d, ok
+}
+
+// set saves the chat's schedule; an empty spec turns the digest off
+func (s *digestStore) set(chatID int64, spec string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if spec == "" {
+		delete(s.chats, chatID)
+	} else {
+		s.chats[chatID] = chatDigest{ChatID: chatID, Cron: spec}
+	}
+	return s.saveLocked()
+}
+
+// migrate moves the chat's schedule when a group is upgraded to a supergroup
+func (s *digestStore) migrate(oldID, newID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.chats[oldID]
+	if !ok {
+		return nil
+	}
+	delete(s.chats, oldID)
+	d.ChatID = newID
+	s.chats[newID] = d
+	return s.saveLocked()
+}
+
+// remove drops the chat's schedule, e.g. when the bot was removed from the chat
+func (s *digestStore) remove(chatID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; !ok {
+		return nil
+	}
+	delete(s.chats, chatID)
+	return s.saveLocked()
+}
+
+// flush writes the store to disk again, e.g. on shutdown
+func (s *digestStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk; s.mu must be held
+func (s *digestStore) saveLocked() error {
+	list := make([]chatDigest, 0, len(s.chats))
+	for _, d := range s.chats {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ChatID < list[j].ChatID })
+	return writeJSONFile(s.path, list)
+}
+
+func (s *digestStore) all() []chatDigest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]chatDigest, 0, len(s.chats))
+	for _, d := range s.chats {
+		list = append(list, d)
+	}
+	return list
+}
+
+// parseDigestCron parses a standard five-field cron expression firing at most once per DIGEST_MIN_INTERVAL
+func parseDigestCron(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every") {
+		return nil, fmt.Errorf("@every is not supported, use five cron fields")
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Частоту проверяем по первым срабатываниям от фиксированной даты, чтобы результат не зависел от часов
+	prev := schedule.Next(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	for i := 0; i < DIGEST_CRON_SAMPLES && !prev.IsZero(); i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(prev) < DIGEST_MIN_INTERVAL {
+			return nil, fmt.Errorf("the digest can come at most once an hour")
+		}
+		prev = next
+	}
+	return schedule, nil
+}
+
+// dailyCron converts "HH:MM" into a cron expression firing every day at that time
+func dailyCron(clock string) string {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour())
+}
+
+// digestTarget — получатель сводки в планировщике: чат или канал
+type digestTarget struct {
+	chatID any
+	spec   string
+}
+
+// runDigestScheduler sends digests to chats and the channel on their schedules until ctx is done.
+// Расписания перечитываются на каждом шаге, поэтому /digest и перезагрузка конфига
+// применяются без перезапуска. Пропущенные из-за простоя сводки не досылаются.
+func runDigestScheduler(ctx context.Context) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	ticker := time.NewTicker(DIGEST_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	// lastCheck — момент прошлой проверки: сводка уходит, если ее время попало в промежуток после него
+	lastCheck := time.Now().In(msk)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().In(msk)
+
+		var targets []digestTarget
+		for _, d := range digests.all() {
+			if !preferences.get(d.ChatID).streamEnabled(streamDigest) {
+				continue
+			}
+			targets = append(targets, digestTarget{chatID: d.ChatID, spec: d.Cron})
+		}
+		if cfg := currentConfig().Notifications; cfg.Channel != "" {
+			targets = append(targets, digestTarget{chatID: channelChatID(cfg.Channel), spec: dailyCron(cfg.DigestTime)})
+		}
+
+		for _, t := range targets {
+			schedule, err := parseDigestCron(t.spec)
+			if err != nil || schedule.Next(lastCheck).After(now) {
+				continue
+			}
+			sendDigest(ctx, t.chatID, now)
+		}
+		lastCheck = now
+	}
+}
+
+// sendDigest builds one digest and queues it for delivery
+func sendDigest(ctx context.Context, chatID any, now time.Time) {
+	kind := "telegram"
+	if _, isChannel := chatID.(string); isChannel {
+		kind = "telegram_channel"
+	}
+	header, blocks, err := digestBlocks(ctx, rendererForChat(chatID), now)
+	if err != nil {
+		logError(err)
+		notificationDeliveries.WithLabelValues(kind, "error").Inc()
+		return
+	}
+	if err := outbox.enqueue(chatID, header, blocks, nil); err != nil {
+		log.Errorw("Error queueing digest", "chat_id", chatID, "error", err)
+		notificationDeliveries.WithLabelValues(kind, "error").Inc()
+		return
+	}
+	log.Infow("Digest queued", "chat_id", chatID)
+	notificationDeliveries.WithLabelValues(kind, "ok").Inc()
+}
+
+// channelChatID converts the configured channel to a chat ID accepted by the Bot API
+func channelChatID(channel string) any {
+	if id, err := strconv.ParseInt(channel, 10, 64); err == nil {
+		return id
+	}
+	return channel
+}
+
+// describeDigest explains the chat's current schedule
+func describeDigest(lang string, chatID int64) string {
+	d, ok := digests.get(chatID)
+	if !ok {
+		return tr(lang, "digest.off")
+	}
+	for _, clock := range digestPresets {
+		if d.Cron == dailyCron(clock) {
+			return tr(lang, "digest.daily", clock)
+		}
+	}
+	return tr(lang, "digest.cron", d.Cron)
+}
+
+// renderDigestSettings builds the /digest message and its buttons
+func renderDigestSettings(lang string, chatID int64) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(lang)
+	msg := r.Bold(tr(lang, "digest.settings_title")) + "\n\n" +
+		r.Escape(describeDigest(lang, chatID)+"\n\n"+tr(lang, "digest.help"))
+
+	row := make([]models.InlineKeyboardButton, 0, len(digestPresets))
+	current, _ := digests.get(chatID)
+	for _, clock := range digestPresets {
+		text := clock
+		if current.Cron == dailyCron(clock) {
+			text = "• " + text
+		}
+		row = append(row, models.InlineKeyboardButton{Text: text, CallbackData: "afisha_digest:" + clock})
+	}
+	return msg, &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		row,
+		{{Text: tr(lang, "digest.button_off"), CallbackData: "afisha_digest:off"}},
+	}}
+}
+
+// digestCommandHandler shows the settings or sets a custom cron: "/digest 0 9 * * 1-5", "/digest off"
+func digestCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	args := commandArgs(msg)
+	if args != "" {
+		if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+			sendText(ctx, b, chatID, tr(lang, "digest.admin_only"))
+			return
+		}
+		spec := args
+		if spec == "off" {
+			spec = ""
+		} else if _, err := parseDigestCron(spec); err != nil {
+			sendText(ctx, b, chatID, tr(lang, "digest.bad_cron", err.Error()))
+			return
+		}
+		if err := digests.set(chatID, spec); err != nil {
+			logError(err)
+			sendText(ctx, b, chatID, tr(lang, "error.save"))
+			return
+		}
+	}
+	text, kb := renderDigestSettings(lang, chatID)
+	editOrSendMessage(ctx, b, chatID, nil, text, kb)
+}
+
+// handleDigestCallback applies a "afisha_digest:<HH:MM|off>" button and re-renders the settings
+func handleDigestCallback(ctx context.Context, b *bot.Bot, update *models.Update) (string, *models.InlineKeyboardMarkup, bool) {
+	chatID := updateChatID(update)
+	message := update.CallbackQuery.Message.Message
+	if message != nil && !isChatAdmin(ctx, b, message.Chat, update.CallbackQuery.From.ID) {
+		return "", nil, false
+	}
+	choice := strings.TrimPrefix(update.CallbackQuery.Data, "afisha_digest:")
+	spec := ""
+	if choice != "off" {
+		spec = dailyCron(choice)
+		if spec == "" {
+			return "", nil, false
+		}
+	}
+	if err := digests.set(chatID, spec); err != nil {
+		logError(err)
+		return "", nil, false
+	}
+	text, kb := renderDigestSettings(langFrom(ctx), chatID)
+	return text, kb, true
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestParseDigestCron(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"0 9 * * *", true},
+		{"0 9 * * 1-5", true},
+		{"30 8,20 * * *", true},
+		{"0 * * * *", true},
+		{"@daily", true},
+		{dailyCron("07:30"), true},
+		{"@every 1s", false},
+		{"@every 2h", false},
+		{"* * * * *", false},
+		{"*/5 * * * *", false},
+		{"0,30 9 * * *", false},
+		{"@hourly", true},
+		{"0 9 * *", false},
+	}
+	for _, tt := range tests {
+		_, err := parseDigestCron(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseDigestCron(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package main содержит фильтры афиши в Telegram-боте.
+//
+// Этот файл реализует:
+// - chatFilterStore - фильтр, выбранный в каждом чате
+// - filterKeyboard() - ряд кнопок "Все | Выходные | Неделя | В продаже" под афишей Вахтангова
+// - filterCommandHandler() - команды /weekend, /week, /on_sale
+//
+// Взаимодействует с:
+// - filters.go: использует готовые фильтры filterPresets
+// - telegram.go: buildAfishaPages() применяет фильтр чата, callbackHandler() обрабатывает "afisha_filter:<name>"
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// chatFilterStore хранит имя выбранного фильтра для каждого чата
+type chatFilterStore struct {
+	mu      sync.Mutex
+	filters map[int64]string
+}
+
+var chatFilters = &chatFilterStore{filters: make(map[int64]string)}
+
+// get returns the chat's filter preset, "all" by default
+func (s *chatFilterStore) get(chatID int64) filterPreset {
+	s.mu.Lock()
+	name := s.filters[chatID]
+	s.mu.Unlock()
+	if preset, ok := findFilterPreset(name); ok {
+		return preset
+	}
+	preset, _ := findFilterPreset("all")
+	return preset
+}
+
+func (s *chatFilterStore) set(chatID int64, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters[chatID] = name
+}
+
+// filterLabel names the preset on its button and in the afisha header
+func filterLabel(lang string, preset filterPreset) string {
+	return tr(lang, "filter."+preset.Name)
+}
+
+// filterKeyboard builds the filter buttons, marking the active one
+func filterKeyboard(lang, active string) []models.InlineKeyboardButton {
+	if active == "" {
+		active = "all"
+	}
+	row := make([]models.InlineKeyboardButton, 0, len(filterPresets))
+	for _, preset := range filterPresets {
+		text := filterLabel(lang, preset)
+		if preset.Name == active {
+			text = "• " + text
+		}
+		row = append(row, models.InlineKeyboardButton{Text: text, CallbackData: "afisha_filter:" + preset.Name})
+	}
+	return row
+}
+
+// filterCommandHandler shows the Vakhtangov afisha with the named filter applied
+func filterCommandHandler(name string) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if update.Message == nil {
+			return
+		}
+		chatID := update.Message.Chat.ID
+		chatFilters.set(chatID, name)
+
+		p := buildAfishaPages(ctx, chatID, "afisha_theatre_vakhtangov", cacheTTL())
+		pageStore.put(chatID, "afisha_theatre_vakhtangov", p)
+		msg, kb := renderAfishaPage("afisha_theatre_vakhtangov", p, 0)
+		editOrSendMessage(ctx, b, chatID, nil, msg, kb)
+	}
+}
@@ -0,0 +1,118 @@
+// Package main содержит inline-режим бота: поиск спектаклей из любого чата.
+//
+// Этот файл реализует:
+// - inlineQueryHandler() - ответ на "@имя_бота идиот": спектакли с ближайшими сеансами и ссылками на покупку
+// - searchShows() - поиск по названию без учета регистра и разницы "ё"/"е"
+//
+// Inline-режим нужно включить у @BotFather (/setinline). Доступ проверяет authMiddleware:
+// пользователям не из bot.allowed_users отвечаем пустым списком.
+//
+// Взаимодействует с:
+// - afisha_cache.go: спектакли берутся из общего кеша
+// - main.go: normalizeTitle() - то же сравнение названий, что при разборе страниц
+// - vakhtangov_formatter.go: RenderShowDetailMarkdown() формирует текст сообщения
+// - vakhtangov_tickets.go: цены берутся только из кеша, ответ на inline-запрос не ждет сайт
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"parser/logger"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// INLINE_RESULTS_LIMIT — Telegram принимает не больше 50 результатов на один ответ
+const INLINE_RESULTS_LIMIT = 50
+
+// INLINE_CACHE_TIME — сколько секунд Telegram может кешировать ответ для пользователя
+const INLINE_CACHE_TIME = 60
+
+// isInlineQuery matches inline query updates
+func isInlineQuery(update *models.Update) bool {
+	return update.InlineQuery != nil
+}
+
+// searchShows returns shows whose title contains the query; an empty query matches all
+func searchShows(shows []Show, query string) []Show {
+	query = normalizeTitle(query)
+	var out []Show
+	for _, sh := range shows {
+		if strings.Contains(normalizeTitle(sh.Title), query) {
+			out = append(out, sh)
+		}
+	}
+	return out
+}
+
+// inlineDescription summarizes the upcoming sessions for the result list
+func inlineDescription(lang string, sh Show) string {
+	if len(sh.Info) == 0 {
+		return tr(lang, "inline.no_sessions")
+	}
+	onSale := 0
+	for _, inf := range sh.Info {
+		if inf.CanBuy {
+			onSale++
+		}
+	}
+	next := sh.Info[0]
+	return tr(lang, "inline.sessions", len(sh.Info), onSale, stringifyDateLang(lang, next.Start), next.Time)
+}
+
+func inlineQueryHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	q := update.InlineQuery
+	r := rendererFor(ctx)
+	shows, _, err := cache.Shows(ctx, cacheTTL())
+	if err != nil {
+		logError(err)
+		answerInlineQuery(ctx, b, q.ID, nil)
+		return
+	}
+
+	upcoming := ShowFilter{From: startOfDay(mskWallClock(time.Now()))}
+	isDisabled := true
+	var results []models.InlineQueryResult
+	for i, sh := range searchShows(upcoming.ApplyShows(shows), q.Query) {
+		if len(results) == INLINE_RESULTS_LIMIT {
+			break
+		}
+		// Сеансы приходят в порядке ответа API; в подсказке и сообщении нужен ближайший первым
+		sort.Slice(sh.Info, func(i, j int) bool { return sh.Info[i].Start.Before(sh.Info[j].Start) })
+		id := showID(sh.URL)
+		if id == "" || len(id) > 64 {
+			id = strconv.Itoa(i)
+		}
+		results = append(results, &models.InlineQueryResultArticle{
+			ID:          id,
+			Title:       sh.Title,
+			Description: inlineDescription(r.Lang(), sh),
+			InputMessageContent: &models.InputTextMessageContent{
+				MessageText:        truncateCard(r, RenderShowDetailMarkdown(r, tickets.withCachedTickets(sh)), TELEGRAM_MESSAGE_LIMIT, sh.URL),
+				ParseMode:          r.ParseMode(),
+				LinkPreviewOptions: &models.LinkPreviewOptions{IsDisabled: &isDisabled},
+			},
+		})
+	}
+	answerInlineQuery(ctx, b, q.ID, results)
+}
+
+// answerInlineQuery sends results personal to the user, so the allowlist can't be bypassed through cache
+func answerInlineQuery(ctx context.Context, b *bot.Bot, queryID string, results []models.InlineQueryResult) {
+	if results == nil {
+		results = []models.InlineQueryResult{}
+	}
+	if _, err := b.AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     INLINE_CACHE_TIME,
+		IsPersonal:    true,
+	}); err != nil {
+		logger.From(ctx).Errorf("Error answering inline query: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Package main содержит выбор языка интерфейса бота для пользователей и чатов.
+//
+// Этот файл реализует:
+// - languageStore - язык, выбранный через /lang, и language_code из Telegram, хранятся в storage.dir/languages.json
+// - languageMiddleware() - определяет язык каждого обновления и кладет его в контекст обработчиков
+// - langFrom() и rendererFor() - язык и рендерер для ответа на текущее обновление
+// - chatLanguage() - язык фоновых сообщений чату: уведомлений, оповещений и сводок
+// - /lang - кнопки выбора языка; в группе язык меняет только администратор
+//
+// Язык ответа выбирается так: язык группы, заданный через /lang, затем язык, выбранный
+// пользователем, затем language_code из его профиля Telegram, иначе русский.
+// В фоновые сообщения пользователя нет, поэтому там берется язык чата, а для личного
+// чата — язык его владельца. Канал из notifications.channel всегда получает русский текст.
+//
+// Взаимодействует с:
+// - i18n.go: каталог строк и normalizeLang()
+// - telegram.go: RunTelegramBot() подключает middleware и загружает хранилище, callbackHandler() передает сюда "afisha_lang:<язык>"
+// - telegram_middleware.go: updateUser() и updateChatID(); отказ в доступе уже приходит на языке пользователя
+// - telegram_pages.go: страницы афиши пересобираются, если язык чата сменился
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// chatLanguageEntry — язык одного пользователя или чата
+type chatLanguageEntry struct {
+	ID       int64  `json:"id"`
+	Lang     string `json:"lang,omitempty"`     // выбран через /lang
+	Detected string `json:"detected,omitempty"` // language_code из профиля Telegram
+}
+
+type languageStore struct {
+	mu      sync.Mutex
+	path    string
+	entries map[int64]chatLanguageEntry
+}
+
+var languages *languageStore
+
+// newLanguageStore loads languages from path; a missing file means everyone speaks Russian
+func newLanguageStore(path string) (*languageStore, error) {
+	var list []chatLanguageEntry
+	if err := readJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	s := &languageStore{path: path, entries: make(map[int64]chatLanguageEntry, len(list))}
+	for _, e := range list {
+		s.entries[e.ID] = e
+	}
+	return s, nil
+}
+
+func (s *languageStore) get(id int64) chatLanguageEntry {
+	if s == nil {
+		return chatLanguageEntry{ID: id}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[id]
+}
+
+// set saves the language chosen with /lang for a user or a chat
+func (s *languageStore) set(id int64, lang string) error {
+	return s.update(id, func(e *chatLanguageEntry) { e.Lang = lang })
+}
+
+// detect remembers the user's language_code; the file is written only when it changes
+func (s *languageStore) detect(id int64, code string) error {
+	if s == nil || code == "" {
+		return nil
+	}
+	s.mu.Lock()
+	same := s.entries[id].Detected == code
+	s.mu.Unlock()
+	if same {
+		return nil
+	}
+	return s.update(id, func(e *chatLanguageEntry) { e.Detected = code })
+}
+
+func (s *languageStore) update(id int64, fn func(e *chatLanguageEntry)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[id]
+	e.ID = id
+	fn(&e)
+	s.entries[id] = e
+	return s.saveLocked()
+}
+
+// flush writes the store to disk again, e.g. on shutdown
+func (s *languageStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk; s.mu must be held
+func (s *languageStore) saveLocked() error {
+	list := make([]chatLanguageEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return writeJSONFile(s.path, list)
+}
+
+// migrate moves the chat's language when a group is upgraded to a supergroup
+func (s *languageStore) migrate(oldID, newID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	e, ok := s.entries[oldID]
+	if ok {
+		delete(s.entries, oldID)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.update(newID, func(cur *chatLanguageEntry) { *cur = e; cur.ID = newID })
+}
+
+// resolveLanguage picks the reply language for a user in a chat
+func resolveLanguage(chatID int64, user *models.User) string {
+	if chat := languages.get(chatID); chat.Lang != "" {
+		return chat.Lang
+	}
+	if user == nil {
+		return chatLanguage(chatID)
+	}
+	e := languages.get(user.ID)
+	switch {
+	case e.Lang != "":
+		return e.Lang
+	case user.LanguageCode != "":
+		return normalizeLang(user.LanguageCode)
+	}
+	return normalizeLang(e.Detected)
+}
+
+// chatLanguage returns the language of background messages to a chat
+func chatLanguage(chatID int64) string {
+	e := languages.get(chatID)
+	if e.Lang != "" {
+		return e.Lang
+	}
+	return normalizeLang(e.Detected)
+}
+
+// rendererForChat is the renderer for background messages to a chat or the channel
+func rendererForChat(chatID any) TelegramRenderer {
+	if id, ok := chatID.(int64); ok {
+		return botRenderer.WithLang(chatLanguage(id))
+	}
+	return botRenderer.WithLang(langRu)
+}
+
+// langKey — ключ языка обновления в контексте обработчика
+type langKey struct{}
+
+// languageMiddleware puts the update's language into ctx and remembers the user's language_code
+func languageMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		user := updateUser(update)
+		if user != nil {
+			if err := languages.detect(user.ID, user.LanguageCode); err != nil {
+				logError(err)
+			}
+		}
+		lang := resolveLanguage(updateChatID(update), user)
+		next(context.WithValue(ctx, langKey{}, lang), b, update)
+	}
+}
+
+// langFrom returns the language of the update being handled, Russian outside handlers
+func langFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok {
+		return lang
+	}
+	return langRu
+}
+
+// rendererFor returns botRenderer in the language of the update being handled
+func rendererFor(ctx context.Context) TelegramRenderer {
+	return botRenderer.WithLang(langFrom(ctx))
+}
+
+// renderLanguageMenu builds the /lang message and its buttons
+func renderLanguageMenu(lang string) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(lang)
+	msg := r.Bold(tr(lang, "lang.title")) + "\n\n" + r.Escape(tr(lang, "lang.hint"))
+	row := make([]models.InlineKeyboardButton, 0, len(supportedLangs))
+	for _, l := range supportedLangs {
+		text := l.label
+		if l.code == lang {
+			text = "• " + text
+		}
+		row = append(row, models.InlineKeyboardButton{Text: text, CallbackData: "afisha_lang:" + l.code})
+	}
+	return msg, &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// languageOwner returns whose language /lang changes: the group itself or the user
+func languageOwner(chat models.Chat, userID int64) int64 {
+	if isGroupChat(chat) {
+		return chat.ID
+	}
+	return userID
+}
+
+// langCommandHandler shows the language menu or switches it right away: "/lang en"
+func langCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	lang := langFrom(ctx)
+	if args := strings.ToLower(commandArgs(msg)); args != "" {
+		if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+			sendText(ctx, b, msg.Chat.ID, tr(lang, "lang.admin_only"))
+			return
+		}
+		lang = normalizeLang(args)
+		if err := languages.set(languageOwner(msg.Chat, msg.From.ID), lang); err != nil {
+			logError(err)
+			sendText(ctx, b, msg.Chat.ID, tr(lang, "error.save"))
+			return
+		}
+	}
+	text, kb := renderLanguageMenu(lang)
+	editOrSendMessage(ctx, b, msg.Chat.ID, nil, text, kb)
+}
+
+// handleLanguageCallback applies a "afisha_lang:<язык>" button and re-renders the menu in the new language
+func handleLanguageCallback(ctx context.Context, b *bot.Bot, update *models.Update) (string, *models.InlineKeyboardMarkup, bool) {
+	cq := update.CallbackQuery
+	owner := cq.From.ID
+	if message := cq.Message.Message; message != nil {
+		if !isChatAdmin(ctx, b, message.Chat, cq.From.ID) {
+			return "", nil, false
+		}
+		owner = languageOwner(message.Chat, cq.From.ID)
+	}
+	lang := strings.TrimPrefix(cq.Data, "afisha_lang:")
+	if lang != langRu && lang != langEn {
+		return "", nil, false
+	}
+	if err := languages.set(owner, lang); err != nil {
+		logError(err)
+		return "", nil, false
+	}
+	text, kb := renderLanguageMenu(lang)
+	return text, kb, true
+}
@@ -0,0 +1,220 @@
+// Package main содержит цепочку middleware для обработчиков Telegram-бота.
+//
+// Этот файл реализует:
+// - recoverMiddleware() - перехват паник в обработчиках с уведомлением администраторов
+// - loggingMiddleware() - структурированное логирование каждого обновления и времени его обработки, добавляет request_id и chat_id в контекст, чтобы их получали все записи обработчика
+// - authMiddleware() - проверку пользователя по списку bot.allowed_users (или ALLOWED_USERS)
+// - rateLimitMiddleware() - ограничение частоты нажатий "Обновить" для каждого пользователя
+//
+// Взаимодействует с:
+// - telegram.go: RunTelegramBot() подключает цепочку через bot.WithMiddlewares()
+// - telegram_lang.go: languageMiddleware() стоит перед authMiddleware(), поэтому отказы приходят на языке пользователя
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"parser/logger"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// REFRESH_COOLDOWN — минимальный интервал между загрузками афиши одним пользователем
+// по умолчанию (timeouts.refresh_cooldown в конфиге)
+const REFRESH_COOLDOWN = 10 * time.Second
+
+// updateUser returns the author of a message or callback query
+func updateUser(update *models.Update) *models.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.CallbackQuery != nil:
+		return &update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		return update.InlineQuery.From
+	}
+	return nil
+}
+
+// updateChatID returns the chat the update belongs to, falling back to the user ID
+func updateChatID(update *models.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message.Message != nil {
+			return update.CallbackQuery.Message.Message.Chat.ID
+		}
+		return update.CallbackQuery.From.ID
+	case update.InlineQuery != nil && update.InlineQuery.From != nil:
+		return update.InlineQuery.From.ID
+	}
+	return 0
+}
+
+// updateKind describes the update type and its payload for logs
+func updateKind(update *models.Update) (string, string) {
+	switch {
+	case update.Message != nil:
+		// Текст сообщений не логируем: в логи попадает только команда или "text"
+		return "message", updateCommand(update)
+	case update.CallbackQuery != nil:
+		return "callback", update.CallbackQuery.Data
+	case update.InlineQuery != nil:
+		// Поисковый запрос, как и текст сообщений, не логируем
+		return "inline", ""
+	}
+	return "other", ""
+}
+
+// recoverMiddleware keeps the bot alive when a handler panics and notifies admins
+func recoverMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			log.Errorw("Panic in handler",
+				"update_id", update.ID,
+				"chat_id", updateChatID(update),
+				"panic", r,
+				"stacktrace", string(debug.Stack()),
+			)
+			text := fmt.Sprintf("⚠️ Паника при обработке обновления %d: %v", update.ID, r)
+			for _, chatID := range currentConfig().Bot.AdminChatIDs {
+				if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text}); err != nil {
+					log.Errorf("Error notifying admin %d: %v", chatID, err)
+				}
+			}
+		}()
+		next(ctx, b, update)
+	}
+}
+
+// loggingMiddleware logs every update with user/chat IDs and handling time
+func loggingMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		start := time.Now()
+		kind, data := updateKind(update)
+		var userID int64
+		if user := updateUser(update); user != nil {
+			userID = user.ID
+		}
+		// Все записи обработчика получают request_id и chat_id через logger.From(ctx)
+		ctx = logger.WithRequestID(ctx, fmt.Sprintf("tg-%d", update.ID))
+		ctx = logger.WithChatID(ctx, updateChatID(update))
+		next(ctx, b, update)
+		logger.From(ctx).Infow("Update handled",
+			"kind", kind,
+			"data", data,
+			"user_id", userID,
+			"duration", time.Since(start),
+		)
+	}
+}
+
+// authMiddleware rejects updates from users missing in bot.allowed_users
+func authMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		user := updateUser(update)
+		if user == nil {
+			log.Warnw("Update without user", "update_id", update.ID)
+			return
+		}
+		if currentConfig().isAllowedUser(user.Username) {
+			next(ctx, b, update)
+			return
+		}
+
+		// В группе молча пропускаем обычные сообщения посторонних, иначе бот отвечал бы на каждое
+		if update.Message != nil && isGroupChat(update.Message.Chat) {
+			if _, isCommand := parseCommand(update.Message); !isCommand {
+				return
+			}
+		}
+
+		log.Warnw("Access denied", "update_id", update.ID, "user_id", user.ID)
+		if update.CallbackQuery != nil {
+			b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+				CallbackQueryID: update.CallbackQuery.ID,
+				Text:            tr(langFrom(ctx), "access.denied_short"),
+				ShowAlert:       true,
+			})
+			return
+		}
+		if update.InlineQuery != nil {
+			// Пустой ответ: посторонний не увидит афишу, а чат, где набран запрос, не получит сообщений
+			answerInlineQuery(ctx, b, update.InlineQuery.ID, nil)
+			return
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: updateChatID(update),
+			Text:   tr(langFrom(ctx), "access.denied"),
+		})
+	}
+}
+
+// refreshLimiter remembers when each user last requested a fresh afisha
+type refreshLimiter struct {
+	mu   sync.Mutex
+	last map[int64]time.Time
+}
+
+func newRefreshLimiter() *refreshLimiter {
+	return &refreshLimiter{last: make(map[int64]time.Time)}
+}
+
+// allow reports whether the user may refresh now and how long to wait otherwise
+func (l *refreshLimiter) allow(userID int64, now time.Time, cooldown time.Duration) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[userID]; ok {
+		if wait := cooldown - now.Sub(last); wait > 0 {
+			return false, wait
+		}
+	}
+	l.last[userID] = now
+	return true, 0
+}
+
+// isRefreshAction reports whether callback data triggers loading the afisha from the sites
+func isRefreshAction(data string) bool {
+	if _, ok := theaterForAction(data); ok {
+		return true
+	}
+	return data == "afisha_theatre_vakhtangov" || data == "afisha_ballet"
+}
+
+// triggersFetch reports whether callback data makes the bot scrape the sites again
+func triggersFetch(data string) bool {
+	return isRefreshAction(data) || strings.HasPrefix(data, "afisha_filter:")
+}
+
+// rateLimitMiddleware throttles afisha refresh clicks per user
+func rateLimitMiddleware(limiter *refreshLimiter) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if update.CallbackQuery == nil || !triggersFetch(update.CallbackQuery.Data) {
+				next(ctx, b, update)
+				return
+			}
+			ok, wait := limiter.allow(update.CallbackQuery.From.ID, time.Now(), currentConfig().Timeouts.RefreshCooldown.Duration)
+			if !ok {
+				log.Infow("Refresh rate limited", "user_id", update.CallbackQuery.From.ID, "wait", wait)
+				b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            tr(langFrom(ctx), "rate.limited", int(wait.Seconds())+1),
+				})
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package main содержит навигацию по отдельным спектаклям в Telegram-боте.
+//
+// Этот файл реализует:
+// - renderShowList() - меню с названиями спектаклей в виде inline-кнопок
+// - renderShowDetail() - карточку спектакля с сеансами, сценой, составом и ссылками на покупку
+// - Кодирование callback-данных "afisha_list:<action>" и "afisha_show:<action>:<index>"
+//
+// Взаимодействует с:
+// - telegram.go: callbackHandler() редактирует сообщение, показывая меню или карточку
+// - telegram_pages.go: спектакли берутся из afishaPageStore вместе со страницами афиши
+// - vakhtangov_tickets.go: цены и свободные места сеансов для карточки
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// afishaItem — один спектакль для меню и подробного просмотра
+type afishaItem struct {
+	title  string
+	detail string
+	// show — спектакль Вахтангова: карточка перерисовывается с ценами при открытии; nil для балета
+	show *Show
+}
+
+// listCallbackData opens the list of shows for an afisha
+func listCallbackData(action string) string {
+	return "afisha_list:" + action
+}
+
+// showCallbackData opens the show with the given index in the list
+func showCallbackData(action string, idx int) string {
+	return fmt.Sprintf("afisha_show:%s:%d", action, idx)
+}
+
+// parseShowCallbackData decodes data produced by showCallbackData
+func parseShowCallbackData(data string) (string, int, bool) {
+	return parseIndexedCallbackData(data, "afisha_show:")
+}
+
+// renderShowList builds a menu with one button per show
+func renderShowList(action string, p afishaPages) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(p.lang)
+	msg := p.header + r.Escape(tr(p.lang, "shows.choose"))
+	if len(p.items) == 0 {
+		msg = p.header + r.Escape(tr(p.lang, "shows.not_found"))
+	}
+
+	rows := make([][]models.InlineKeyboardButton, 0, len(p.items)+1)
+	for i, item := range p.items {
+		rows = append(rows, []models.InlineKeyboardButton{
+			{Text: item.title, CallbackData: showCallbackData(action, i)},
+		})
+	}
+	rows = append(rows, []models.InlineKeyboardButton{
+		{Text: tr(p.lang, "button.back"), CallbackData: pageCallbackData(action, 0)},
+	})
+	return msg, &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// renderShowDetail shows sessions, stage, cast and buy links of one show.
+// Для спектаклей Вахтангова цены и свободные места загружаются при открытии карточки.
+func renderShowDetail(ctx context.Context, action string, p afishaPages, idx int) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(p.lang)
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: tr(p.lang, "button.back"), CallbackData: listCallbackData(action)},
+			},
+		},
+	}
+	if idx >= len(p.items) {
+		return r.Escape(tr(p.lang, "shows.gone")), kb
+	}
+
+	// Карточка одного спектакля обычно короткая, но длинный состав может не влезть в сообщение
+	item := p.items[idx]
+	url := ""
+	if item.show != nil {
+		item.detail = RenderShowDetailMarkdown(r, tickets.withTickets(ctx, *item.show))
+		url = item.show.URL
+	}
+	detail := truncateCard(r, item.detail, afishaPageLimit(r, p.header), url)
+	return p.header + detail, kb
+}
@@ -0,0 +1,378 @@
+// Package main содержит очередь исходящих сообщений бота для уведомлений, оповещений и сводок.
+//
+// Этот файл реализует:
+// - outboxStore - очередь сообщений, хранится в storage.dir/outbox.json и переживает перезапуск
+// - enqueue() - постановка сообщения в очередь с отбрасыванием повторов по ключу (чат, сеанс, событие)
+// - run() - единственный отправитель: соблюдает ограничения Telegram и повторяет отправку при ошибках
+//
+// Ограничения Telegram: не больше ~30 сообщений в секунду всего, 1 в секунду в личный чат
+// и 20 в минуту в группу или канал. Сообщения одного чата уходят строго по порядку:
+// пока первое ждет повтора, следующие ждут вместе с ним, остальные чаты не задерживаются.
+//
+// Повторы: при 429 ждем retry_after из ответа, при 5xx и сетевых ошибках — экспоненциальная
+// пауза. Ответы 400 и 404 повтором не исправить, такое сообщение отбрасывается. Если группа
+// стала супергруппой, сообщения, подписка, сводка, настройки, оповещения и язык переносятся;
+// если бота заблокировали или удалили из чата, все это, кроме языка, удаляется вместе с сообщениями.
+//
+// Взаимодействует с:
+// - telegram_subscriptions.go: telegramNotifier ставит в очередь изменения афиши
+// - telegram_alerts.go и telegram_digest.go: оповещения и сводки тоже идут через очередь
+// - storage.go: чтение и запись файла очереди
+// - metrics.go: размер очереди и результаты отправки
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// OUTBOX_GLOBAL_INTERVAL — пауза между любыми двумя сообщениями (25 в секунду, с запасом до 30)
+const OUTBOX_GLOBAL_INTERVAL = 40 * time.Millisecond
+
+// OUTBOX_PRIVATE_INTERVAL — пауза между сообщениями в один личный чат
+const OUTBOX_PRIVATE_INTERVAL = time.Second
+
+// OUTBOX_GROUP_INTERVAL — пауза между сообщениями в одну группу или канал (20 в минуту)
+const OUTBOX_GROUP_INTERVAL = 3 * time.Second
+
+// OUTBOX_RETRY_DELAY — пауза перед первым повтором после 5xx или сетевой ошибки, дальше удваивается
+const OUTBOX_RETRY_DELAY = 5 * time.Second
+
+// OUTBOX_MAX_RETRY_DELAY — самая долгая пауза между повторами
+const OUTBOX_MAX_RETRY_DELAY = 10 * time.Minute
+
+// OUTBOX_MAX_ATTEMPTS — после стольких неудачных попыток сообщение отбрасывается
+const OUTBOX_MAX_ATTEMPTS = 10
+
+// OUTBOX_DEDUP_TTL — сколько помнить ключ отправленного изменения: повтор в этот срок не рассылается
+const OUTBOX_DEDUP_TTL = 12 * time.Hour
+
+// outboxMessage — одно сообщение Telegram в очереди
+type outboxMessage struct {
+	ID uint64 `json:"id"`
+	// Chat — ID чата или имя канала "@channel", как принимает channelChatID()
+	Chat      string           `json:"chat"`
+	Text      string           `json:"text"`
+	ParseMode models.ParseMode `json:"parse_mode,omitempty"`
+	Created   time.Time        `json:"created"`
+	Attempts  int              `json:"attempts,omitempty"`
+	NextAt    time.Time        `json:"next_at,omitempty"`
+}
+
+// outboxState — содержимое файла очереди
+type outboxState struct {
+	NextID   uint64          `json:"next_id"`
+	Messages []outboxMessage `json:"messages"`
+	// Seen — ключи поставленных в очередь изменений и время постановки
+	Seen map[string]time.Time `json:"seen"`
+}
+
+type outboxStore struct {
+	mu    sync.Mutex
+	path  string
+	state outboxState
+	// lastSent — время последней отправки в чат, lastAny — в любой чат
+	lastSent map[string]time.Time
+	lastAny  time.Time
+	wake     chan struct{}
+}
+
+var outbox *outboxStore
+
+// newOutboxStore loads the queue from path; a missing file means an empty queue
+func newOutboxStore(path string) (*outboxStore, error) {
+	o := &outboxStore{path: path, lastSent: make(map[string]time.Time), wake: make(chan struct{}, 1)}
+	if err := readJSONFile(path, &o.state); err != nil {
+		return nil, err
+	}
+	if o.state.Seen == nil {
+		o.state.Seen = make(map[string]time.Time)
+	}
+	outboxQueued.Set(float64(len(o.state.Messages)))
+	return o, nil
+}
+
+// outboxChat converts a chat ID or channel name into the queue's chat key
+func outboxChat(chatID any) string {
+	return fmt.Sprint(chatID)
+}
+
+// migrateChat moves everything stored for a group to its new supergroup id
+func migrateChat(oldID, newID int64) {
+	errs := []error{
+		digests.migrate(oldID, newID),
+		preferences.migrate(oldID, newID),
+		alerts.migrate(oldID, newID),
+		languages.migrate(oldID, newID),
+	}
+	if subscriptions != nil {
+		errs = append(errs, subscriptions.migrate(oldID, newID))
+	}
+	if err := errors.Join(errs...); err != nil {
+		logError(err)
+	}
+}
+
+// forgetChat drops everything stored for a chat the bot can no longer write to.
+// Язык остается: у личного чата он общий с пользователем, который может писать боту из групп.
+func forgetChat(chatID int64) {
+	errs := []error{
+		digests.remove(chatID),
+		preferences.remove(chatID),
+		alerts.remove(chatID),
+	}
+	if subscriptions != nil {
+		_, err := subscriptions.remove(chatID)
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		logError(err)
+	}
+}
+
+// changeDedupKey identifies a change for one chat: the session plus the event type
+func changeDedupKey(chatID any, ch PerformanceChange) string {
+	return outboxChat(chatID) + "/" + ch.StageUID + "/" + ch.DateTimeKey + "/" + ch.Event
+}
+
+// enqueue queues blocks for the chat split into messages, the header goes first.
+// keys[i] — ключ блока blocks[i] для отбрасывания повторов; пустой ключ или keys == nil
+// означает, что блок отправляется всегда. Если все блоки уже отправлялись, очередь не меняется.
+func (o *outboxStore) enqueue(chatID any, header string, blocks []string, keys []string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for key, at := range o.state.Seen {
+		if now.Sub(at) > OUTBOX_DEDUP_TTL {
+			delete(o.state.Seen, key)
+		}
+	}
+	fresh := blocks
+	if keys != nil {
+		fresh = nil
+		for i, block := range blocks {
+			if keys[i] != "" {
+				if _, seen := o.state.Seen[keys[i]]; seen {
+					continue
+				}
+				o.state.Seen[keys[i]] = now
+			}
+			fresh = append(fresh, block)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	chat := outboxChat(chatID)
+	for _, page := range splitPages(header, fresh) {
+		o.state.NextID++
+		o.state.Messages = append(o.state.Messages, outboxMessage{
+			ID:        o.state.NextID,
+			Chat:      chat,
+			Text:      page,
+			ParseMode: botRenderer.ParseMode(),
+			Created:   now,
+		})
+	}
+	outboxQueued.Set(float64(len(o.state.Messages)))
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return o.saveLocked()
+}
+
+// chatInterval is the minimal pause between two messages to the chat
+func chatInterval(chat string) time.Duration {
+	// У групп и каналов отрицательные ID, каналы еще задаются как "@channel"
+	if strings.HasPrefix(chat, "-") || strings.HasPrefix(chat, "@") {
+		return OUTBOX_GROUP_INTERVAL
+	}
+	return OUTBOX_PRIVATE_INTERVAL
+}
+
+// next returns the message to send now, or how long to wait for the first one to become ready.
+// Из каждого чата рассматривается только первое сообщение, чтобы сохранить порядок.
+func (o *outboxStore) next(now time.Time) (outboxMessage, time.Duration, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var best outboxMessage
+	var bestAt time.Time
+	found := false
+	heads := make(map[string]bool)
+	for _, m := range o.state.Messages {
+		if heads[m.Chat] {
+			continue
+		}
+		heads[m.Chat] = true
+		readyAt := m.NextAt
+		if t := o.lastSent[m.Chat].Add(chatInterval(m.Chat)); t.After(readyAt) {
+			readyAt = t
+		}
+		if t := o.lastAny.Add(OUTBOX_GLOBAL_INTERVAL); t.After(readyAt) {
+			readyAt = t
+		}
+		if !found || readyAt.Before(bestAt) {
+			best, bestAt, found = m, readyAt, true
+		}
+	}
+	if !found {
+		// Очередь пуста: ждем enqueue()
+		return outboxMessage{}, time.Hour, false
+	}
+	if wait := bestAt.Sub(now); wait > 0 {
+		return outboxMessage{}, wait, false
+	}
+	return best, 0, true
+}
+
+// run sends queued messages until ctx is done
+func (o *outboxStore) run(ctx context.Context, b *bot.Bot) {
+	for {
+		m, wait, ok := o.next(time.Now())
+		if !ok {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-o.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		isDisabled := true
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    channelChatID(m.Chat),
+			Text:      m.Text,
+			ParseMode: m.ParseMode,
+			LinkPreviewOptions: &models.LinkPreviewOptions{
+				IsDisabled: &isDisabled,
+			},
+		})
+		if ctx.Err() != nil {
+			// Остановка: сообщение остается в очереди и уйдет после перезапуска
+			return
+		}
+		if err := o.complete(m, err, time.Now()); err != nil {
+			logError(err)
+		}
+	}
+}
+
+// complete records the send result: removes the message, schedules a retry or moves the chat
+func (o *outboxStore) complete(m outboxMessage, sendErr error, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.lastSent[m.Chat] = now
+	o.lastAny = now
+
+	var tooMany *bot.TooManyRequestsError
+	var migrated *bot.MigrateError
+	switch {
+	case sendErr == nil:
+		o.removeLocked(func(q outboxMessage) bool { return q.ID == m.ID })
+		outboxSends.WithLabelValues("sent").Inc()
+
+	case errors.As(sendErr, &tooMany):
+		o.retryLocked(m.ID, now.Add(time.Duration(tooMany.RetryAfter)*time.Second), false)
+		log.Warnw("Telegram rate limit hit, waiting", "chat", m.Chat, "retry_after", tooMany.RetryAfter)
+		outboxSends.WithLabelValues("retry").Inc()
+
+	case errors.As(sendErr, &migrated):
+		// Группа стала супергруппой: переносим настройки чата и все его сообщения
+		newChat := outboxChat(int64(migrated.MigrateToChatID))
+		for i := range o.state.Messages {
+			if o.state.Messages[i].Chat == m.Chat {
+				o.state.Messages[i].Chat = newChat
+			}
+		}
+		if oldID, ok := channelChatID(m.Chat).(int64); ok {
+			migrateChat(oldID, int64(migrated.MigrateToChatID))
+		}
+		outboxSends.WithLabelValues("retry").Inc()
+
+	case errors.Is(sendErr, bot.ErrorForbidden):
+		// Бота удалили из группы или заблокировали: настройки чата и сообщения больше не нужны
+		log.Infow("Chat is no longer reachable, unsubscribing", "chat", m.Chat)
+		if chatID, ok := channelChatID(m.Chat).(int64); ok {
+			forgetChat(chatID)
+		}
+		dropped := o.removeLocked(func(q outboxMessage) bool { return q.Chat == m.Chat })
+		outboxSends.WithLabelValues("dropped").Add(float64(dropped))
+
+	case errors.Is(sendErr, bot.ErrorBadRequest) || errors.Is(sendErr, bot.ErrorNotFound):
+		log.Errorw("Telegram rejected queued message, dropping it", "chat", m.Chat, "error", sendErr)
+		o.removeLocked(func(q outboxMessage) bool { return q.ID == m.ID })
+		outboxSends.WithLabelValues("dropped").Inc()
+
+	default:
+		// 5xx, сетевая ошибка и прочее: повторяем с растущей паузой
+		if m.Attempts+1 >= OUTBOX_MAX_ATTEMPTS {
+			log.Errorw("Giving up on queued message", "chat", m.Chat, "attempts", m.Attempts+1, "error", sendErr)
+			o.removeLocked(func(q outboxMessage) bool { return q.ID == m.ID })
+			outboxSends.WithLabelValues("dropped").Inc()
+			break
+		}
+		delay := OUTBOX_RETRY_DELAY << m.Attempts
+		if delay > OUTBOX_MAX_RETRY_DELAY || delay <= 0 {
+			delay = OUTBOX_MAX_RETRY_DELAY
+		}
+		o.retryLocked(m.ID, now.Add(delay), true)
+		log.Warnw("Error sending queued message, will retry", "chat", m.Chat, "attempt", m.Attempts+1, "wait", delay, "error", sendErr)
+		outboxSends.WithLabelValues("retry").Inc()
+	}
+	outboxQueued.Set(float64(len(o.state.Messages)))
+	return o.saveLocked()
+}
+
+// retryLocked postpones the message; 429 does not count as a failed attempt; o.mu must be held
+func (o *outboxStore) retryLocked(id uint64, at time.Time, countAttempt bool) {
+	for i := range o.state.Messages {
+		if o.state.Messages[i].ID == id {
+			o.state.Messages[i].NextAt = at
+			if countAttempt {
+				o.state.Messages[i].Attempts++
+			}
+			return
+		}
+	}
+}
+
+// removeLocked deletes matching messages and returns how many were removed; o.mu must be held
+func (o *outboxStore) removeLocked(match func(outboxMessage) bool) int {
+	kept := o.state.Messages[:0]
+	for _, m := range o.state.Messages {
+		if !match(m) {
+			kept = append(kept, m)
+		}
+	}
+	removed := len(o.state.Messages) - len(kept)
+	o.state.Messages = kept
+	return removed
+}
+
+// flush writes the queue to disk again, e.g. on shutdown
+func (o *outboxStore) flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.saveLocked()
+}
+
+// saveLocked writes the queue to disk; o.mu must be held
+func (o *outboxStore) saveLocked() error {
+	return writeJSONFile(o.path, o.state)
+}
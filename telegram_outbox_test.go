@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// withChatStores points every per-chat store at empty files in a temporary directory
+func withChatStores(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	prevSubs, prevDigests, prevAlerts, prevOutbox, prevPrefs, prevLangs := subscriptions, digests, alerts, outbox, preferences, languages
+	t.Cleanup(func() {
+		subscriptions, digests, alerts, outbox, preferences, languages = prevSubs, prevDigests, prevAlerts, prevOutbox, prevPrefs, prevLangs
+	})
+	var err error
+	subscriptions, err = newSubscriptionStore(dir + "/subscriptions.json")
+	if err == nil {
+		digests, err = newDigestStore(dir + "/digests.json")
+	}
+	if err == nil {
+		alerts, err = newAlertStore(dir + "/alerts.json")
+	}
+	if err == nil {
+		outbox, err = newOutboxStore(dir + "/outbox.json")
+	}
+	if err == nil {
+		preferences, err = newPreferenceStore(dir + "/settings.json")
+	}
+	if err == nil {
+		languages, err = newLanguageStore(dir + "/languages.json")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setUpChat stores a subscription, digest, settings with held changes, a watch and a language for the chat
+func setUpChat(t *testing.T, chatID int64) {
+	t.Helper()
+	err := errors.Join(
+		func() error { _, err := subscriptions.add(chatID, "group"); return err }(),
+		digests.set(chatID, "0 9 * * *"),
+		preferences.update(chatID, func(p *chatPreferences) { p.Mode = deliveryDigest }),
+		preferences.hold(chatID, []PerformanceChange{{Title: "Ревизор", Event: ChangeOnSale}}, []string{"Чайка"}),
+		alerts.update(chatID, func(ca *chatAlerts) { ca.Watches = []showWatch{{Title: "Чайка"}} }),
+		languages.set(chatID, langEn),
+		outbox.enqueue(chatID, "", []string{"привет"}, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chatState summarizes what the stores keep for the chat
+func chatState(chatID int64) string {
+	_, subscribed := subscriptions.get(chatID)
+	_, digest := digests.get(chatID)
+	p := preferences.get(chatID)
+	return fmt.Sprintf("subscribed=%v digest=%v mode=%q held=%d/%d watches=%d lang=%q",
+		subscribed, digest, p.Mode, len(p.Held), len(p.HeldAlerts),
+		len(alerts.get(chatID).Watches), languages.get(chatID).Lang)
+}
+
+func TestOutboxMigratesChat(t *testing.T) {
+	withChatStores(t)
+	const oldID, newID = -100, -1001234567890
+	setUpChat(t, oldID)
+	m, _, ok := outbox.next(time.Now())
+	if !ok {
+		t.Fatal("nothing queued")
+	}
+
+	if err := outbox.complete(m, &bot.MigrateError{MigrateToChatID: newID}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := chatState(oldID), `subscribed=false digest=false mode="" held=0/0 watches=0 lang=""`; got != want {
+		t.Errorf("old chat: %s, want %s", got, want)
+	}
+	if got, want := chatState(newID), `subscribed=true digest=true mode="digest" held=1/1 watches=1 lang="en"`; got != want {
+		t.Errorf("new chat: %s, want %s", got, want)
+	}
+	if d, _ := digests.get(newID); d.ChatID != newID {
+		t.Errorf("digest chat_id = %d", d.ChatID)
+	}
+	if m, _, ok := outbox.next(time.Now().Add(time.Minute)); !ok || m.Chat != outboxChat(int64(newID)) {
+		t.Errorf("queued message chat = %q, %v", m.Chat, ok)
+	}
+}
+
+func TestOutboxForgetsForbiddenChat(t *testing.T) {
+	withChatStores(t)
+	const chatID, otherID = 42, 43
+	setUpChat(t, chatID)
+	setUpChat(t, otherID)
+	m, _, ok := outbox.next(time.Now())
+	if !ok {
+		t.Fatal("nothing queued")
+	}
+
+	if err := outbox.complete(m, fmt.Errorf("send: %w", bot.ErrorForbidden), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	forgotten, kept := chatID, otherID
+	if m.Chat != outboxChat(int64(chatID)) {
+		forgotten, kept = otherID, chatID
+	}
+	if got, want := chatState(int64(forgotten)), `subscribed=false digest=false mode="" held=0/0 watches=0 lang="en"`; got != want {
+		t.Errorf("forbidden chat: %s, want %s", got, want)
+	}
+	if got, want := chatState(int64(kept)), `subscribed=true digest=true mode="digest" held=1/1 watches=1 lang="en"`; got != want {
+		t.Errorf("other chat: %s, want %s", got, want)
+	}
+}
+
+// queuedTexts returns the texts of the queued messages in order
+func queuedTexts() []string {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+	var texts []string
+	for _, m := range outbox.state.Messages {
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+func TestOutboxEnqueueDedup(t *testing.T) {
+	withChatStores(t)
+	change := func(stage, dt, event string) PerformanceChange {
+		return PerformanceChange{StageUID: stage, DateTimeKey: dt, Event: event}
+	}
+	onSale := change("main", "2026-11-20-19-00-00", ChangeOnSale)
+	steps := []struct {
+		name   string
+		chat   any
+		blocks []string
+		keys   []string
+		age    time.Duration // насколько состарить уже запомненные ключи перед шагом
+		queued int
+	}{
+		{"first change", int64(1), []string{"a"}, []string{changeDedupKey(int64(1), onSale)}, 0, 1},
+		{"same chat, performance and event", int64(1), []string{"a"}, []string{changeDedupKey(int64(1), onSale)}, 0, 0},
+		{"another chat", int64(2), []string{"a"}, []string{changeDedupKey(int64(2), onSale)}, 0, 1},
+		{"channel", "@afisha", []string{"a"}, []string{changeDedupKey("@afisha", onSale)}, 0, 1},
+		{"another event", int64(1), []string{"b"}, []string{changeDedupKey(int64(1), change("main", "2026-11-20-19-00-00", ChangeSoldOut))}, 0, 1},
+		{"another performance", int64(1), []string{"c"}, []string{changeDedupKey(int64(1), change("small", "2026-11-20-19-00-00", ChangeOnSale))}, 0, 1},
+		{"only the new block of a batch", int64(1), []string{"a", "d"}, []string{changeDedupKey(int64(1), onSale), changeDedupKey(int64(1), change("main", "2026-11-21-19-00-00", ChangeOnSale))}, 0, 1},
+		{"block without a key", int64(1), []string{"a", "e"}, []string{changeDedupKey(int64(1), onSale), ""}, 0, 1},
+		{"no keys at all", int64(1), []string{"a"}, nil, 0, 1},
+		{"still seen just before the TTL", int64(1), []string{"a"}, []string{changeDedupKey(int64(1), onSale)}, OUTBOX_DEDUP_TTL - time.Minute, 0},
+		{"forgotten after the TTL", int64(1), []string{"a"}, []string{changeDedupKey(int64(1), onSale)}, 2 * time.Minute, 1},
+		{"seen again after requeue", int64(1), []string{"a"}, []string{changeDedupKey(int64(1), onSale)}, 0, 0},
+	}
+	for _, step := range steps {
+		if step.age > 0 {
+			outbox.mu.Lock()
+			for key, at := range outbox.state.Seen {
+				outbox.state.Seen[key] = at.Add(-step.age)
+			}
+			outbox.mu.Unlock()
+		}
+		before := len(queuedTexts())
+		if err := outbox.enqueue(step.chat, "", step.blocks, step.keys); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(queuedTexts()) - before; got != step.queued {
+			t.Errorf("%s: queued %d messages, want %d", step.name, got, step.queued)
+		}
+	}
+}
+
+// queueOne resets the queue to a single message to chat with the given attempts
+func queueOne(t *testing.T, chat int64, attempts int) outboxMessage {
+	t.Helper()
+	withChatStores(t)
+	if err := outbox.enqueue(chat, "", []string{"привет"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	outbox.mu.Lock()
+	outbox.state.Messages[0].Attempts = attempts
+	m := outbox.state.Messages[0]
+	outbox.mu.Unlock()
+	return m
+}
+
+func TestOutboxComplete(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		kept     bool
+		wait     time.Duration // NextAt - now
+		wantAtt  int
+	}{
+		{name: "sent", err: nil},
+		{name: "429 waits retry_after without an attempt", attempts: 3, err: fmt.Errorf("send: %w", &bot.TooManyRequestsError{RetryAfter: 30}), kept: true, wait: 30 * time.Second, wantAtt: 3},
+		{name: "429 on the last attempt is not dropped", attempts: OUTBOX_MAX_ATTEMPTS - 1, err: &bot.TooManyRequestsError{RetryAfter: 1}, kept: true, wait: time.Second, wantAtt: OUTBOX_MAX_ATTEMPTS - 1},
+		{name: "first failure", attempts: 0, err: errors.New("connection reset"), kept: true, wait: OUTBOX_RETRY_DELAY, wantAtt: 1},
+		{name: "backoff doubles", attempts: 3, err: errors.New("status 502"), kept: true, wait: OUTBOX_RETRY_DELAY << 3, wantAtt: 4},
+		{name: "backoff is capped", attempts: 7, err: errors.New("status 502"), kept: true, wait: OUTBOX_MAX_RETRY_DELAY, wantAtt: 8},
+		{name: "dropped after max attempts", attempts: OUTBOX_MAX_ATTEMPTS - 1, err: errors.New("status 502")},
+		{name: "bad request is dropped", err: fmt.Errorf("send: %w", bot.ErrorBadRequest)},
+		{name: "not found is dropped", err: fmt.Errorf("send: %w", bot.ErrorNotFound)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := queueOne(t, 1, tt.attempts)
+			if err := outbox.complete(m, tt.err, now); err != nil {
+				t.Fatal(err)
+			}
+			outbox.mu.Lock()
+			messages := append([]outboxMessage(nil), outbox.state.Messages...)
+			outbox.mu.Unlock()
+			if !tt.kept {
+				if len(messages) != 0 {
+					t.Errorf("message kept: %+v", messages)
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages", len(messages))
+			}
+			if got := messages[0].NextAt.Sub(now); got != tt.wait {
+				t.Errorf("next attempt in %v, want %v", got, tt.wait)
+			}
+			if messages[0].Attempts != tt.wantAtt {
+				t.Errorf("attempts = %d, want %d", messages[0].Attempts, tt.wantAtt)
+			}
+			// Раньше NextAt сообщение не отправляется
+			if _, wait, ok := outbox.next(now.Add(tt.wait - time.Millisecond)); ok || wait != time.Millisecond {
+				t.Errorf("next before NextAt: ok=%v wait=%v", ok, wait)
+			}
+			if _, _, ok := outbox.next(now.Add(tt.wait)); !ok {
+				t.Error("not ready at NextAt")
+			}
+		})
+	}
+}
+
+func TestOutboxNextIntervals(t *testing.T) {
+	withChatStores(t)
+	const private, group = int64(1), int64(-5)
+	for _, q := range []struct {
+		chat int64
+		text string
+	}{{private, "p1"}, {private, "p2"}, {group, "g1"}, {group, "g2"}} {
+		if err := outbox.enqueue(q.chat, "", []string{q.text}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t0 := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		at   time.Duration // время шага от t0
+		want string        // отправленное сообщение; пусто — ждать wait
+		wait time.Duration
+	}{
+		{0, "p1", 0},
+		{0, "", OUTBOX_GLOBAL_INTERVAL}, // группа ждет общий интервал
+		{OUTBOX_GLOBAL_INTERVAL, "g1", 0},
+		{2 * OUTBOX_GLOBAL_INTERVAL, "", OUTBOX_PRIVATE_INTERVAL - 2*OUTBOX_GLOBAL_INTERVAL}, // личный чат ждет свой интервал
+		{OUTBOX_PRIVATE_INTERVAL, "p2", 0},
+		{OUTBOX_PRIVATE_INTERVAL + OUTBOX_GLOBAL_INTERVAL, "", OUTBOX_GROUP_INTERVAL - OUTBOX_PRIVATE_INTERVAL}, // группа — реже
+		{OUTBOX_GLOBAL_INTERVAL + OUTBOX_GROUP_INTERVAL, "g2", 0},
+		{time.Hour, "", time.Hour}, // очередь пуста
+	}
+	for i, step := range steps {
+		now := t0.Add(step.at)
+		m, wait, ok := outbox.next(now)
+		if step.want == "" {
+			if ok || wait != step.wait {
+				t.Errorf("step %d: got %q ok=%v wait=%v, want wait %v", i, m.Text, ok, wait, step.wait)
+			}
+			continue
+		}
+		if !ok || !strings.Contains(m.Text, step.want) {
+			t.Fatalf("step %d: got %q ok=%v wait=%v, want %s", i, m.Text, ok, wait, step.want)
+		}
+		if err := outbox.complete(m, nil, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+// Package main содержит постраничный вывод длинной афиши в Telegram.
+//
+// Этот файл реализует:
+// - paginate() - разбиение отрендеренной афиши на страницы по границам спектаклей
+// - utf16Len() - подсчет длины текста в UTF-16 единицах, как это делает Telegram
+// - splitLine() - разрез слишком длинной строки вне тегов, HTML-сущностей и экранирования MarkdownV2
+// - truncateCard() - обрезка длинной карточки спектакля по границе сеанса со строкой "…" и ссылкой на сайт
+// - afishaPageStore - хранение собранных страниц, чтобы листание не перезагружало сайты; старые страницы удаляются
+// - paginationKeyboard() - ряд кнопок "◀️ 1/3 ▶️"
+//
+// Взаимодействует с:
+// - telegram.go: callbackHandler() показывает страницы и обрабатывает листание
+// - vakhtangov_formatter.go, ballet.go: RenderShowsMarkdownBlocks() и RenderBaletShowsMarkdownBlocks() дают блоки для страниц
+// - telegram_inline.go, telegram_navigation.go: карточка спектакля в inline-ответе и в меню
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// TELEGRAM_MESSAGE_LIMIT — максимальная длина текста сообщения в UTF-16 единицах
+const TELEGRAM_MESSAGE_LIMIT = 4096
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// paginate packs blocks into pages no longer than limit UTF-16 units.
+// Blocks are kept whole when possible; an oversized block is split by lines.
+func paginate(blocks []string, separator string, limit int) []string {
+	var pages []string
+	var current strings.Builder
+	currentLen := 0
+	sepLen := utf16Len(separator)
+
+	flush := func() {
+		if currentLen > 0 {
+			pages = append(pages, current.String())
+			current.Reset()
+			currentLen = 0
+		}
+	}
+
+	for _, block := range blocks {
+		for _, part := range splitOversized(block, limit) {
+			partLen := utf16Len(part)
+			if currentLen > 0 && currentLen+sepLen+partLen > limit {
+				flush()
+			}
+			if currentLen > 0 {
+				current.WriteString(separator)
+				currentLen += sepLen
+			}
+			current.WriteString(part)
+			currentLen += partLen
+		}
+	}
+	flush()
+
+	if len(pages) == 0 {
+		return []string{""}
+	}
+	return pages
+}
+
+// splitOversized splits a block longer than limit on line boundaries;
+// a single line longer than limit is cut by splitLine without breaking markup
+func splitOversized(block string, limit int) []string {
+	if utf16Len(block) <= limit {
+		return []string{block}
+	}
+
+	var parts []string
+	var current strings.Builder
+	currentLen := 0
+	for _, line := range strings.SplitAfter(block, "\n") {
+		for _, chunk := range splitLine(line, limit) {
+			chunkLen := utf16Len(chunk)
+			if currentLen > 0 && currentLen+chunkLen > limit {
+				parts = append(parts, strings.TrimRight(current.String(), "\n"))
+				current.Reset()
+				currentLen = 0
+			}
+			current.WriteString(chunk)
+			currentLen += chunkLen
+		}
+	}
+	if currentLen > 0 {
+		parts = append(parts, strings.TrimRight(current.String(), "\n"))
+	}
+	return parts
+}
+
+// truncateCard shortens a show card to limit on a session boundary and adds a "…" line,
+// which links to the full card on the theater site when url is set.
+// Строки с отступом продолжают сеанс (ссылка, цены), поэтому сеанс не разрывается.
+func truncateCard(r TelegramRenderer, card string, limit int, url string) string {
+	if utf16Len(card) <= limit {
+		return card
+	}
+	more := r.Escape("…")
+	if url != "" {
+		more = r.Link("… "+tr(r.Lang(), "show.more"), url)
+	}
+	budget := limit - utf16Len(more) - 1
+
+	lines := strings.SplitAfter(card, "\n")
+	cut, n, size := 0, 0, 0
+	for i, line := range lines {
+		n += utf16Len(line)
+		if n > budget {
+			break
+		}
+		size += len(line)
+		if i+1 == len(lines) || !strings.HasPrefix(lines[i+1], " ") {
+			cut = size
+		}
+	}
+	if cut == 0 {
+		// Даже первый сеанс не помещается: режем по строкам, не ломая разметку
+		return splitOversized(card, budget)[0] + "\n" + more
+	}
+	return strings.TrimRight(card[:cut], "\n") + "\n" + more
+}
+
+// splitLine cuts a line longer than limit UTF-16 units into chunks without breaking runes or markup.
+// Разрез идет там, где не открыт ни один тег, ссылка или выделение; если такого места нет,
+// то хотя бы не внутри тега, HTML-сущности или экранирования MarkdownV2.
+func splitLine(s string, limit int) []string {
+	if utf16Len(s) <= limit {
+		return []string{s}
+	}
+	st := markupState{html: botRenderer.ParseMode() == models.ParseModeHTML}
+	var chunks []string
+	start, n := 0, 0
+	closed, between := -1, -1 // последние допустимые места разреза после start
+	for i, r := range s {
+		if i > start {
+			if st.closed() {
+				closed = i
+			}
+			if st.between() {
+				between = i
+			}
+		}
+		w := 1
+		if r >= 0x10000 {
+			w = 2
+		}
+		if n+w > limit {
+			cut := closed
+			if cut <= start {
+				cut = between
+			}
+			if cut <= start {
+				// Тег или ссылка длиннее сообщения: целым такой текст не отправить
+				cut = i
+			}
+			chunks = append(chunks, s[start:cut])
+			start, n = cut, utf16Len(s[cut:i])
+			closed, between = -1, -1
+		}
+		st.step(r)
+		n += w
+	}
+	if start < len(s) {
+		chunks = append(chunks, s[start:])
+	}
+	return chunks
+}
+
+// markupState follows HTML or MarkdownV2 markup of a rendered line rune by rune
+type markupState struct {
+	html bool
+
+	inTag, closingTag, tagStart bool
+	inEntity                    bool
+	depth                       int // открытые теги HTML
+
+	escaped bool     // предыдущий символ — "\" MarkdownV2
+	markers int      // открытые *, _, ~ и || MarkdownV2, по биту на символ
+	link    linkPart // ссылка MarkdownV2 [текст](url)
+}
+
+type linkPart int
+
+const (
+	linkNone  linkPart = iota
+	linkText           // внутри [...]
+	linkClose          // после "]", дальше идет "("
+	linkURL            // внутри (...)
+)
+
+// closed reports whether no tag, entity, escape, emphasis or link is open
+func (m *markupState) closed() bool {
+	return m.between() && m.depth == 0 && m.markers == 0 && m.link == linkNone
+}
+
+// between reports whether the position is outside a tag, an entity and an escape sequence
+func (m *markupState) between() bool {
+	return !m.inTag && !m.inEntity && !m.escaped && m.link != linkClose && m.link != linkURL
+}
+
+func (m *markupState) step(r rune) {
+	if m.html {
+		m.stepHTML(r)
+		return
+	}
+	m.stepMarkdownV2(r)
+}
+
+func (m *markupState) stepHTML(r rune) {
+	switch {
+	case m.inTag:
+		if m.tagStart {
+			m.closingTag = r == '/'
+			m.tagStart = false
+		}
+		if r == '>' {
+			m.inTag = false
+			if m.closingTag {
+				m.depth--
+			} else {
+				m.depth++
+			}
+		}
+	case m.inEntity:
+		m.inEntity = r != ';'
+	case r == '<':
+		m.inTag, m.tagStart = true, true
+	case r == '&':
+		m.inEntity = true
+	}
+}
+
+func (m *markupState) stepMarkdownV2(r rune) {
+	if m.escaped {
+		m.escaped = false
+		return
+	}
+	// В адресе ссылки разметки нет, экранируются только ")" и "\"
+	if m.link == linkURL {
+		switch r {
+		case '\\':
+			m.escaped = true
+		case ')':
+			m.link = linkNone
+		}
+		return
+	}
+	switch r {
+	case '\\':
+		m.escaped = true
+	case '*':
+		m.markers ^= 1
+	case '_':
+		m.markers ^= 2
+	case '~':
+		m.markers ^= 4
+	case '|':
+		m.markers ^= 8
+	case '[':
+		if m.link == linkNone {
+			m.link = linkText
+		}
+	case ']':
+		if m.link == linkText {
+			m.link = linkClose
+		}
+	case '(':
+		if m.link == linkClose {
+			m.link = linkURL
+		}
+	}
+	if m.link == linkClose && r != ']' && r != '(' {
+		m.link = linkNone
+	}
+}
+
+// afishaPages holds the pages and per-show details built for one chat and afisha
+type afishaPages struct {
+	header    string
+	filter    string
+	lang      string // язык, на котором собраны страницы
+	pages     []string
+	items     []afishaItem
+	updatedAt time.Time
+}
+
+// AFISHA_PAGES_TTL — сколько хранятся собранные страницы чата; потом они собираются заново из кеша
+const AFISHA_PAGES_TTL = time.Hour
+
+// afishaPageStore keeps the last built pages per chat and afisha action
+type afishaPageStore struct {
+	mu    sync.Mutex
+	pages map[string]afishaPages
+}
+
+func newAfishaPageStore() *afishaPageStore {
+	return &afishaPageStore{pages: make(map[string]afishaPages)}
+}
+
+func afishaPageKey(chatID int64, action string) string {
+	return strconv.FormatInt(chatID, 10) + ":" + action
+}
+
+func (s *afishaPageStore) get(chatID int64, action string) (afishaPages, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pages[afishaPageKey(chatID, action)]
+	if !ok || time.Since(p.updatedAt) > AFISHA_PAGES_TTL {
+		return afishaPages{}, false
+	}
+	return p, true
+}
+
+func (s *afishaPageStore) put(chatID int64, action string, p afishaPages) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, old := range s.pages {
+		if now.Sub(old.updatedAt) > AFISHA_PAGES_TTL {
+			delete(s.pages, k)
+		}
+	}
+	s.pages[afishaPageKey(chatID, action)] = p
+}
+
+// pageCallbackData encodes a page switch as "afisha_page:<action>:<page>"
+func pageCallbackData(action string, page int) string {
+	return fmt.Sprintf("afisha_page:%s:%d", action, page)
+}
+
+// parsePageCallbackData decodes data produced by pageCallbackData
+func parsePageCallbackData(data string) (string, int, bool) {
+	return parseIndexedCallbackData(data, "afisha_page:")
+}
+
+// parseIndexedCallbackData decodes "<prefix><action>:<index>" callback data
+func parseIndexedCallbackData(data, prefix string) (string, int, bool) {
+	rest, ok := strings.CutPrefix(data, prefix)
+	if !ok {
+		return "", 0, false
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(rest[idx+1:])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return rest[:idx], n, true
+}
+
+// paginationKeyboard builds the "◀️ 1/3 ▶️" row; nil when there is a single page
+func paginationKeyboard(action string, page, total int) []models.InlineKeyboardButton {
+	if total <= 1 {
+		return nil
+	}
+	prev := (page - 1 + total) % total
+	next := (page + 1) % total
+	return []models.InlineKeyboardButton{
+		{Text: "◀️", CallbackData: pageCallbackData(action, prev)},
+		{Text: fmt.Sprintf("%d/%d", page+1, total), CallbackData: "afisha_noop"},
+		{Text: "▶️", CallbackData: pageCallbackData(action, next)},
+	}
+}
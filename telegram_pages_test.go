@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// withRenderer switches botRenderer for the duration of a test
+func withRenderer(t *testing.T, r TelegramRenderer) {
+	t.Helper()
+	prev := botRenderer
+	botRenderer = r
+	t.Cleanup(func() { botRenderer = prev })
+}
+
+func TestSplitLineKeepsMarkupWhole(t *testing.T) {
+	tests := []struct {
+		name     string
+		renderer TelegramRenderer
+		line     string
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "html cuts between tags",
+			renderer: HTMLRenderer{},
+			line:     "<b>Ревизор</b> и <i>Чайка</i>",
+			limit:    16,
+			want:     []string{"<b>Ревизор</b> и", " <i>Чайка</i>"},
+		},
+		{
+			name:     "html never cuts an entity",
+			renderer: HTMLRenderer{},
+			line:     "Tom &amp; Jerry &lt;3",
+			limit:    6,
+			want:     []string{"Tom ", "&amp; ", "Jerry ", "&lt;3"},
+		},
+		{
+			name:     "html keeps a link whole",
+			renderer: HTMLRenderer{},
+			line:     `Билеты: <a href="https://x.ru/?a=1&amp;b=2">Купить</a>`,
+			limit:    utf16Len(`<a href="https://x.ru/?a=1&amp;b=2">Купить</a>`),
+			want:     []string{"Билеты: ", `<a href="https://x.ru/?a=1&amp;b=2">Купить</a>`},
+		},
+		{
+			name:     "markdown never cuts an escape",
+			renderer: MarkdownV2Renderer{},
+			line:     `ab\.cd\!ef`,
+			limit:    3,
+			want:     []string{"ab", `\.c`, `d\!`, "ef"},
+		},
+		{
+			name:     "markdown keeps bold and links whole",
+			renderer: MarkdownV2Renderer{},
+			line:     `*Три сестры* [Купить](https://x.ru/a_b\)c)`,
+			limit:    utf16Len(`[Купить](https://x.ru/a_b\)c)`),
+			want:     []string{"*Три сестры* ", `[Купить](https://x.ru/a_b\)c)`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withRenderer(t, tt.renderer)
+			got := splitLine(tt.line, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitLine(%q, %d) = %q, want %q", tt.line, tt.limit, got, tt.want)
+			}
+			if strings.Join(got, "") != tt.line {
+				t.Errorf("chunks %q do not add up to the line", got)
+			}
+		})
+	}
+}
+
+func TestPaginateSplitsBetweenBlocks(t *testing.T) {
+	withRenderer(t, HTMLRenderer{})
+	blocks := []string{"<b>Один</b>\nстрока", "<b>Два</b>\nстрока", "<b>Три</b>\nстрока"}
+	got := paginate(blocks, showsSeparator, utf16Len(blocks[0])+utf16Len(showsSeparator)+utf16Len(blocks[1]))
+	if len(got) != 2 || got[1] != blocks[2] {
+		t.Fatalf("paginate = %q", got)
+	}
+}
+
+func TestAfishaPageStoreExpires(t *testing.T) {
+	s := newAfishaPageStore()
+	s.put(1, "afisha_ballet", afishaPages{pages: []string{"old"}, updatedAt: time.Now().Add(-2 * AFISHA_PAGES_TTL)})
+	if _, ok := s.get(1, "afisha_ballet"); ok {
+		t.Error("stale pages are returned")
+	}
+	s.put(2, "afisha_ballet", afishaPages{pages: []string{"new"}, updatedAt: time.Now()})
+	if len(s.pages) != 1 {
+		t.Errorf("stale pages are kept: %d entries", len(s.pages))
+	}
+	if p, ok := s.get(2, "afisha_ballet"); !ok || p.pages[0] != "new" {
+		t.Error("fresh pages are lost")
+	}
+}
+
+func TestTruncateCardKeepsSessionsWhole(t *testing.T) {
+	r := HTMLRenderer{}
+	show := Show{Title: "Ревизор", URL: "https://x.ru/afisha/revizor/"}
+	for day := 1; day <= 40; day++ {
+		show.Info = append(show.Info, ShowInfo{
+			Date: "2 марта 2026", Weekday: "Понедельник", Time: "19:00", Stage: "Основная сцена",
+			CanBuy: true, BuyLink: "https://x.ru/buy?a=1&b=2",
+			Start: time.Date(2026, time.March, day, 19, 0, 0, 0, time.UTC),
+		})
+	}
+	card := RenderShowDetailMarkdown(r, show)
+	limit := 1000
+	got := truncateCard(r, card, limit, show.URL)
+
+	if utf16Len(got) > limit {
+		t.Fatalf("truncated card is %d long, limit %d", utf16Len(got), limit)
+	}
+	more := `<a href="https://x.ru/afisha/revizor/">… все сеансы на сайте театра</a>`
+	if !strings.HasSuffix(got, "\n"+more) {
+		t.Fatalf("no link to the full card:\n%s", got)
+	}
+	body := strings.TrimSuffix(got, "\n"+more)
+	if !strings.HasPrefix(card, body) || !strings.HasSuffix(body, `">Купить билет</a>`) {
+		t.Errorf("card is not cut after a whole session:\n%s", body)
+	}
+	if truncateCard(r, "<b>Чайка</b>\n", limit, show.URL) != "<b>Чайка</b>\n" {
+		t.Error("short card is changed")
+	}
+}
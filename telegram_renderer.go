@@ -0,0 +1,135 @@
+// Package main содержит рендереры текста под режимы разметки Telegram.
+//
+// Этот файл реализует:
+// - TelegramRenderer - общий интерфейс для форматирования текста сообщений
+// - HTMLRenderer - разметку для models.ParseModeHTML (используется ботом)
+// - MarkdownV2Renderer - разметку для models.ParseModeMarkdown (MarkdownV2)
+//
+// Взаимодействует с:
+// - vakhtangov_formatter.go: RenderShowsMarkdown() форматирует спектакли через рендерер
+// - ballet.go: RenderBaletShowsMarkdown() форматирует балеты через рендерер
+// - telegram.go: отправляет сообщения с ParseMode() выбранного рендерера
+// - i18n.go: рендерер несет язык сообщения, строки интерфейса берутся из каталога по Lang()
+package main
+
+import (
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// TelegramRenderer formats message parts for one Telegram parse mode and interface language.
+// All methods take raw text and escape it themselves.
+type TelegramRenderer interface {
+	ParseMode() models.ParseMode
+	// Lang is the interface language of the message, langRu by default
+	Lang() string
+	// WithLang returns the same renderer for another interface language
+	WithLang(lang string) TelegramRenderer
+	Escape(s string) string
+	Bold(s string) string
+	Italic(s string) string
+	Link(text, url string) string
+}
+
+// HTMLRenderer renders text for Telegram HTML parse mode
+type HTMLRenderer struct {
+	lang string
+}
+
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+)
+
+var htmlAttrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+)
+
+func (HTMLRenderer) ParseMode() models.ParseMode {
+	return models.ParseModeHTML
+}
+
+func (r HTMLRenderer) Lang() string { return normalizeLang(r.lang) }
+
+func (HTMLRenderer) WithLang(lang string) TelegramRenderer { return HTMLRenderer{lang: lang} }
+
+func (HTMLRenderer) Escape(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+func (r HTMLRenderer) Bold(s string) string {
+	return "<b>" + r.Escape(s) + "</b>"
+}
+
+func (r HTMLRenderer) Italic(s string) string {
+	return "<i>" + r.Escape(s) + "</i>"
+}
+
+func (r HTMLRenderer) Link(text, url string) string {
+	return `<a href="` + htmlAttrEscaper.Replace(url) + `">` + r.Escape(text) + "</a>"
+}
+
+// MarkdownV2Renderer renders text for Telegram MarkdownV2 parse mode
+type MarkdownV2Renderer struct {
+	lang string
+}
+
+// markdownV2Escaper экранирует все символы, зарезервированные в MarkdownV2
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"_", "\\_",
+	"*", "\\*",
+	"[", "\\[",
+	"]", "\\]",
+	"(", "\\(",
+	")", "\\)",
+	"~", "\\~",
+	"`", "\\`",
+	">", "\\>",
+	"#", "\\#",
+	"+", "\\+",
+	"-", "\\-",
+	"=", "\\=",
+	"|", "\\|",
+	"{", "\\{",
+	"}", "\\}",
+	".", "\\.",
+	"!", "\\!",
+)
+
+// markdownV2URLEscaper экранирует символы внутри (...) части ссылки
+var markdownV2URLEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	")", "\\)",
+)
+
+func (MarkdownV2Renderer) ParseMode() models.ParseMode {
+	return models.ParseModeMarkdown
+}
+
+func (r MarkdownV2Renderer) Lang() string { return normalizeLang(r.lang) }
+
+func (MarkdownV2Renderer) WithLang(lang string) TelegramRenderer {
+	return MarkdownV2Renderer{lang: lang}
+}
+
+func (MarkdownV2Renderer) Escape(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+func (r MarkdownV2Renderer) Bold(s string) string {
+	return "*" + r.Escape(s) + "*"
+}
+
+func (r MarkdownV2Renderer) Italic(s string) string {
+	return "_" + r.Escape(s) + "_"
+}
+
+func (r MarkdownV2Renderer) Link(text, url string) string {
+	return "[" + r.Escape(text) + "](" + markdownV2URLEscaper.Replace(url) + ")"
+}
@@ -0,0 +1,161 @@
+package main
+
+import "testing"
+
+func TestRendererEscape(t *testing.T) {
+	tests := []struct {
+		in, html, markdown string
+	}{
+		{"Вишнёвый сад", "Вишнёвый сад", "Вишнёвый сад"},
+		{"Ёлка", "Ёлка", "Ёлка"},
+		{"Д.Е. Ф.", "Д.Е. Ф.", `Д\.Е\. Ф\.`},
+		{"Анна-Мария", "Анна-Мария", `Анна\-Мария`},
+		{"Ура!", "Ура!", `Ура\!`},
+		{"(16+)", "(16+)", `\(16\+\)`},
+		{"snake_case", "snake_case", `snake\_case`},
+		{"*звезда*", "*звезда*", `\*звезда\*`},
+		{"Tom & Jerry", "Tom &amp; Jerry", "Tom & Jerry"},
+		{"<премьера>", "&lt;премьера&gt;", `<премьера\>`},
+		{`"Чайка"`, `"Чайка"`, `"Чайка"`},
+		{"[1] ~x~ `y` #2 =3 |4| {5}", "[1] ~x~ `y` #2 =3 |4| {5}", "\\[1\\] \\~x\\~ \\`y\\` \\#2 \\=3 \\|4\\| \\{5\\}"},
+		{`C:\path`, `C:\path`, `C:\\path`},
+	}
+	for _, tt := range tests {
+		if got := (HTMLRenderer{}).Escape(tt.in); got != tt.html {
+			t.Errorf("HTML Escape(%q) = %q, want %q", tt.in, got, tt.html)
+		}
+		if got := (MarkdownV2Renderer{}).Escape(tt.in); got != tt.markdown {
+			t.Errorf("MarkdownV2 Escape(%q) = %q, want %q", tt.in, got, tt.markdown)
+		}
+	}
+}
+
+func TestRendererLink(t *testing.T) {
+	tests := []struct {
+		text, url, html, markdown string
+	}{
+		{
+			"Купить", "https://x.ru/buy?a=1&b=2",
+			`<a href="https://x.ru/buy?a=1&amp;b=2">Купить</a>`,
+			`[Купить](https://x.ru/buy?a=1&b=2)`,
+		},
+		{
+			"Билет (партер)", "https://x.ru/s_(1)",
+			`<a href="https://x.ru/s_(1)">Билет (партер)</a>`,
+			`[Билет \(партер\)](https://x.ru/s_(1\))`,
+		},
+		{
+			"Ссылка", `https://x.ru/?q="a"`,
+			`<a href="https://x.ru/?q=&quot;a&quot;">Ссылка</a>`,
+			`[Ссылка](https://x.ru/?q="a")`,
+		},
+	}
+	for _, tt := range tests {
+		if got := (HTMLRenderer{}).Link(tt.text, tt.url); got != tt.html {
+			t.Errorf("HTML Link(%q, %q) = %q, want %q", tt.text, tt.url, got, tt.html)
+		}
+		if got := (MarkdownV2Renderer{}).Link(tt.text, tt.url); got != tt.markdown {
+			t.Errorf("MarkdownV2 Link(%q, %q) = %q, want %q", tt.text, tt.url, got, tt.markdown)
+		}
+	}
+}
+
+// trickyShows are titles and links with every character that needs escaping in one of the modes
+func trickyShows() []Show {
+	return []Show{
+		{
+			Title: "Антигона",
+			Info:  []ShowInfo{{Date: "14 марта 2026", Weekday: "Суббота", Time: "12:00"}},
+		},
+		{
+			Title: `Ёлка "Щелкунчик" (1-й акт) _new_ *hit* & <премьера>! v.2`,
+			Info: []ShowInfo{
+				{Date: "12 марта 2026", Weekday: "Четверг", Time: "19:00", CanBuy: true, BuyLink: "https://t.example/buy?show=a&date=(12)"},
+			},
+		},
+	}
+}
+
+func TestRenderShowsMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		r    TelegramRenderer
+		want string
+	}{
+		{
+			name: "html",
+			r:    HTMLRenderer{},
+			want: `<b>Ёлка "Щелкунчик" (1-й акт) _new_ *hit* &amp; &lt;премьера&gt;! v.2</b>` + "\n" +
+				"✅ Билеты доступны\n\nОпции покупки:\n" +
+				"• 12 марта 2026, Четверг, 19:00\n" +
+				`  → <a href="https://t.example/buy?show=a&amp;date=(12)">Купить билет</a>` + "\n" +
+				showsSeparator +
+				"<b>Антигона</b>\n✅ Билеты доступны\n\nОпции покупки:\n" +
+				"• 14 марта 2026, Суббота, 12:00\n",
+		},
+		{
+			name: "markdown v2",
+			r:    MarkdownV2Renderer{},
+			want: `*Ёлка "Щелкунчик" \(1\-й акт\) \_new\_ \*hit\* & <премьера\>\! v\.2*` + "\n" +
+				"✅ Билеты доступны\n\nОпции покупки:\n" +
+				"• 12 марта 2026, Четверг, 19:00\n" +
+				`  → [Купить билет](https://t.example/buy?show=a&date=(12\))` + "\n" +
+				showsSeparator +
+				"*Антигона*\n✅ Билеты доступны\n\nОпции покупки:\n" +
+				"• 14 марта 2026, Суббота, 12:00\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderShowsMarkdown(tt.r, trickyShows()); got != tt.want {
+				t.Errorf("RenderShowsMarkdown =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderBaletShowsMarkdown(t *testing.T) {
+	shows := func() []BaletShow {
+		return []BaletShow{
+			{
+				Title:  " Дон Кихот (1-й акт) & <гала>! ",
+				CanBuy: true,
+				Sessions: []BaletSession{
+					{Info: "12.03.2026 19:00, Основная сцена", BuyLink: "https://ballet.example/buy?id=1&s=(2)"},
+				},
+			},
+			{Title: "Жизель_2.0"},
+		}
+	}
+	tests := []struct {
+		name string
+		r    TelegramRenderer
+		want string
+	}{
+		{
+			name: "html",
+			r:    HTMLRenderer{},
+			want: "<b>Жизель_2.0</b>\n❌ Билеты недоступны\n" +
+				showsSeparator +
+				"<b>Дон Кихот (1-й акт) &amp; &lt;гала&gt;!</b>\n✅ Билеты доступны\n\n<b>Опции покупки:</b>\n" +
+				"• 12.03.2026 19:00, Основная сцена\n" +
+				`  → <a href="https://ballet.example/buy?id=1&amp;s=(2)">Купить билет</a>` + "\n",
+		},
+		{
+			name: "markdown v2",
+			r:    MarkdownV2Renderer{},
+			want: "*Жизель\\_2\\.0*\n❌ Билеты недоступны\n" +
+				showsSeparator +
+				`*Дон Кихот \(1\-й акт\) & <гала\>\!*` + "\n✅ Билеты доступны\n\n*Опции покупки:*\n" +
+				`• 12\.03\.2026 19:00, Основная сцена` + "\n" +
+				`  → [Купить билет](https://ballet.example/buy?id=1&s=(2\))` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderBaletShowsMarkdown(tt.r, shows()); got != tt.want {
+				t.Errorf("RenderBaletShowsMarkdown =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,638 @@
+// Package main содержит настройки уведомлений чата: тихие часы, часовой пояс, режим и виды уведомлений.
+//
+// Этот файл реализует:
+// - preferenceStore - настройки чатов и отложенные уведомления, хранятся в storage.dir/settings.json
+// - /settings - меню настроек с кнопками; "/settings тишина=23-8 пояс=Europe/Berlin режим=сводка"
+// - runHeldNotifier() - раз в минуту отправляет отложенные уведомления одним сообщением
+//
+// В тихие часы изменения афиши и оповещения не отправляются, а копятся и приходят утром
+// одним сообщением. В режиме "сводкой" изменения приходят раз в день: в конце тихих часов
+// или в SETTINGS_SUMMARY_HOUR, если тихие часы выключены; оповещения по-прежнему приходят сразу.
+// Часы считаются в часовом поясе чата, по умолчанию — московском. Время сеансов в сообщениях
+// всегда московское, как в афише театра.
+//
+// Взаимодействует с:
+// - telegram_subscriptions.go: telegramNotifier спрашивает, отправлять изменения сразу или отложить
+// - telegram_alerts.go и telegram_digest.go: оповещения и сводка отключаются здесь же
+// - telegram_outbox.go: отложенные уведомления уходят через очередь исходящих сообщений
+// - telegram_commands.go: в группе менять настройки может только администратор
+// - telegram.go: callbackHandler() передает сюда нажатия "afisha_settings:<действие>"
+// - telegram_lang.go: отложенные уведомления приходят на языке чата
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // в образе alpine нет базы часовых поясов
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// SETTINGS_DEFAULT_TIMEZONE — часовой пояс чата, если он не выбран
+const SETTINGS_DEFAULT_TIMEZONE = "Europe/Moscow"
+
+// SETTINGS_SUMMARY_HOUR — час сводки изменений в режиме "сводкой", если тихие часы выключены
+const SETTINGS_SUMMARY_HOUR = 9
+
+// SETTINGS_CHECK_INTERVAL — как часто проверять, не пора ли отправить отложенные уведомления
+const SETTINGS_CHECK_INTERVAL = time.Minute
+
+// deliveryDigest — режим "сводкой": изменения афиши приходят раз в день одним сообщением.
+// Пустой режим — изменения приходят сразу, кроме тихих часов.
+const deliveryDigest = "digest"
+
+// Виды уведомлений, которые чат может выключить
+const (
+	streamChanges = "changes" // новые даты и начало продаж по /subscribe
+	streamAlerts  = "alerts"  // оповещения по /watch
+	streamDigest  = "digest"  // сводка по расписанию /digest
+)
+
+// settingsStreams — виды уведомлений в порядке кнопок меню; подписи — "settings.stream.<вид>" в каталоге
+var settingsStreams = []string{streamChanges, streamAlerts, streamDigest}
+
+// settingsEvents — типы изменений, которые можно выключить; подписи — "settings.event.<тип>"
+var settingsEvents = []string{ChangeAdded, ChangeOnSale}
+
+// quietPresets — тихие часы на кнопке меню по кругу; {0, 0} — выключены
+var quietPresets = [][2]int{{0, 0}, {23, 8}, {22, 9}, {0, 10}}
+
+// timezonePresets — часовые пояса на кнопке меню по кругу, остальные задаются командой;
+// подписи — "tz.<пояс>" в каталоге
+var timezonePresets = []string{
+	"Europe/Moscow",
+	"Europe/Kaliningrad",
+	"Europe/Samara",
+	"Asia/Yekaterinburg",
+	"Asia/Novosibirsk",
+	"Asia/Vladivostok",
+}
+
+// chatPreferences — настройки уведомлений одного чата и отложенные уведомления
+type chatPreferences struct {
+	ChatID   int64  `json:"chat_id"`
+	Timezone string `json:"timezone,omitempty"` // пусто — SETTINGS_DEFAULT_TIMEZONE
+	// QuietFrom и QuietTo — тихие часы [QuietFrom, QuietTo) по времени чата; равные значения — выключены
+	QuietFrom int      `json:"quiet_from,omitempty"`
+	QuietTo   int      `json:"quiet_to,omitempty"`
+	Mode      string   `json:"mode,omitempty"`        // пусто — сразу
+	Muted     []string `json:"muted,omitempty"`       // выключенные виды уведомлений
+	SkipEvent []string `json:"skip_events,omitempty"` // выключенные типы изменений
+	// Held и HeldAlerts — отложенные изменения и готовые блоки оповещений
+	Held       []PerformanceChange `json:"held,omitempty"`
+	HeldAlerts []string            `json:"held_alerts,omitempty"`
+	// LastSummary — когда отложенное отправлено в последний раз
+	LastSummary time.Time `json:"last_summary,omitempty"`
+}
+
+// location returns the chat's time zone
+func (p chatPreferences) location() *time.Location {
+	name := p.Timezone
+	if name == "" {
+		name = SETTINGS_DEFAULT_TIMEZONE
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+	return time.FixedZone("MSK", 3*60*60)
+}
+
+func (p chatPreferences) quietEnabled() bool { return p.QuietFrom != p.QuietTo }
+
+// inQuietHours reports whether now falls into the chat's quiet hours
+func (p chatPreferences) inQuietHours(now time.Time) bool {
+	if !p.quietEnabled() {
+		return false
+	}
+	h := now.In(p.location()).Hour()
+	if p.QuietFrom < p.QuietTo {
+		return h >= p.QuietFrom && h < p.QuietTo
+	}
+	// Тихие часы через полночь, например 23–8
+	return h >= p.QuietFrom || h < p.QuietTo
+}
+
+// summaryTime is today's time of the daily summary in digest mode
+func (p chatPreferences) summaryTime(now time.Time) time.Time {
+	hour := SETTINGS_SUMMARY_HOUR
+	if p.quietEnabled() {
+		hour = p.QuietTo
+	}
+	local := now.In(p.location())
+	return time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, local.Location())
+}
+
+func (p chatPreferences) streamEnabled(stream string) bool {
+	return !slices.Contains(p.Muted, stream)
+}
+
+func (p chatPreferences) digestMode() bool { return p.Mode == deliveryDigest }
+
+// wantedChanges drops the event types the chat turned off
+func (p chatPreferences) wantedChanges(changes []PerformanceChange) []PerformanceChange {
+	if len(p.SkipEvent) == 0 {
+		return changes
+	}
+	var out []PerformanceChange
+	for _, ch := range changes {
+		if !slices.Contains(p.SkipEvent, ch.Event) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// holdChanges reports whether changes must wait instead of going out now
+func (p chatPreferences) holdChanges(now time.Time) bool {
+	return p.digestMode() || p.inQuietHours(now)
+}
+
+// heldDue reports whether the held notifications should be sent now
+func (p chatPreferences) heldDue(now time.Time) bool {
+	if len(p.Held) == 0 && len(p.HeldAlerts) == 0 {
+		return false
+	}
+	if p.inQuietHours(now) {
+		return false
+	}
+	if len(p.HeldAlerts) > 0 || !p.digestMode() {
+		return true
+	}
+	t := p.summaryTime(now)
+	return !now.Before(t) && p.LastSummary.Before(t)
+}
+
+// isDefault reports whether the chat has nothing worth storing
+func (p chatPreferences) isDefault() bool {
+	return p.Timezone == "" && !p.quietEnabled() && p.Mode == "" &&
+		len(p.Muted) == 0 && len(p.SkipEvent) == 0 &&
+		len(p.Held) == 0 && len(p.HeldAlerts) == 0
+}
+
+func (p chatPreferences) clone() chatPreferences {
+	out := p
+	out.Muted = slices.Clone(p.Muted)
+	out.SkipEvent = slices.Clone(p.SkipEvent)
+	out.Held = slices.Clone(p.Held)
+	out.HeldAlerts = slices.Clone(p.HeldAlerts)
+	return out
+}
+
+type preferenceStore struct {
+	mu    sync.Mutex
+	path  string
+	chats map[int64]*chatPreferences
+}
+
+var preferences *preferenceStore
+
+// newPreferenceStore loads chat settings from path; a missing file means defaults everywhere
+func newPreferenceStore(path string) (*preferenceStore, error) {
+	var list []chatPreferences
+	if err := readJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	s := &preferenceStore{path: path, chats: make(map[int64]*chatPreferences, len(list))}
+	for i := range list {
+		s.chats[list[i].ChatID] = &list[i]
+	}
+	return s, nil
+}
+
+// get returns a copy of the chat's settings, defaults when there are none
+func (s *preferenceStore) get(chatID int64) chatPreferences {
+	if s == nil {
+		return chatPreferences{ChatID: chatID}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.chats[chatID]; ok {
+		return p.clone()
+	}
+	return chatPreferences{ChatID: chatID}
+}
+
+// update changes the chat's settings and saves the store; chats with default settings are dropped
+func (s *preferenceStore) update(chatID int64, fn func(p *chatPreferences)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.chats[chatID]
+	if !ok {
+		p = &chatPreferences{ChatID: chatID}
+	}
+	fn(p)
+	if p.isDefault() {
+		delete(s.chats, chatID)
+	} else {
+		s.chats[chatID] = p
+	}
+	return s.saveLocked()
+}
+
+// migrate moves the chat's settings and held notifications when a group is upgraded to a supergroup
+func (s *preferenceStore) migrate(oldID, newID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.chats[oldID]
+	if !ok {
+		return nil
+	}
+	delete(s.chats, oldID)
+	p.ChatID = newID
+	s.chats[newID] = p
+	return s.saveLocked()
+}
+
+// remove drops the chat's settings and held notifications, e.g. when the bot was removed from the chat
+func (s *preferenceStore) remove(chatID int64) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; !ok {
+		return nil
+	}
+	delete(s.chats, chatID)
+	return s.saveLocked()
+}
+
+// flush writes the store to disk again, held notifications included, e.g. on shutdown
+func (s *preferenceStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk; s.mu must be held
+func (s *preferenceStore) saveLocked() error {
+	list := make([]chatPreferences, 0, len(s.chats))
+	for _, c := range s.chats {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ChatID < list[j].ChatID })
+	return writeJSONFile(s.path, list)
+}
+
+// all returns copies of every chat with stored settings
+func (s *preferenceStore) all() []chatPreferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]chatPreferences, 0, len(s.chats))
+	for _, p := range s.chats {
+		list = append(list, p.clone())
+	}
+	return list
+}
+
+// hold keeps changes and alert blocks until the chat's quiet hours or summary time are over
+func (s *preferenceStore) hold(chatID int64, changes []PerformanceChange, alertBlocks []string) error {
+	return s.update(chatID, func(p *chatPreferences) {
+		for _, ch := range changes {
+			key := changeDedupKey(chatID, ch)
+			if !slices.ContainsFunc(p.Held, func(h PerformanceChange) bool { return changeDedupKey(chatID, h) == key }) {
+				p.Held = append(p.Held, ch)
+			}
+		}
+		p.HeldAlerts = append(p.HeldAlerts, alertBlocks...)
+	})
+}
+
+// deliverAlerts queues alert blocks now or holds them until the quiet hours end
+func deliverAlerts(chatID int64, header string, blocks []string) error {
+	if preferences.get(chatID).inQuietHours(time.Now()) {
+		return preferences.hold(chatID, nil, blocks)
+	}
+	return outbox.enqueue(chatID, header, blocks, nil)
+}
+
+// runHeldNotifier sends held notifications once they are due until ctx is done
+func runHeldNotifier(ctx context.Context) {
+	ticker := time.NewTicker(SETTINGS_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for _, p := range preferences.all() {
+			if p.heldDue(now) {
+				sendHeld(p, now)
+			}
+		}
+	}
+}
+
+// sendHeld queues the held notifications as one message and forgets them.
+// В режиме "сводкой" изменения ждут своего часа, даже если оповещения уже можно отправить.
+func sendHeld(p chatPreferences, now time.Time) {
+	changes := p.Held
+	if p.digestMode() {
+		t := p.summaryTime(now)
+		if now.Before(t) || !p.LastSummary.Before(t) {
+			changes = nil
+		}
+	}
+
+	r := rendererForChat(p.ChatID)
+	var blocks, keys []string
+	if len(changes) > 0 {
+		rendered := renderChanges(r, changes)
+		rendered[0] = r.Bold(tr(r.Lang(), "changes.title")) + "\n\n" + rendered[0]
+		blocks = append(blocks, rendered...)
+		for _, ch := range changes {
+			keys = append(keys, changeDedupKey(p.ChatID, ch))
+		}
+	}
+	if len(p.HeldAlerts) > 0 {
+		alertBlocks := slices.Clone(p.HeldAlerts)
+		alertBlocks[0] = r.Bold(tr(r.Lang(), "alerts.title")) + "\n\n" + alertBlocks[0]
+		blocks = append(blocks, alertBlocks...)
+		keys = append(keys, make([]string, len(alertBlocks))...)
+	}
+
+	header := r.Bold(tr(r.Lang(), "settings.held_title")) + "\n\n"
+	if err := outbox.enqueue(p.ChatID, header, blocks, keys); err != nil {
+		logError(err)
+		return
+	}
+	// Пока сообщение ставилось в очередь, могли отложиться новые уведомления: удаляем только отправленные.
+	// Чат могли и забыть, если бота из него удалили, тогда отложенного уже нет.
+	err := preferences.update(p.ChatID, func(cur *chatPreferences) {
+		cur.Held = cur.Held[min(len(changes), len(cur.Held)):]
+		cur.HeldAlerts = cur.HeldAlerts[min(len(p.HeldAlerts), len(cur.HeldAlerts)):]
+		if len(changes) > 0 {
+			cur.LastSummary = now
+		}
+	})
+	if err != nil {
+		logError(err)
+	}
+}
+
+// parseQuietHours parses "23-8" or "23:00-08:00"; "нет" and "off" turn quiet hours off
+func parseQuietHours(lang, value string) (int, int, error) {
+	if value == "нет" || value == "off" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(strings.ReplaceAll(value, "–", "-"), "-")
+	if !ok {
+		return 0, 0, errors.New(tr(lang, "settings.bad_quiet", value))
+	}
+	parse := func(s string) (int, error) {
+		s, _, _ = strings.Cut(strings.TrimSpace(s), ":")
+		h, err := strconv.Atoi(s)
+		if err != nil || h < 0 || h > 23 {
+			return 0, errors.New(tr(lang, "settings.bad_hour", value))
+		}
+		return h, nil
+	}
+	f, err := parse(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	t, err := parse(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f, t, nil
+}
+
+// parseSettingsArgs applies "тишина=23-8 пояс=Europe/Berlin режим=сводка" to p
+func parseSettingsArgs(lang, args string, p *chatPreferences) error {
+	for _, field := range strings.Fields(args) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return errors.New(tr(lang, "settings.bad_field", field))
+		}
+		switch strings.ToLower(key) {
+		case "тишина", "quiet":
+			from, to, err := parseQuietHours(lang, strings.ToLower(value))
+			if err != nil {
+				return err
+			}
+			p.QuietFrom, p.QuietTo = from, to
+		case "пояс", "tz":
+			if _, err := time.LoadLocation(value); err != nil || value == "Local" {
+				return errors.New(tr(lang, "settings.bad_timezone", value))
+			}
+			p.Timezone = value
+			if value == SETTINGS_DEFAULT_TIMEZONE {
+				p.Timezone = ""
+			}
+		case "режим", "mode":
+			switch strings.ToLower(value) {
+			case "сразу", "instant":
+				p.Mode = ""
+			case "сводка", "сводкой", "digest":
+				setDigestMode(p)
+			default:
+				return errors.New(tr(lang, "settings.bad_mode", value))
+			}
+		default:
+			return errors.New(tr(lang, "error.unknown_param", key))
+		}
+	}
+	return nil
+}
+
+// setDigestMode switches to daily summaries; the first one comes on the next summary time, not right away
+func setDigestMode(p *chatPreferences) {
+	if !p.digestMode() {
+		p.Mode = deliveryDigest
+		p.LastSummary = time.Now()
+	}
+}
+
+// timezoneName returns the chat's IANA time zone
+func timezoneName(p chatPreferences) string {
+	if p.Timezone == "" {
+		return SETTINGS_DEFAULT_TIMEZONE
+	}
+	return p.Timezone
+}
+
+// timezoneLabel names the chat's time zone for the menu
+func timezoneLabel(lang string, p chatPreferences) string {
+	name := timezoneName(p)
+	if slices.Contains(timezonePresets, name) {
+		return tr(lang, "tz."+name)
+	}
+	return name
+}
+
+// describeQuietHours renders "23:00–08:00" or "выключены"
+func describeQuietHours(lang string, p chatPreferences) string {
+	if !p.quietEnabled() {
+		return tr(lang, "settings.quiet_off")
+	}
+	return fmt.Sprintf("%02d:00–%02d:00", p.QuietFrom, p.QuietTo)
+}
+
+// checkMark prefixes enabled toggles with ✅ and disabled ones with ▫️
+func checkMark(on bool, label string) string {
+	if on {
+		return "✅ " + label
+	}
+	return "▫️ " + label
+}
+
+// renderSettings builds the /settings message and its buttons
+func renderSettings(lang string, p chatPreferences) (string, *models.InlineKeyboardMarkup) {
+	r := botRenderer.WithLang(lang)
+	mode := tr(lang, "settings.mode_instant")
+	if p.digestMode() {
+		mode = tr(lang, "settings.mode_digest", p.summaryTime(time.Now()).Hour())
+	}
+	text := tr(lang, "settings.quiet", describeQuietHours(lang, p), timezoneLabel(lang, p)) + "\n" +
+		tr(lang, "settings.mode", mode) + "\n"
+	if held := len(p.Held) + len(p.HeldAlerts); held > 0 {
+		text += tr(lang, "settings.held", held) + "\n"
+	}
+	text += "\n" + tr(lang, "settings.help")
+	msg := r.Bold(tr(lang, "settings.title")) + "\n\n" + r.Escape(text)
+
+	streams := make([]models.InlineKeyboardButton, 0, len(settingsStreams))
+	for _, s := range settingsStreams {
+		streams = append(streams, models.InlineKeyboardButton{
+			Text:         checkMark(p.streamEnabled(s), tr(lang, "settings.stream."+s)),
+			CallbackData: "afisha_settings:stream:" + s,
+		})
+	}
+	events := make([]models.InlineKeyboardButton, 0, len(settingsEvents))
+	for _, e := range settingsEvents {
+		events = append(events, models.InlineKeyboardButton{
+			Text:         checkMark(!slices.Contains(p.SkipEvent, e), tr(lang, "settings.event."+e)),
+			CallbackData: "afisha_settings:event:" + e,
+		})
+	}
+	modeButton := tr(lang, "settings.button_instant")
+	if p.digestMode() {
+		modeButton = tr(lang, "settings.button_digest")
+	}
+	return msg, &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{
+			{Text: tr(lang, "settings.button_quiet", describeQuietHours(lang, p)), CallbackData: "afisha_settings:quiet"},
+			{Text: "🕒 " + timezoneLabel(lang, p), CallbackData: "afisha_settings:tz"},
+		},
+		{{Text: modeButton, CallbackData: "afisha_settings:mode"}},
+		streams,
+		events,
+	}}
+}
+
+// settingsCommandHandler shows the menu or applies "/settings тишина=23-8 пояс=Europe/Berlin"
+func settingsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	if args := commandArgs(msg); args != "" {
+		if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+			sendText(ctx, b, chatID, tr(lang, "settings.admin_only"))
+			return
+		}
+		p := preferences.get(chatID)
+		if err := parseSettingsArgs(lang, args, &p); err != nil {
+			sendText(ctx, b, chatID, tr(lang, "error.parse", err.Error(), tr(lang, "settings.example")))
+			return
+		}
+		err := preferences.update(chatID, func(cur *chatPreferences) {
+			cur.Timezone, cur.QuietFrom, cur.QuietTo = p.Timezone, p.QuietFrom, p.QuietTo
+			cur.Mode, cur.LastSummary = p.Mode, p.LastSummary
+		})
+		if err != nil {
+			logError(err)
+			sendText(ctx, b, chatID, tr(lang, "error.save"))
+			return
+		}
+	}
+	text, kb := renderSettings(lang, preferences.get(chatID))
+	editOrSendMessage(ctx, b, chatID, nil, text, kb)
+}
+
+// handleSettingsCallback applies a "afisha_settings:<действие>" button and re-renders the menu
+func handleSettingsCallback(ctx context.Context, b *bot.Bot, update *models.Update) (string, *models.InlineKeyboardMarkup, bool) {
+	chatID := updateChatID(update)
+	message := update.CallbackQuery.Message.Message
+	if message != nil && !isChatAdmin(ctx, b, message.Chat, update.CallbackQuery.From.ID) {
+		return "", nil, false
+	}
+	action := strings.TrimPrefix(update.CallbackQuery.Data, "afisha_settings:")
+	kind, value, _ := strings.Cut(action, ":")
+
+	var apply func(p *chatPreferences)
+	switch kind {
+	case "quiet":
+		apply = func(p *chatPreferences) {
+			next := quietPresets[0]
+			for i, q := range quietPresets {
+				if q == [2]int{p.QuietFrom, p.QuietTo} || (i == 0 && !p.quietEnabled()) {
+					next = quietPresets[(i+1)%len(quietPresets)]
+					break
+				}
+			}
+			p.QuietFrom, p.QuietTo = next[0], next[1]
+		}
+	case "tz":
+		apply = func(p *chatPreferences) {
+			next := timezonePresets[0]
+			if i := slices.Index(timezonePresets, timezoneName(*p)); i >= 0 {
+				next = timezonePresets[(i+1)%len(timezonePresets)]
+			}
+			p.Timezone = next
+			if next == SETTINGS_DEFAULT_TIMEZONE {
+				p.Timezone = ""
+			}
+		}
+	case "mode":
+		apply = func(p *chatPreferences) {
+			if p.digestMode() {
+				p.Mode = ""
+			} else {
+				setDigestMode(p)
+			}
+		}
+	case "stream":
+		if !slices.Contains(settingsStreams, value) {
+			return "", nil, false
+		}
+		apply = func(p *chatPreferences) { p.Muted = toggle(p.Muted, value) }
+	case "event":
+		if !slices.Contains(settingsEvents, value) {
+			return "", nil, false
+		}
+		apply = func(p *chatPreferences) { p.SkipEvent = toggle(p.SkipEvent, value) }
+	default:
+		return "", nil, false
+	}
+	if err := preferences.update(chatID, apply); err != nil {
+		logError(err)
+		return "", nil, false
+	}
+	text, kb := renderSettings(langFrom(ctx), preferences.get(chatID))
+	return text, kb, true
+}
+
+// toggle adds value to list or removes it when present
+func toggle(list []string, value string) []string {
+	if i := slices.Index(list, value); i >= 0 {
+		return slices.Delete(list, i, i+1)
+	}
+	return append(list, value)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const vladivostok = "Asia/Vladivostok" // UTC+10 круглый год, в отличие от Москвы на 7 часов
+
+// utc builds a moment on 18 October 2026 at the given UTC time
+func utc(hour, minute int) time.Time {
+	return time.Date(2026, time.October, 18, hour, minute, 0, 0, time.UTC)
+}
+
+func TestInQuietHours(t *testing.T) {
+	tests := []struct {
+		name string
+		p    chatPreferences
+		now  time.Time
+		want bool
+	}{
+		{"off", chatPreferences{}, utc(23, 0), false},
+		{"off with equal hours", chatPreferences{QuietFrom: 8, QuietTo: 8}, utc(5, 0), false},
+
+		// Москва, 23–8 через полночь; MSK = UTC+3
+		{"moscow before start", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(19, 59), false},
+		{"moscow at start", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(20, 0), true},
+		{"moscow after midnight", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(1, 0), true},
+		{"moscow last minute", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(4, 59), true},
+		{"moscow at end", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(5, 0), false},
+
+		// Москва, 0–10 от полуночи
+		{"moscow from midnight", chatPreferences{QuietFrom: 0, QuietTo: 10}, utc(21, 0), true},
+		{"moscow evening before midnight", chatPreferences{QuietFrom: 0, QuietTo: 10}, utc(20, 59), false},
+
+		// Владивосток, 23–8; VLAT = UTC+10
+		{"vladivostok at start", chatPreferences{Timezone: vladivostok, QuietFrom: 23, QuietTo: 8}, utc(13, 0), true},
+		{"vladivostok before start", chatPreferences{Timezone: vladivostok, QuietFrom: 23, QuietTo: 8}, utc(12, 59), false},
+		{"vladivostok last minute", chatPreferences{Timezone: vladivostok, QuietFrom: 23, QuietTo: 8}, utc(21, 59), true},
+		{"vladivostok at end", chatPreferences{Timezone: vladivostok, QuietFrom: 23, QuietTo: 8}, utc(22, 0), false},
+		// 23:00 UTC — ночь в Москве, но утро во Владивостоке
+		{"moscow night", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(23, 0), true},
+		{"vladivostok morning", chatPreferences{Timezone: vladivostok, QuietFrom: 23, QuietTo: 8}, utc(23, 0), false},
+
+		{"unknown zone falls back to moscow", chatPreferences{Timezone: "Mars/Olympus", QuietFrom: 23, QuietTo: 8}, utc(20, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.inQuietHours(tt.now); got != tt.want {
+				t.Errorf("inQuietHours(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummaryTime(t *testing.T) {
+	tests := []struct {
+		name string
+		p    chatPreferences
+		now  time.Time
+		want time.Time // в UTC
+	}{
+		{"moscow without quiet hours", chatPreferences{Mode: deliveryDigest}, utc(12, 0), utc(6, 0)},
+		{"moscow at the end of quiet hours", chatPreferences{Mode: deliveryDigest, QuietFrom: 23, QuietTo: 8}, utc(12, 0), utc(5, 0)},
+		{"vladivostok without quiet hours", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok}, utc(12, 0), utc(23, 0).AddDate(0, 0, -1)},
+		// 22:00 UTC — во Владивостоке уже 19 октября
+		{"vladivostok next local day", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok, QuietFrom: 22, QuietTo: 9}, utc(22, 0), utc(23, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.summaryTime(tt.now); !got.Equal(tt.want) {
+				t.Errorf("summaryTime = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHeldDue(t *testing.T) {
+	held := []PerformanceChange{{Title: "Ревизор", Event: ChangeOnSale}}
+	alerts := []string{"Чайка"}
+	tests := []struct {
+		name string
+		p    chatPreferences
+		now  time.Time
+		want bool
+	}{
+		{"nothing held", chatPreferences{QuietFrom: 23, QuietTo: 8}, utc(12, 0), false},
+		{"changes outside quiet hours", chatPreferences{QuietFrom: 23, QuietTo: 8, Held: held}, utc(5, 0), true},
+		{"changes in quiet hours", chatPreferences{QuietFrom: 23, QuietTo: 8, Held: held}, utc(4, 59), false},
+		{"alerts in quiet hours across midnight", chatPreferences{QuietFrom: 23, QuietTo: 8, HeldAlerts: alerts}, utc(22, 0), false},
+
+		// Сводка без тихих часов — в 9:00 по Москве
+		{"digest before 9 msk", chatPreferences{Mode: deliveryDigest, Held: held}, utc(5, 59), false},
+		{"digest at 9 msk", chatPreferences{Mode: deliveryDigest, Held: held}, utc(6, 0), true},
+		{"digest already sent today", chatPreferences{Mode: deliveryDigest, Held: held, LastSummary: utc(6, 1)}, utc(12, 0), false},
+		{"digest sent yesterday", chatPreferences{Mode: deliveryDigest, Held: held, LastSummary: utc(6, 0).AddDate(0, 0, -1)}, utc(12, 0), true},
+		{"digest alerts go out at once", chatPreferences{Mode: deliveryDigest, Held: held, HeldAlerts: alerts}, utc(5, 0), true},
+
+		// Сводка в конце тихих часов 23–8 по Владивостоку: 22:00 UTC
+		{"digest in vladivostok quiet hours", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok, QuietFrom: 23, QuietTo: 8, Held: held}, utc(21, 59), false},
+		{"digest at the end of vladivostok quiet hours", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok, QuietFrom: 23, QuietTo: 8, Held: held}, utc(22, 0), true},
+		{"digest alerts wait for vladivostok morning", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok, QuietFrom: 23, QuietTo: 8, HeldAlerts: alerts}, utc(13, 30), false},
+		// В один и тот же момент московская сводка еще не отправлялась, а владивостокская за этот день уже ушла
+		{"same moment in moscow", chatPreferences{Mode: deliveryDigest, QuietFrom: 23, QuietTo: 8, Held: held}, utc(12, 0), true},
+		{"same moment in vladivostok", chatPreferences{Mode: deliveryDigest, Timezone: vladivostok, QuietFrom: 23, QuietTo: 8, Held: held, LastSummary: utc(22, 0).AddDate(0, 0, -1)}, utc(12, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.heldDue(tt.now); got != tt.want {
+				t.Errorf("heldDue(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+// heldChange is a change to hold; titles keep dedup keys apart
+func heldChange(title, dt string) PerformanceChange {
+	return PerformanceChange{
+		Event:       ChangeOnSale,
+		Title:       title,
+		Start:       time.Date(2026, time.November, 20, 19, 0, 0, 0, time.UTC),
+		Stage:       "Основная сцена",
+		StageUID:    "main",
+		DateTimeKey: dt,
+		NewOnSale:   true,
+	}
+}
+
+func TestSendHeldKeepsNewlyHeld(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		now        time.Time
+		sent       []string // что ушло в очередь
+		held       string   // что осталось отложенным: изменения / оповещения
+		summarized bool     // LastSummary = now
+	}{
+		{
+			name:       "immediate mode",
+			now:        utc(12, 0),
+			sent:       []string{"Ревизор", "Чайка", "оповещение 1"},
+			held:       "Гамлет / оповещение 2",
+			summarized: true,
+		},
+		{
+			// До сводки уходят только оповещения, изменения ждут вместе с новыми
+			name: "digest before the summary",
+			mode: deliveryDigest,
+			now:  utc(5, 0),
+			sent: []string{"оповещение 1"},
+			held: "Ревизор Чайка Гамлет / оповещение 2",
+		},
+		{
+			name:       "digest at the summary",
+			mode:       deliveryDigest,
+			now:        utc(6, 0),
+			sent:       []string{"Ревизор", "Чайка", "оповещение 1"},
+			held:       "Гамлет / оповещение 2",
+			summarized: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withChatStores(t)
+			const chatID = 10
+			err := preferences.update(chatID, func(p *chatPreferences) { p.Mode = tt.mode })
+			if err == nil {
+				err = preferences.hold(chatID, []PerformanceChange{heldChange("Ревизор", "a"), heldChange("Чайка", "b")}, []string{"оповещение 1"})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := preferences.get(chatID)
+			// Пока снимок отправляется, откладываются новые уведомления
+			if err := preferences.hold(chatID, []PerformanceChange{heldChange("Гамлет", "c")}, []string{"оповещение 2"}); err != nil {
+				t.Fatal(err)
+			}
+
+			sendHeld(p, tt.now)
+
+			text := strings.Join(queuedTexts(), "\n")
+			for _, want := range tt.sent {
+				if !strings.Contains(text, want) {
+					t.Errorf("queued message has no %q:\n%s", want, text)
+				}
+			}
+			for _, unwanted := range []string{"Гамлет", "оповещение 2"} {
+				if strings.Contains(text, unwanted) {
+					t.Errorf("queued message has %q held after the snapshot:\n%s", unwanted, text)
+				}
+			}
+
+			cur := preferences.get(chatID)
+			var titles []string
+			for _, ch := range cur.Held {
+				titles = append(titles, ch.Title)
+			}
+			if got := strings.Join(titles, " ") + " / " + strings.Join(cur.HeldAlerts, " "); got != tt.held {
+				t.Errorf("held = %q, want %q", got, tt.held)
+			}
+			if cur.LastSummary.Equal(tt.now) != tt.summarized {
+				t.Errorf("last summary = %v", cur.LastSummary)
+			}
+		})
+	}
+}
+
+func TestSendHeldForgottenChat(t *testing.T) {
+	withChatStores(t)
+	const chatID = 11
+	if err := preferences.hold(chatID, []PerformanceChange{heldChange("Ревизор", "a")}, []string{"оповещение"}); err != nil {
+		t.Fatal(err)
+	}
+	p := preferences.get(chatID)
+	// Бота удалили из чата, пока отложенное отправлялось
+	forgetChat(chatID)
+
+	sendHeld(p, utc(12, 0))
+	if got := preferences.get(chatID); len(got.Held) != 0 || len(got.HeldAlerts) != 0 || !got.isDefault() {
+		t.Errorf("forgotten chat came back: %+v", got)
+	}
+}
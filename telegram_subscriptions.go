@@ -0,0 +1,398 @@
+// Package main содержит подписки чатов на изменения афиши.
+//
+// Этот файл реализует:
+// - subscriptionStore - подписанные чаты (личные и группы), хранятся в storage.dir/subscriptions.json
+// - /subscribe и /unsubscribe - в группе их может выполнить только администратор
+// - /maxprice - не присылать начало продаж, если самый дешевый билет дороже заданной суммы
+// - /email - дублировать уведомления чата письмом на заданный адрес
+// - telegramNotifier - постановка новых дат и начала продаж в очередь подписанного чата
+// - renderChanges() - текст уведомления об изменениях
+//
+// Взаимодействует с:
+// - notifier.go: runChangeNotifier() рассылает изменения через telegramNotifier
+// - storage.go: чтение и запись файла подписок
+// - telegram_commands.go: регистрация команд и проверка прав в группе
+// - vakhtangov_tickets.go: цены и свободные места для уведомлений о начале продаж
+// - telegram_outbox.go: очередь доставки, повторы и отписка недоступных чатов
+// - telegram_settings.go: тихие часы, режим сводкой и выключенные типы изменений
+// - telegram_lang.go: уведомления приходят на языке чата
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// chatSubscription — чат, который получает уведомления об изменениях афиши
+type chatSubscription struct {
+	ChatID int64     `json:"chat_id"`
+	Title  string    `json:"title,omitempty"`
+	Since  time.Time `json:"since"`
+	// MaxPrice — не присылать начало продаж, если самый дешевый билет дороже; 0 — без ограничения
+	MaxPrice int `json:"max_price,omitempty"`
+	// Email — адрес, на который уведомления чата дублируются письмом с теми же фильтрами; пусто — без писем
+	Email string `json:"email,omitempty"`
+}
+
+type subscriptionStore struct {
+	mu    sync.Mutex
+	path  string
+	chats map[int64]chatSubscription
+}
+
+var subscriptions *subscriptionStore
+
+// newSubscriptionStore loads subscriptions from path; a missing file means no subscriptions
+func newSubscriptionStore(path string) (*subscriptionStore, error) {
+	var list []chatSubscription
+	if err := readJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	s := &subscriptionStore{path: path, chats: make(map[int64]chatSubscription, len(list))}
+	for _, sub := range list {
+		s.chats[sub.ChatID] = sub
+	}
+	return s, nil
+}
+
+// add subscribes the chat; added is false when it was already subscribed
+func (s *subscriptionStore) add(chatID int64, title string) (added bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; ok {
+		return false, nil
+	}
+	s.chats[chatID] = chatSubscription{ChatID: chatID, Title: title, Since: time.Now()}
+	return true, s.saveLocked()
+}
+
+// remove unsubscribes the chat; removed is false when it was not subscribed
+func (s *subscriptionStore) remove(chatID int64) (removed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[chatID]; !ok {
+		return false, nil
+	}
+	delete(s.chats, chatID)
+	return true, s.saveLocked()
+}
+
+// migrate moves a subscription when a group is upgraded to a supergroup
+func (s *subscriptionStore) migrate(oldID, newID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.chats[oldID]
+	if !ok {
+		return nil
+	}
+	delete(s.chats, oldID)
+	sub.ChatID = newID
+	s.chats[newID] = sub
+	return s.saveLocked()
+}
+
+// setMaxPrice changes the chat's price limit; ok is false when the chat is not subscribed
+func (s *subscriptionStore) setMaxPrice(chatID int64, price int) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.chats[chatID]
+	if !ok {
+		return false, nil
+	}
+	sub.MaxPrice = price
+	s.chats[chatID] = sub
+	return true, s.saveLocked()
+}
+
+// setEmail changes the chat's email address; ok is false when the chat is not subscribed
+func (s *subscriptionStore) setEmail(chatID int64, email string) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.chats[chatID]
+	if !ok {
+		return false, nil
+	}
+	sub.Email = email
+	s.chats[chatID] = sub
+	return true, s.saveLocked()
+}
+
+func (s *subscriptionStore) get(chatID int64) (chatSubscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.chats[chatID]
+	return sub, ok
+}
+
+// all returns the subscriptions in a stable order
+func (s *subscriptionStore) all() []chatSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]chatSubscription, 0, len(s.chats))
+	for _, sub := range s.chats {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ChatID < list[j].ChatID })
+	return list
+}
+
+// flush writes the store to disk again, e.g. on shutdown
+func (s *subscriptionStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk; s.mu must be held
+func (s *subscriptionStore) saveLocked() error {
+	list := make([]chatSubscription, 0, len(s.chats))
+	for _, sub := range s.chats {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ChatID < list[j].ChatID })
+	return writeJSONFile(s.path, list)
+}
+
+// chatTitle names the chat for the subscriptions file
+func chatTitle(chat models.Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	if chat.Username != "" {
+		return "@" + chat.Username
+	}
+	return strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+}
+
+func subscribeHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	lang := langFrom(ctx)
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "subscribe.admin_only"))
+		return
+	}
+	added, err := subscriptions.add(msg.Chat.ID, chatTitle(msg.Chat))
+	switch {
+	case err != nil:
+		logError(err)
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "subscribe.save_error"))
+	case !added:
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "subscribe.already"))
+	default:
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "subscribe.done"))
+	}
+}
+
+func unsubscribeHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	lang := langFrom(ctx)
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "unsubscribe.admin_only"))
+		return
+	}
+	removed, err := subscriptions.remove(msg.Chat.ID)
+	switch {
+	case err != nil:
+		logError(err)
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "subscribe.save_error"))
+	case !removed:
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "unsubscribe.not_subscribed"))
+	default:
+		sendText(ctx, b, msg.Chat.ID, tr(lang, "unsubscribe.done"))
+	}
+}
+
+// maxPriceHandler shows or changes the chat's price limit: "/maxprice 3000", "/maxprice off"
+func maxPriceHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	sub, subscribed := subscriptions.get(chatID)
+	if !subscribed {
+		sendText(ctx, b, chatID, tr(lang, "maxprice.not_subscribed"))
+		return
+	}
+	args := commandArgs(msg)
+	if args == "" {
+		if sub.MaxPrice == 0 {
+			sendText(ctx, b, chatID, tr(lang, "maxprice.none"))
+		} else {
+			sendText(ctx, b, chatID, tr(lang, "maxprice.current", sub.MaxPrice))
+		}
+		return
+	}
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, chatID, tr(lang, "maxprice.admin_only"))
+		return
+	}
+
+	price := 0
+	if args != "off" {
+		price = parsePrice(strings.TrimSuffix(args, "руб"))
+		if price <= 0 {
+			sendText(ctx, b, chatID, tr(lang, "maxprice.bad_price"))
+			return
+		}
+	}
+	if _, err := subscriptions.setMaxPrice(chatID, price); err != nil {
+		logError(err)
+		sendText(ctx, b, chatID, tr(lang, "error.save"))
+		return
+	}
+	if price == 0 {
+		sendText(ctx, b, chatID, tr(lang, "maxprice.removed"))
+		return
+	}
+	sendText(ctx, b, chatID, tr(lang, "maxprice.set", price))
+}
+
+// emailHandler shows or changes the address that gets the chat's notifications by email:
+// "/email me@example.com", "/email off"
+func emailHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+	chatID := msg.Chat.ID
+	lang := langFrom(ctx)
+	if currentConfig().Notifications.Email.SMTPHost == "" {
+		sendText(ctx, b, chatID, tr(lang, "email.disabled"))
+		return
+	}
+	sub, subscribed := subscriptions.get(chatID)
+	if !subscribed {
+		sendText(ctx, b, chatID, tr(lang, "email.not_subscribed"))
+		return
+	}
+	args := commandArgs(msg)
+	if args == "" {
+		if sub.Email == "" {
+			sendText(ctx, b, chatID, tr(lang, "email.none"))
+		} else {
+			sendText(ctx, b, chatID, tr(lang, "email.current", sub.Email))
+		}
+		return
+	}
+	if !isChatAdmin(ctx, b, msg.Chat, msg.From.ID) {
+		sendText(ctx, b, chatID, tr(lang, "email.admin_only"))
+		return
+	}
+
+	email := ""
+	if args != "off" {
+		addr, err := mail.ParseAddress(args)
+		if err != nil {
+			sendText(ctx, b, chatID, tr(lang, "email.bad_address"))
+			return
+		}
+		email = addr.Address
+	}
+	if _, err := subscriptions.setEmail(chatID, email); err != nil {
+		logError(err)
+		sendText(ctx, b, chatID, tr(lang, "error.save"))
+		return
+	}
+	if email == "" {
+		sendText(ctx, b, chatID, tr(lang, "email.removed"))
+		return
+	}
+	sendText(ctx, b, chatID, tr(lang, "email.set", email))
+}
+
+// withinMaxPrice drops sale starts whose cheapest ticket costs more than maxPrice.
+// Новые даты без продажи и сеансы с неизвестной ценой не отбрасываются.
+func withinMaxPrice(changes []PerformanceChange, maxPrice int) []PerformanceChange {
+	if maxPrice == 0 {
+		return changes
+	}
+	var out []PerformanceChange
+	for _, ch := range changes {
+		if ch.MinPrice > maxPrice {
+			continue
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+// notifiableChange reports whether subscribers should hear about the change;
+// пропажа билетов из продажи не рассылается
+func notifiableChange(ch PerformanceChange) bool {
+	return ch.Event == ChangeAdded || ch.Event == ChangeOnSale
+}
+
+// renderChanges renders one block per change
+func renderChanges(r TelegramRenderer, changes []PerformanceChange) []string {
+	blocks := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		var b strings.Builder
+		switch ch.Event {
+		case ChangeAdded:
+			b.WriteString(r.Escape(tr(r.Lang(), "changes.added")) + "\n")
+		case ChangeOnSale:
+			b.WriteString(r.Escape(tr(r.Lang(), "changes.on_sale")) + "\n")
+		}
+		b.WriteString(r.Bold(ch.Title) + "\n")
+		b.WriteString(r.Escape(sessionWhenLang(r.Lang(), ch.Start, ch.Stage)))
+		if summary := ticketSummary(r.Lang(), TicketInfo{MinPrice: ch.MinPrice, Seats: ch.SeatsLeft}); summary != "" {
+			b.WriteString("\n" + r.Escape("💰 "+summary))
+		}
+		if ch.NewOnSale && ch.BuyLink != "" {
+			b.WriteString("\n" + r.Link(tr(r.Lang(), "changes.buy"), ch.BuyLink))
+		}
+		blocks = append(blocks, b.String())
+	}
+	return blocks
+}
+
+// telegramNotifier delivers changes to a subscribed chat
+type telegramNotifier struct {
+	chatID int64
+}
+
+func (n telegramNotifier) Channel() string { return "telegram" }
+
+// Notify queues the message, or holds it for later according to the chat's /settings;
+// delivery, retries and unreachable chats are handled by the outbox
+func (n telegramNotifier) Notify(ctx context.Context, changes []PerformanceChange) error {
+	prefs := preferences.get(n.chatID)
+	if !prefs.streamEnabled(streamChanges) {
+		return nil
+	}
+	if changes = prefs.wantedChanges(changes); len(changes) == 0 {
+		return nil
+	}
+	if prefs.holdChanges(time.Now()) {
+		if err := preferences.hold(n.chatID, changes, nil); err != nil {
+			return fmt.Errorf("chat %d: %w", n.chatID, err)
+		}
+		return nil
+	}
+	r := rendererForChat(n.chatID)
+	header := r.Bold(tr(r.Lang(), "changes.title")) + "\n\n"
+	keys := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		keys = append(keys, changeDedupKey(n.chatID, ch))
+	}
+	if err := outbox.enqueue(n.chatID, header, renderChanges(r, changes), keys); err != nil {
+		return fmt.Errorf("chat %d: %w", n.chatID, err)
+	}
+	return nil
+}
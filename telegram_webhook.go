@@ -0,0 +1,166 @@
+// Package main содержит режим webhook для Telegram-бота.
+//
+// Этот файл реализует:
+// - loadWebhookConfig() - чтение настроек webhook из переменных окружения
+// - webhookHandler() - HTTP-обработчик обновлений с проверкой заголовка X-Telegram-Bot-Api-Secret-Token
+// - runWebhook() - регистрацию webhook при старте, HTTP/HTTPS-сервер и снятие webhook при остановке
+//
+// Переменные окружения:
+// - bot.mode = "webhook" в конфиге (или BOT_MODE=webhook) включает режим webhook; без него или без WEBHOOK_URL используется long polling
+// - WEBHOOK_URL - публичный адрес, который увидит Telegram (обычно за reverse proxy)
+// - WEBHOOK_LISTEN - адрес локального сервера, по умолчанию ":8080"
+// - WEBHOOK_SECRET - секрет, который Telegram передает в заголовке каждого запроса
+// - WEBHOOK_TLS_CERT, WEBHOOK_TLS_KEY - сертификат и ключ, если HTTPS терминируется самим ботом
+//
+// Локальная проверка: записанное обновление можно отправить прямо в обработчик
+//
+//	curl -X POST -H "X-Telegram-Bot-Api-Secret-Token: $WEBHOOK_SECRET" \
+//	     --data @testdata/telegram_update.json http://localhost:8080/telegram
+//
+// То же обновление отправляет в webhookHandler() тест telegram_webhook_test.go.
+//
+// Взаимодействует с:
+// - telegram.go: RunTelegramBot() выбирает между runWebhook() и long polling
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"parser/logger"
+
+	"github.com/go-telegram/bot"
+)
+
+// WEBHOOK_SHUTDOWN_TIMEOUT — сколько ждать завершения HTTP-сервера и снятия webhook
+const WEBHOOK_SHUTDOWN_TIMEOUT = 10 * time.Second
+
+type webhookConfig struct {
+	URL     string
+	Path    string
+	Listen  string
+	Secret  string
+	TLSCert string
+	TLSKey  string
+}
+
+// loadWebhookConfig reads webhook settings; ok is false when polling should be used
+func loadWebhookConfig() (webhookConfig, bool, error) {
+	if currentConfig().Bot.Mode != "webhook" {
+		return webhookConfig{}, false, nil
+	}
+	cfg := webhookConfig{
+		URL:     os.Getenv("WEBHOOK_URL"),
+		Listen:  os.Getenv("WEBHOOK_LISTEN"),
+		Secret:  os.Getenv("WEBHOOK_SECRET"),
+		TLSCert: os.Getenv("WEBHOOK_TLS_CERT"),
+		TLSKey:  os.Getenv("WEBHOOK_TLS_KEY"),
+	}
+	if cfg.URL == "" {
+		log.Warn("Webhook mode is enabled but WEBHOOK_URL is not set, falling back to long polling")
+		return webhookConfig{}, false, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return webhookConfig{}, false, fmt.Errorf("invalid WEBHOOK_URL: %w", err)
+	}
+	cfg.Path = u.Path
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":8080"
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return webhookConfig{}, false, errors.New("WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY must be set together")
+	}
+	logger.AddSecret(cfg.Secret)
+	if cfg.Secret == "" {
+		log.Warn("WEBHOOK_SECRET is not set, webhook requests are not authenticated")
+	}
+	return cfg, true, nil
+}
+
+// webhookHandler accepts Telegram updates and rejects requests with a wrong secret
+func webhookHandler(b *bot.Bot, secret string) http.Handler {
+	updates := b.WebhookHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			log.Warnw("Webhook request with invalid secret", "remote_addr", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		updates(w, r)
+	})
+}
+
+// runWebhook registers the webhook, serves updates until ctx is done and deregisters it
+func runWebhook(ctx context.Context, b *bot.Bot, cfg webhookConfig) error {
+	if _, err := b.SetWebhook(ctx, &bot.SetWebhookParams{
+		URL:         cfg.URL,
+		SecretToken: cfg.Secret,
+	}); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	log.Infow("Webhook registered", "path", cfg.Path, "listen", cfg.Listen)
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, webhookHandler(b, cfg.Secret))
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSCert != "" {
+			err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	// Обработчики живут дольше ctx: принятые с ответом 200 обновления должны быть обработаны,
+	// пока server.Shutdown() дожидается текущих запросов
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go b.StartWebhook(workersCtx)
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		err = fmt.Errorf("webhook server failed: %w", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), WEBHOOK_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Errorf("Error shutting down webhook server: %v", shutdownErr)
+	}
+	stopWorkers()
+	if _, delErr := b.DeleteWebhook(shutdownCtx, &bot.DeleteWebhookParams{}); delErr != nil {
+		log.Errorf("Error deleting webhook: %v", delErr)
+	} else {
+		log.Info("Webhook deregistered")
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	update, err := os.ReadFile("testdata/telegram_update.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *models.Update, 1)
+	b, err := bot.New("123456:test-token",
+		bot.WithSkipGetMe(),
+		bot.WithDefaultHandler(func(_ context.Context, _ *bot.Bot, u *models.Update) { received <- u }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.StartWebhook(ctx)
+
+	handler := webhookHandler(b, "s3cret")
+	post := func(secret string) int {
+		req := httptest.NewRequest(http.MethodPost, "/telegram", bytes.NewReader(update))
+		if secret != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, secret := range []string{"", "wrong"} {
+		if code := post(secret); code != http.StatusUnauthorized {
+			t.Errorf("secret %q: status %d, want 401", secret, code)
+		}
+	}
+	select {
+	case u := <-received:
+		t.Fatalf("update %d passed without a valid secret", u.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Fatalf("valid secret: status %d, want 200", code)
+	}
+	select {
+	case u := <-received:
+		if u.ID != 875310201 || u.Message == nil || u.Message.Text != "/start" || u.Message.From.ID != 100200300 {
+			t.Errorf("unexpected update: %+v", u)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("update did not reach the bot handler")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/telegram", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
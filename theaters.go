@@ -0,0 +1,408 @@
+// Package main содержит афиши других театров Москвы и Петербурга, подключаемые конфигом.
+//
+// Этот файл реализует:
+// - theaterProviders - форматы афиш: "ticketland" (лента ticketland_afisha/data.json, см. ticketland.go) и "jsonld" (события schema.org в <script type="application/ld+json">)
+// - fetchTheater() - загрузка и разбор афиши одного театра из providers.theaters в []Show
+// - loadSource() - загрузка афиши или ленты по http(s) или чтение сохраненной копии по file://
+// - theaterCities - города в порядке групп меню бота
+// - printTheaters() - команда "showsparser theaters [id]" для проверки разбора в консоли
+//
+// Новый формат афиши сначала сохраняется в testdata/ и разбирается с url вида
+// "file://testdata/<файл>", а когда разбор совпадает с сайтом, url меняется на настоящий.
+// Сохраненные афиши театров из config.json перечислены в testdata/config.theaters.json.
+// Цены и места со страниц покупки, фильтры и журнал изменений пока есть только у Вахтангова.
+//
+// Взаимодействует с:
+// - config.go: providers.theaters и проверка id, города и формата
+// - ticketland.go: ticketlandFeed загружает ленту Ticketland и собирает ссылки покупки по шаблону из конфига
+// - afisha_cache.go: cache.Theater() хранит афишу каждого театра, фоновое обновление загружает их все
+// - telegram.go: меню афиш сгруппировано по городам, кнопка театра — "afisha_theater:<id>"
+// - metrics.go: загрузки помечаются провайдером "theater_<id>"
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"parser/logger"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// THEATER_ID_MAX_LEN — длина id театра, при которой "afisha_show:afisha_theater:<id>:<номер>"
+// укладывается в 64 байта данных кнопки Telegram
+const THEATER_ID_MAX_LEN = 24
+
+// THEATER_SOURCE_LIMIT — предел размера одной афиши, чтобы ошибка сайта не съела память
+const THEATER_SOURCE_LIMIT = 10 << 20
+
+var theaterIDPattern = regexp.MustCompile(fmt.Sprintf(`^[a-z0-9_-]{1,%d}$`, THEATER_ID_MAX_LEN))
+
+// theaterCities — города в порядке групп меню; Вахтангов в Москве, балет Якобсона в Петербурге
+var theaterCities = []string{"moscow", "spb"}
+
+// theaterProvider loads and parses the afisha of one theater
+type theaterProvider func(ctx context.Context, t TheaterConfig) ([]Show, error)
+
+var theaterProviders = map[string]theaterProvider{
+	"ticketland": fetchTicketlandTheater,
+	"jsonld":     fetchJSONLDTheater,
+}
+
+// theaterProviderNames lists the known afisha formats for error messages
+func theaterProviderNames() []string {
+	names := make([]string, 0, len(theaterProviders))
+	for name := range theaterProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// theaterMetricsLabel is the provider label of a theater in metrics and /readyz
+func theaterMetricsLabel(t TheaterConfig) string {
+	return "theater_" + t.ID
+}
+
+// findTheater looks a configured theater up by id
+func findTheater(id string) (TheaterConfig, bool) {
+	for _, t := range currentConfig().Providers.Theaters {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return TheaterConfig{}, false
+}
+
+// fetchTheater loads the afisha of t with its provider; shows and sessions are sorted
+func fetchTheater(ctx context.Context, t TheaterConfig) ([]Show, error) {
+	provider, ok := theaterProviders[t.Provider]
+	if !ok {
+		return nil, fmt.Errorf("theater %s: unknown provider %q", t.ID, t.Provider)
+	}
+	shows, err := provider(logger.WithProvider(ctx, theaterMetricsLabel(t)), t)
+	if err != nil {
+		return nil, fmt.Errorf("theater %s: %w", t.ID, err)
+	}
+	sort.Slice(shows, func(i, j int) bool { return shows[i].Title < shows[j].Title })
+	for _, sh := range shows {
+		sort.SliceStable(sh.Info, func(i, j int) bool { return sh.Info[i].Start.Before(sh.Info[j].Start) })
+	}
+	return shows, nil
+}
+
+// loadSource reads an afisha from an http(s) URL or from a saved copy at file://<path>;
+// provider is the label of the fetch in metrics
+func loadSource(ctx context.Context, provider, rawURL string) ([]byte, error) {
+	if path, ok := strings.CutPrefix(rawURL, "file://"); ok {
+		return os.ReadFile(path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, currentConfig().Timeouts.Fetch.Duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", rawURL, err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	observeFetch(provider, start, resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to load %s: status %d", rawURL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, THEATER_SOURCE_LIMIT))
+}
+
+// theaterFeed is the Ticketland feed of a theater from providers.theaters
+func theaterFeed(t TheaterConfig) ticketlandFeed {
+	return ticketlandFeed{provider: theaterMetricsLabel(t), url: t.URL, site: t.TicketlandSiteConfig}
+}
+
+// fetchTicketlandTheater reads a ticketland_afisha/data.json feed
+func fetchTicketlandTheater(ctx context.Context, t TheaterConfig) ([]Show, error) {
+	feed := theaterFeed(t)
+	entries, err := feed.Sessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return feed.Shows(entries, t.Stages), nil
+}
+
+// fetchJSONLDTheater reads schema.org events from an afisha page
+func fetchJSONLDTheater(ctx context.Context, t TheaterConfig) ([]Show, error) {
+	body, err := loadSource(ctx, theaterMetricsLabel(t), t.URL)
+	if err != nil {
+		return nil, err
+	}
+	shows, err := parseJSONLDAfisha(body, t.URL)
+	if err != nil {
+		parseFailures.WithLabelValues(theaterMetricsLabel(t)).Inc()
+		return nil, err
+	}
+	return shows, nil
+}
+
+// parseJSONLDAfisha collects events from every ld+json block of the page into shows by title.
+// Блоки, которые не разбираются как JSON, пропускаются; ошибка — только если событий нет совсем.
+func parseJSONLDAfisha(body []byte, pageURL string) ([]Show, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pageURL, err)
+	}
+
+	var events []map[string]any
+	var badBlocks int
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var v any
+		if err := json.Unmarshal([]byte(s.Text()), &v); err != nil {
+			badBlocks++
+			return
+		}
+		collectJSONLDEvents(v, &events)
+	})
+
+	byTitle := make(map[string]*Show)
+	var order []string
+	seen := make(map[string]bool)
+	for _, ev := range events {
+		title, inf, ok := jsonldSession(ev, pageURL)
+		if !ok {
+			continue
+		}
+		// Одно событие часто встречается на странице дважды: в списке и в @graph
+		key := title + "/" + inf.DateTimeKey + "/" + inf.Stage
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		sh, found := byTitle[title]
+		if !found {
+			sh = &Show{Title: title, URL: resolveURL(pageURL, jsonldString(ev["url"]))}
+			byTitle[title] = sh
+			order = append(order, title)
+		}
+		sh.Info = append(sh.Info, inf)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("no events found on %s (%d broken ld+json blocks)", pageURL, badBlocks)
+	}
+
+	shows := make([]Show, 0, len(order))
+	for _, title := range order {
+		shows = append(shows, *byTitle[title])
+	}
+	return shows, nil
+}
+
+// collectJSONLDEvents walks arrays, @graph and item lists looking for objects typed *Event
+func collectJSONLDEvents(v any, out *[]map[string]any) {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			collectJSONLDEvents(item, out)
+		}
+	case map[string]any:
+		if isJSONLDEvent(v["@type"]) {
+			*out = append(*out, v)
+			return
+		}
+		for _, key := range []string{"@graph", "itemListElement", "item", "subEvent", "event"} {
+			if child, ok := v[key]; ok {
+				collectJSONLDEvents(child, out)
+			}
+		}
+	}
+}
+
+// isJSONLDEvent accepts Event, TheaterEvent, DanceEvent and other schema.org event types
+func isJSONLDEvent(t any) bool {
+	switch t := t.(type) {
+	case string:
+		return strings.HasSuffix(t, "Event")
+	case []any:
+		for _, item := range t {
+			if isJSONLDEvent(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonldSession converts one event into a session; events without a name or a date are skipped
+func jsonldSession(ev map[string]any, pageURL string) (string, ShowInfo, bool) {
+	title := strings.TrimSpace(html.UnescapeString(jsonldString(ev["name"])))
+	start, ok := parseJSONLDDate(jsonldString(ev["startDate"]))
+	if title == "" || !ok {
+		return "", ShowInfo{}, false
+	}
+
+	var stage string
+	switch loc := ev["location"].(type) {
+	case string:
+		stage = loc
+	case map[string]any:
+		stage = jsonldString(loc["name"])
+	}
+
+	offers := jsonldOffers(ev["offers"])
+	buyLink, canBuy, price := "", false, 0
+	for _, o := range offers {
+		if !jsonldAvailable(jsonldString(o["availability"])) {
+			continue
+		}
+		canBuy = true
+		if buyLink == "" {
+			buyLink = resolveURL(pageURL, jsonldString(o["url"]))
+		}
+		price = minPrice(price, minPrice(jsonldPrice(o["lowPrice"]), jsonldPrice(o["price"])))
+	}
+	if canBuy && buyLink == "" {
+		buyLink = resolveURL(pageURL, jsonldString(ev["url"]))
+	}
+
+	inf := ShowInfo{
+		Date:    stringifyDateWithYear(start),
+		Weekday: weekdayRu(start.Weekday()),
+		Time:    start.Format("15:04"),
+		Stage:   strings.TrimSpace(html.UnescapeString(stage)),
+		CanBuy:  canBuy,
+		BuyLink: buyLink,
+
+		Start:       start,
+		DateTimeKey: start.Format("2006-01-02-15-04-05"),
+	}
+	if price > 0 {
+		inf.Tickets = &TicketInfo{MinPrice: price}
+	}
+	return title, inf, true
+}
+
+// parseJSONLDDate reads startDate as Moscow wall clock labelled UTC, like dates from the Ticketland feed.
+// Дата без часового пояса считается московской.
+func parseJSONLDDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return mskWallClock(t), true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// jsonldOffers accepts a single offer, a list of offers or an AggregateOffer with nested offers
+func jsonldOffers(v any) []map[string]any {
+	var out []map[string]any
+	switch v := v.(type) {
+	case map[string]any:
+		out = append(out, v)
+		if nested, ok := v["offers"]; ok {
+			out = append(out, jsonldOffers(nested)...)
+		}
+	case []any:
+		for _, item := range v {
+			out = append(out, jsonldOffers(item)...)
+		}
+	}
+	return out
+}
+
+// jsonldAvailable treats a missing availability as "on sale": many sites omit it
+func jsonldAvailable(availability string) bool {
+	if availability == "" {
+		return true
+	}
+	for _, status := range []string{"InStock", "LimitedAvailability", "PreOrder", "PreSale", "OnlineOnly"} {
+		if strings.HasSuffix(availability, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonldPrice reads a price written as a number or as a string like "1500.00"
+func jsonldPrice(v any) int {
+	switch v := v.(type) {
+	case float64:
+		return int(v)
+	case string:
+		return parsePrice(v)
+	}
+	return 0
+}
+
+// jsonldString returns v if it is a string, otherwise ""
+func jsonldString(v any) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// resolveURL makes a link from the page absolute; links in a saved copy (file://) stay as is
+func resolveURL(pageURL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil || base.Scheme == "file" {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// printTheaters prints the afisha of configured theaters, or of one theater, to the console
+func printTheaters(ctx context.Context, id string) error {
+	theaters := currentConfig().Providers.Theaters
+	if id != "" {
+		t, ok := findTheater(id)
+		if !ok {
+			return fmt.Errorf("theater %q is not in providers.theaters", id)
+		}
+		theaters = []TheaterConfig{t}
+	}
+	if len(theaters) == 0 {
+		return fmt.Errorf("providers.theaters is empty")
+	}
+
+	var failed int
+	for _, t := range theaters {
+		shows, err := fetchTheater(ctx, t)
+		if err != nil {
+			logError(err)
+			failed++
+			continue
+		}
+		fmt.Printf("== %s (%s, %s): %d спектаклей, %d сеансов\n\n", t.Name, t.City, t.Provider, len(shows), countSessions(shows))
+		for _, sh := range shows {
+			fmt.Println(formatShowConsole(sh))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d theaters failed", failed, len(theaters))
+	}
+	return nil
+}
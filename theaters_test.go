@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTheatersConfig loads testdata/config.theaters.json, the theaters of config.json with saved afishas
+func withTheatersConfig(t *testing.T) {
+	t.Helper()
+	cfg, err := loadAppConfig("testdata/config.theaters.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := appConfig.Load()
+	appConfig.Store(cfg)
+	t.Cleanup(func() { appConfig.Store(prev) })
+}
+
+// sessionLine describes a session in one line for comparisons
+func sessionLine(inf ShowInfo) string {
+	line := fmt.Sprintf("%s %s %s buy=%v %s", inf.Start.Format("2006-01-02 15:04"), inf.Time, inf.Stage, inf.CanBuy, inf.BuyLink)
+	if inf.Tickets != nil {
+		line += fmt.Sprintf(" from=%d", inf.Tickets.MinPrice)
+	}
+	return line
+}
+
+// showLines lists shows as "title: session; session"
+func showLines(shows []Show) []string {
+	var out []string
+	for _, sh := range shows {
+		sessions := make([]string, 0, len(sh.Info))
+		for _, inf := range sh.Info {
+			sessions = append(sessions, sessionLine(inf))
+		}
+		out = append(out, sh.Title+": "+strings.Join(sessions, "; "))
+	}
+	return out
+}
+
+func compareLines(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDecodeTicketlandFeed(t *testing.T) {
+	f, err := os.Open("testdata/ticketland_afisha.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	createdAt, entries, err := decodeTicketlandFeed(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !createdAt.Equal(time.Date(2026, time.October, 18, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("createdAt = %v", createdAt)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("got %d sessions, want 5", len(entries))
+	}
+	for _, e := range entries {
+		if e.Start.Format("2006-01-02-15-04-05") != e.DateTimeKey {
+			t.Errorf("session %s starts at %v", e.DateTimeKey, e.Start)
+		}
+		// Сеанс, продажа которого откроется позже: reveal_dt сохраняется как есть
+		if e.DateTimeKey == "2026-12-01-19-30-00" {
+			if e.Detail.RevealDT != "2026-11-01 12:00:00" || e.Detail.RevealDTStr != "1 ноября" || e.Detail.SalesOn || e.Detail.HasTickets {
+				t.Errorf("reveal_dt session = %+v", e.Detail)
+			}
+		}
+	}
+
+	if _, _, err := decodeTicketlandFeed(strings.NewReader(`{"data": "not json"}`)); err == nil {
+		t.Error("a broken data field is accepted")
+	}
+}
+
+func TestTicketlandTheaterFixture(t *testing.T) {
+	theater := TheaterConfig{
+		ID:       "ticketland_sample",
+		Provider: "ticketland",
+		URL:      "file://testdata/ticketland_afisha.json",
+		Stages:   map[string]string{"a1b2c3d4-main": "Основная сцена", "e5f6a7b8-small": "Малая сцена"},
+		TicketlandSiteConfig: TicketlandSiteConfig{
+			BaseURL: "https://theatre.example/",
+			BuyLink: "/buy/?datetime={datetime}&stageuid={stageuid}",
+		},
+	}
+	shows, err := fetchTheater(context.Background(), theater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Спектакли по названию, сеансы по времени; сеанс с reveal_dt не продается и остается без ссылки
+	compareLines(t, showLines(shows), []string{
+		"Вишнёвый сад: " +
+			"2026-11-14 19:00 19:00 Основная сцена buy=true https://theatre.example/buy/?datetime=2026-11-14-19-00-00&stageuid=a1b2c3d4-main; " +
+			"2026-11-21 19:00 19:00 Основная сцена buy=false ",
+		"Снежная королева: " +
+			"2026-11-15 12:00 12:00 Основная сцена buy=true https://theatre.example/buy/?datetime=2026-11-15-12-00-00&stageuid=a1b2c3d4-main",
+		"Чайка: " +
+			"2026-11-16 19:30 19:30 Малая сцена buy=true https://theatre.example/buy/?datetime=2026-11-16-19-30-00&stageuid=e5f6a7b8-small; " +
+			"2026-12-01 19:30 19:30 Малая сцена buy=false ",
+	})
+	if inf := shows[0].Info[0]; inf.Date != "14 ноября 2026" || inf.Weekday != "Суббота" || inf.StageUID != "a1b2c3d4-main" {
+		t.Errorf("first session = %+v", inf)
+	}
+}
+
+func TestTicketlandFeedBuyLink(t *testing.T) {
+	tests := []struct {
+		name string
+		feed ticketlandFeed
+		want string
+	}{
+		{
+			name: "default template on the feed host",
+			feed: ticketlandFeed{url: "https://vakhtangov.ru/ticketland_afisha/data.json"},
+			want: "https://vakhtangov.ru/tickets/buy/?datetime=2026-11-14-19-00-00&stageuid=a+b",
+		},
+		{
+			name: "base_url with a path",
+			feed: ticketlandFeed{url: "file://testdata/ticketland_afisha.json", site: TicketlandSiteConfig{BaseURL: "https://theatre.example/moscow/", BuyLink: "buy?dt={datetime}&s={stageuid}"}},
+			want: "https://theatre.example/moscow/buy?dt=2026-11-14-19-00-00&s=a+b",
+		},
+		{
+			name: "saved copy without base_url",
+			feed: ticketlandFeed{url: "file://testdata/ticketland_afisha.json"},
+			want: "",
+		},
+		{
+			name: "absolute template for a saved copy",
+			feed: ticketlandFeed{url: "file://testdata/ticketland_afisha.json", site: TicketlandSiteConfig{BuyLink: "https://tickets.example/{stageuid}/{datetime}"}},
+			want: "https://tickets.example/a+b/2026-11-14-19-00-00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.feed.BuyLink(" a b ", "2026-11-14-19-00-00"); got != tt.want {
+				t.Errorf("BuyLink = %q, want %q", got, tt.want)
+			}
+			if got := tt.feed.BuyLink("", "2026-11-14-19-00-00"); got != "" {
+				t.Errorf("BuyLink without a stage = %q", got)
+			}
+		})
+	}
+}
+
+func TestParseJSONLDAfisha(t *testing.T) {
+	body, err := os.ReadFile("testdata/afisha_jsonld.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shows, err := parseJSONLDAfisha(body, "https://theatre.example/afisha/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ревизор 20.11 есть и в @graph, и в списке — остается один сеанс; событие без даты пропускается.
+	// 27.11 записан без часового пояса и считается московским, билеты на него распроданы.
+	compareLines(t, showLines(shows), []string{
+		"Ревизор: " +
+			"2026-11-20 19:00 19:00 Основная сцена buy=true https://theatre.example/tickets/revizor-2026-11-20/ from=1500; " +
+			"2026-11-27 19:00 19:00 Основная сцена buy=false ",
+		"Жизель: " +
+			"2026-12-05 18:00 18:00 Малая сцена buy=true https://tickets.example/giselle/1205 from=2800",
+	})
+	if shows[0].URL != "https://theatre.example/afisha/revizor/" || shows[1].URL != "https://theatre.example/afisha/giselle/" {
+		t.Errorf("show URLs = %q, %q", shows[0].URL, shows[1].URL)
+	}
+
+	if _, err := parseJSONLDAfisha([]byte(`<script type="application/ld+json">{ broken</script>`), "https://theatre.example/"); err == nil {
+		t.Error("a page without events is accepted")
+	}
+}
+
+func TestJSONLDTheaterFixture(t *testing.T) {
+	theater := TheaterConfig{ID: "jsonld_sample", Provider: "jsonld", URL: "file://testdata/afisha_jsonld.html"}
+	shows, err := fetchTheater(context.Background(), theater)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// В сохраненной копии относительные ссылки не дополняются; спектакли отсортированы по названию
+	compareLines(t, showLines(shows), []string{
+		"Жизель: 2026-12-05 18:00 18:00 Малая сцена buy=true https://tickets.example/giselle/1205 from=2800",
+		"Ревизор: " +
+			"2026-11-20 19:00 19:00 Основная сцена buy=true /tickets/revizor-2026-11-20/ from=1500; " +
+			"2026-11-27 19:00 19:00 Основная сцена buy=false ",
+	})
+}
+
+func TestRealTheaterFixtures(t *testing.T) {
+	withTheatersConfig(t)
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{
+			// Список событий в ItemList, ссылки покупки относительные
+			id: "maly",
+			want: []string{
+				"Горе от ума: 2026-11-20 19:00 19:00 Историческая сцена buy=false ",
+				"Лес: 2026-11-22 18:00 18:00 Сцена на Ордынке buy=true /afisha/buy?event=20261122-1800-ord from=1000",
+				"Ревизор: " +
+					"2026-11-14 19:00 19:00 Историческая сцена buy=true /afisha/buy?event=20261114-1900-hist from=1500; " +
+					"2026-12-05 12:00 12:00 Историческая сцена buy=true /afisha/buy?event=20261205-1200-hist from=800",
+			},
+		},
+		{
+			// Массив событий без часового пояса, у сеанса несколько цен
+			id: "bdt",
+			want: []string{
+				"Материнское поле: 2026-11-28 18:00 18:00 Каменноостровский театр buy=true https://bdt.spb.ru/afisha/tickets/?date=2026-11-28T18:00&show=materinskoe-pole from=1200",
+				"Слава: 2026-11-21 19:00 19:00 Основная сцена buy=false ",
+				"Три сестры: " +
+					"2026-11-19 19:00 19:00 Основная сцена buy=true https://bdt.spb.ru/afisha/tickets/?date=2026-11-19T19:00&show=tri-sestry from=900; " +
+					"2026-12-06 19:00 19:00 Основная сцена buy=true https://bdt.spb.ru/afisha/tickets/?date=2026-12-06T19:00&show=tri-sestry from=1800",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			theater, ok := findTheater(tt.id)
+			if !ok {
+				t.Fatalf("%s is not in testdata/config.theaters.json", tt.id)
+			}
+			shows, err := fetchTheater(context.Background(), theater)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareLines(t, showLines(shows), tt.want)
+		})
+	}
+}
+
+func TestConfigTheaters(t *testing.T) {
+	cfg, err := loadAppConfig("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadAppConfig("testdata/config.theaters.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedByID := make(map[string]TheaterConfig)
+	for _, th := range saved.Providers.Theaters {
+		savedByID[th.ID] = th
+	}
+
+	cities := make(map[string]bool)
+	for _, th := range cfg.Providers.Theaters {
+		cities[th.City] = true
+		if !strings.HasPrefix(th.URL, "https://") {
+			t.Errorf("%s: url %q is not the site", th.ID, th.URL)
+		}
+		// У каждого театра из config.json есть сохраненная афиша с тем же форматом
+		savedTheater, ok := savedByID[th.ID]
+		if !ok {
+			t.Errorf("%s has no saved afisha in testdata/config.theaters.json", th.ID)
+			continue
+		}
+		if savedTheater.Name != th.Name || savedTheater.City != th.City || savedTheater.Provider != th.Provider || !strings.HasPrefix(savedTheater.URL, "file://testdata/") {
+			t.Errorf("%s: saved copy %+v does not match %+v", th.ID, savedTheater, th)
+		}
+	}
+	for _, city := range theaterCities {
+		if !cities[city] {
+			t.Errorf("config.json has no theater in %s", city)
+		}
+	}
+}
+
+func TestParseJSONLDDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // московское время; пусто — дата не разбирается
+	}{
+		{"2026-11-20T19:00:00+03:00", "2026-11-20 19:00"},
+		{"2026-12-05T15:00:00Z", "2026-12-05 18:00"},
+		{"2026-12-05T20:00:00+05:00", "2026-12-05 18:00"},
+		{"2026-11-27T19:00", "2026-11-27 19:00"},
+		{"2026-11-27T19:00:30", "2026-11-27 19:00"},
+		{" 2026-11-27 19:00 ", "2026-11-27 19:00"},
+		{"2026-11-27 19:00:00", "2026-11-27 19:00"},
+		{"27.11.2026 19:00", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseJSONLDDate(tt.in)
+		if !ok {
+			if tt.want != "" {
+				t.Errorf("parseJSONLDDate(%q) failed, want %s", tt.in, tt.want)
+			}
+			continue
+		}
+		if tt.want == "" || got.Format("2006-01-02 15:04") != tt.want || got.Location() != time.UTC {
+			t.Errorf("parseJSONLDDate(%q) = %v, want %s MSK labelled UTC", tt.in, got, tt.want)
+		}
+	}
+}
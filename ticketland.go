@@ -0,0 +1,210 @@
+// Package main содержит общий провайдер ленты Ticketland (ticketland_afisha/data.json).
+//
+// Этот файл реализует:
+// - Envelope, ShowDetail, Data, ShowEntry - формат ленты: сцена → "YYYY-MM-DD-HH-MM-SS" → сеанс
+// - decodeTicketlandFeed() - разбор ленты в сеансы с распарсенными датами
+// - ticketlandFeed - лента одного сайта: загрузка, сеансы, спектакли и ссылки покупки
+// - TICKETLAND_BUY_LINK - шаблон ссылки покупки по умолчанию, как на vakhtangov.ru
+//
+// Ленту в этом формате отдают многие театры, продающие билеты через Ticketland.
+// Сайты различаются только адресом ленты, адресом сайта и ссылкой покупки, поэтому
+// театр подключается одним конфигом: url, base_url и buy_link (см. TicketlandSiteConfig).
+//
+// Взаимодействует с:
+// - vakhtangov_api.go: vakhtangovFeed() - лента Вахтангова из providers.vakhtangov
+// - theaters.go: театры из providers.theaters с provider "ticketland", loadSource() загружает ленту
+// - config.go: TicketlandSiteConfig и проверка шаблона ссылки
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"parser/logger"
+)
+
+// TICKETLAND_BUY_LINK — ссылка покупки по умолчанию; {stageuid} и {datetime} берутся из ленты,
+// относительная ссылка дополняется адресом сайта
+const TICKETLAND_BUY_LINK = "/tickets/buy/?datetime={datetime}&stageuid={stageuid}"
+
+type Envelope struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Data      string    `json:"data"`
+}
+
+type ShowDetail struct {
+	Title       string `json:"title"`
+	StartDate   string `json:"start_date"`
+	Script      string `json:"script"`
+	HasTickets  bool   `json:"has_tickets"`
+	SalesOn     bool   `json:"sales_on"`
+	RevealDT    string `json:"reveal_dt"`
+	RevealDTStr string `json:"reveal_dt_str"`
+	Now         string `json:"now"`
+}
+
+type Data map[string]map[string]ShowDetail
+
+// ShowEntry holds one show with its date time parsed
+type ShowEntry struct {
+	StageUID    string
+	DateTimeKey string
+	Start       time.Time
+	Detail      ShowDetail
+}
+
+// ticketlandFeed — лента одного сайта
+type ticketlandFeed struct {
+	provider string // метка в метриках
+	url      string // data.json на сайте или file:// с сохраненной копией
+	site     TicketlandSiteConfig
+}
+
+// Sessions loads the feed and returns every session in it
+func (f ticketlandFeed) Sessions(ctx context.Context) ([]ShowEntry, error) {
+	ctx = logger.WithProvider(ctx, f.provider)
+	body, err := loadSource(ctx, f.provider, f.url)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, all, err := decodeTicketlandFeed(bytes.NewReader(body))
+	if err != nil {
+		parseFailures.WithLabelValues(f.provider).Inc()
+		return nil, fmt.Errorf("%s: %w", f.url, err)
+	}
+	logger.From(ctx).Named("api").Infof("CreatedAt: %v", createdAt)
+	return all, nil
+}
+
+// Shows groups sessions into shows by title; stages names stage UIDs
+func (f ticketlandFeed) Shows(entries []ShowEntry, stages map[string]string) []Show {
+	byTitle := make(map[string]*Show)
+	var order []string
+	for _, e := range entries {
+		title := strings.TrimSpace(html.UnescapeString(e.Detail.Title))
+		if title == "" {
+			continue
+		}
+		sh, ok := byTitle[title]
+		if !ok {
+			sh = &Show{Title: title}
+			byTitle[title] = sh
+			order = append(order, title)
+		}
+		canBuy := e.Detail.HasTickets || e.Detail.SalesOn
+		buyLink := ""
+		if canBuy {
+			buyLink = f.BuyLink(e.StageUID, e.DateTimeKey)
+		}
+		sh.Info = append(sh.Info, ShowInfo{
+			Date:    stringifyDateWithYear(e.Start),
+			Weekday: weekdayRu(e.Start.Weekday()),
+			Time:    e.Start.Format("15:04"),
+			Stage:   stages[e.StageUID],
+			CanBuy:  canBuy,
+			BuyLink: buyLink,
+
+			Start:       e.Start,
+			StageUID:    e.StageUID,
+			DateTimeKey: e.DateTimeKey,
+		})
+	}
+
+	shows := make([]Show, 0, len(order))
+	for _, title := range order {
+		shows = append(shows, *byTitle[title])
+	}
+	return shows
+}
+
+// BuyLink fills the buy link template for a session.
+// Без base_url сайтом считается хост ленты; у сохраненной копии (file://) без base_url ссылки нет.
+func (f ticketlandFeed) BuyLink(stageUID, datetimeKey string) string {
+	stage := strings.TrimSpace(stageUID)
+	datetime := strings.TrimSpace(datetimeKey)
+	if stage == "" || datetime == "" {
+		return ""
+	}
+
+	template := f.site.BuyLink
+	if template == "" {
+		template = TICKETLAND_BUY_LINK
+	}
+	link := strings.NewReplacer(
+		"{stageuid}", url.QueryEscape(stage),
+		"{datetime}", url.QueryEscape(datetime),
+	).Replace(template)
+
+	base, ok := f.siteURL()
+	if !ok {
+		if u, err := url.Parse(link); err == nil && u.IsAbs() {
+			return link
+		}
+		return ""
+	}
+	u, err := base.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// siteURL is base_url, or the scheme and host of an http(s) feed
+func (f ticketlandFeed) siteURL() (*url.URL, bool) {
+	raw := f.site.BaseURL
+	if raw == "" {
+		raw = f.url
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, false
+	}
+	if f.site.BaseURL == "" {
+		return &url.URL{Scheme: u.Scheme, Host: u.Host}, true
+	}
+	return u, true
+}
+
+// decodeTicketlandFeed parses a ticketland_afisha/data.json feed into sessions
+func decodeTicketlandFeed(r io.Reader) (time.Time, []ShowEntry, error) {
+	var env Envelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return time.Time{}, nil, fmt.Errorf("error unmarshalling data: %w", err)
+	}
+
+	var d Data
+	if err := json.Unmarshal([]byte(env.Data), &d); err != nil {
+		return time.Time{}, nil, fmt.Errorf("error unmarshalling data: %w", err)
+	}
+
+	// 1) collect all shows into one slice
+	var all []ShowEntry
+	for stageUID, shows := range d {
+		for key, detail := range shows {
+			// parse the key "YYYY-MM-DD-HH-MM-SS"
+			t, err := time.Parse("2006-01-02-15-04-05", key)
+			if err != nil {
+				// fallback to parsing detail.StartDate if needed
+				t, err = time.Parse(time.RFC3339, detail.StartDate)
+				if err != nil {
+					return time.Time{}, nil, fmt.Errorf("cannot parse date %q: %w", key, err)
+				}
+			}
+			all = append(all, ShowEntry{
+				StageUID:    stageUID,
+				DateTimeKey: key,
+				Start:       t,
+				Detail:      detail,
+			})
+		}
+	}
+
+	return env.CreatedAt, all, nil
+}
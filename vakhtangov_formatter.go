@@ -1,33 +1,35 @@
 // Package main содержит API-слой для получения и форматирования информации о спектаклях.
 //
 // Этот файл реализует:
-// - FetchAllShows() - параллельный парсинг всех URL из конфигурации
-// - RenderShowMarkdown() и RenderShowsMarkdown() - форматирование спектаклей в Markdown для Telegram
-// - escapeMarkdown() - экранирование специальных символов MarkdownV2
+// - FetchAllShows() - параллельный парсинг всех URL из конфигурации с фильтром ShowFilter
+// - RenderShowMarkdown() и RenderShowsMarkdown() - форматирование спектаклей для Telegram через TelegramRenderer
+// - RenderShowDetailMarkdown() - подробная карточка спектакля: сеансы, сцена, состав, ссылки, цены и места
+// - RenderShowsMarkdownBlocks() - отдельные блоки по спектаклям для постраничного вывода
 //
 // Взаимодействует с:
-// - main.go: использует loadConfig() для загрузки конфигурации и parsePages() для парсинга страниц
+// - config.go: список страниц спектаклей берется из currentConfig() (загружается loadAppConfig())
+// - main.go: использует parsePages() для парсинга страниц
 // - vakhtangov_api.go: использует GetAvailableShows() для получения доступных спектаклей из API
+// - telegram_renderer.go: экранирование и разметка для выбранного режима Telegram
+// - i18n.go: подписи и даты сеансов на языке рендерера
 package main
 
 import (
 	"context"
-	"fmt"
 	"sort"
 	"strings"
 	"sync"
 )
 
-// FetchAllShows loads config and returns parsed shows for all URLs
-func FetchAllShows(ctx context.Context) ([]Show, error) {
-	cfg, err := loadConfig("config.json")
-	if err != nil {
-		return nil, err
-	}
-	available, err := GetAvailableShows()
+// FetchAllShows loads config and returns parsed shows for all URLs.
+// Сеансы отбираются фильтром; при непустом фильтре спектакли без сеансов пропускаются.
+func FetchAllShows(ctx context.Context, filter ShowFilter) ([]Show, error) {
+	cfg := currentConfig().Providers.Vakhtangov
+	available, err := GetAvailableShows(ctx)
 	if err != nil {
 		return nil, err
 	}
+	available = filter.Apply(available)
 	wg := &sync.WaitGroup{}
 	wg.Add(len(cfg.URLs))
 	out := make(chan Show, len(cfg.URLs))
@@ -35,7 +37,7 @@ func FetchAllShows(ctx context.Context) ([]Show, error) {
 	for _, url := range cfg.URLs {
 		go func(url string) {
 			defer wg.Done()
-			show := parsePages(ctx, url, available)
+			show := parsePages(ctx, url, available, cfg.Stages)
 			out <- show
 		}(url)
 	}
@@ -47,75 +49,99 @@ func FetchAllShows(ctx context.Context) ([]Show, error) {
 
 	var shows []Show
 	for sh := range out {
+		if !filter.IsEmpty() && len(sh.Info) == 0 {
+			continue
+		}
 		shows = append(shows, sh)
 	}
 	return shows, nil
 }
 
-// RenderShowMarkdown formats a single show for Telegram Markdown
-func RenderShowMarkdown(show Show) string {
+// RenderShowMarkdown formats a single show for Telegram using the given renderer
+func RenderShowMarkdown(r TelegramRenderer, show Show) string {
 	var b strings.Builder
 	// Title
-	b.WriteString(fmt.Sprintf("*%s*\n", escapeMarkdown(show.Title)))
+	b.WriteString(r.Bold(show.Title) + "\n")
 	if len(show.Info) > 0 {
-		b.WriteString("✅ Билеты доступны\n\n")
-		b.WriteString("Опции покупки:\n")
+		b.WriteString(r.Escape(tr(r.Lang(), "show.available")) + "\n\n")
+		b.WriteString(r.Escape(tr(r.Lang(), "show.buy_options")) + "\n")
 	} else {
-		b.WriteString("❌ Билеты не доступны\n\n")
+		b.WriteString(r.Escape(tr(r.Lang(), "show.unavailable")) + "\n\n")
 	}
 	// Sessions
 	for _, inf := range show.Info {
 		// Date line: 02 Mon 15:04 style localized we already have Date/Weekday/Time
-		b.WriteString(fmt.Sprintf("• %s, %s, %s\n",
-			escapeMarkdown(inf.Date),
-			escapeMarkdown(inf.Weekday),
-			escapeMarkdown(inf.Time),
-		))
+		b.WriteString(r.Escape("• "+sessionDate(r.Lang(), inf)) + "\n")
 		if inf.CanBuy && inf.BuyLink != "" {
-			b.WriteString(fmt.Sprintf("  → [Купить билет](%s)\n", inf.BuyLink))
+			b.WriteString(r.Escape("  → ") + r.Link(tr(r.Lang(), "show.buy"), inf.BuyLink) + "\n")
 		}
 	}
 	return b.String()
 }
 
-// RenderShowsMarkdown formats multiple shows into a single Telegram message
-func RenderShowsMarkdown(shows []Show) string {
+// RenderShowDetailMarkdown formats one show with stage and cast for the drill-down screen
+func RenderShowDetailMarkdown(r TelegramRenderer, show Show) string {
+	var b strings.Builder
+	b.WriteString(r.Bold(show.Title) + "\n")
+	if len(show.Cast) > 0 {
+		b.WriteString("\n" + r.Bold(tr(r.Lang(), "show.cast")) + " " + r.Escape(strings.Join(show.Cast, ", ")) + "\n")
+	}
+	if len(show.Info) == 0 {
+		b.WriteString("\n" + r.Escape(tr(r.Lang(), "show.unavailable")) + "\n")
+		return b.String()
+	}
+	b.WriteString("\n" + r.Bold(tr(r.Lang(), "show.sessions")) + "\n")
+	for _, inf := range show.Info {
+		line := "• " + sessionDate(r.Lang(), inf)
+		if inf.Stage != "" {
+			line += " — " + inf.Stage
+		}
+		b.WriteString(r.Escape(line) + "\n")
+		if inf.CanBuy && inf.BuyLink != "" {
+			b.WriteString(r.Escape("  → ") + r.Link(tr(r.Lang(), "show.buy"), inf.BuyLink) + "\n")
+			if inf.Tickets != nil {
+				b.WriteString(renderTicketInfo(r, *inf.Tickets))
+			}
+		} else {
+			b.WriteString(r.Escape("  "+tr(r.Lang(), "show.no_tickets")) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// renderTicketInfo formats prices and free seats of a session, by zone when the hall has several
+func renderTicketInfo(r TelegramRenderer, t TicketInfo) string {
+	summary := ticketSummary(r.Lang(), t)
+	if summary == "" {
+		return ""
+	}
+	out := r.Escape("  💰 "+summary) + "\n"
+	if len(t.Zones) < 2 {
+		return out
+	}
+	for _, z := range t.Zones {
+		out += r.Escape("    "+z.Name+": "+ticketSummary(r.Lang(), TicketInfo{MinPrice: z.MinPrice, Seats: z.Seats})) + "\n"
+	}
+	return out
+}
+
+// showsSeparator разделяет спектакли в сообщении Telegram
+const showsSeparator = "\n〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️️\n"
+
+// RenderShowsMarkdownBlocks formats every show separately, sorted by title
+func RenderShowsMarkdownBlocks(r TelegramRenderer, shows []Show) []string {
 	// Сортируем спектакли по названию для стабильного порядка вывода
 	sort.Slice(shows, func(i, j int) bool {
 		return shows[i].Title < shows[j].Title
 	})
-	var b strings.Builder
-	for i, sh := range shows {
-		if i > 0 {
-			b.WriteString("\n〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️〰️️\n")
-		}
-		b.WriteString(RenderShowMarkdown(sh))
+	blocks := make([]string, 0, len(shows))
+	for _, sh := range shows {
+		blocks = append(blocks, RenderShowMarkdown(r, sh))
 	}
-	return b.String()
+	return blocks
 }
 
-// escapeMarkdown escapes Telegram MarkdownV2-sensitive characters minimally.
-// Here we target basic Markdown (not V2) symbols used: _, *, [, ], (, ), ~, `, >, #, +, -, =, |, {, }, ., !
-func escapeMarkdown(s string) string {
-	replacer := strings.NewReplacer(
-		"_", "\\_",
-		"*", "\\*",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-		"~", "\\~",
-		"`", "\\`",
-		">", "\\>",
-		"#", "\\#",
-		"+", "\\+",
-		"-", "\\-",
-		"=", "\\=",
-		"|", "\\|",
-		"{", "\\{",
-		"}", "\\}",
-		".", "\\.",
-		"!", "\\!",
-	)
-	return replacer.Replace(strings.TrimSpace(s))
+// RenderShowsMarkdown formats multiple shows into a single Telegram message
+func RenderShowsMarkdown(r TelegramRenderer, shows []Show) string {
+	return strings.Join(RenderShowsMarkdownBlocks(r, shows), showsSeparator)
 }
@@ -0,0 +1,361 @@
+// Package main содержит загрузку цен и свободных мест со страницы покупки билетов Вахтангова.
+//
+// Этот файл реализует:
+// - fetchTicketInfo() - разбор страницы /tickets/buy/?stageuid=…&datetime=…: цены и свободные места по зонам
+// - ticketStore - кеш информации о билетах по сеансам, чтобы не загружать страницу покупки на каждый запрос
+// - ticketSummary() - строка вида "от 1500 ₽, осталось ~40 мест" на языке интерфейса (i18n.go)
+//
+// Страница покупки загружается только для сеансов в продаже и только когда информация нужна:
+// при открытии карточки спектакля и перед рассылкой уведомлений. Число мест приблизительное:
+// схема зала показывает места, свободные в момент загрузки.
+//
+// Разметка схемы зала, которую ожидает parseTicketPage(), — в testdata/vakhtangov_buy.html.
+//
+// Взаимодействует с:
+// - ticketland.go: ссылку на страницу покупки строит ticketlandFeed.BuyLink()
+// - vakhtangov_formatter.go: RenderShowDetailMarkdown() выводит цены и места сеанса
+// - telegram_subscriptions.go: цены в уведомлениях и фильтр /maxprice
+// - metrics.go: загрузки учитываются с провайдером vakhtangov_tickets
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"parser/logger"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// TICKET_INFO_TTL — сколько хранится загруженная информация о билетах сеанса
+const TICKET_INFO_TTL = 15 * time.Minute
+
+// TICKET_FETCH_WORKERS — сколько страниц покупки загружается одновременно
+const TICKET_FETCH_WORKERS = 4
+
+// TicketZone — цены и свободные места в одной зоне зала (партер, амфитеатр, балкон)
+type TicketZone struct {
+	Name     string `json:"name"`
+	MinPrice int    `json:"min_price"`
+	MaxPrice int    `json:"max_price"`
+	Seats    int    `json:"seats"` // 0 — количество мест неизвестно
+}
+
+// TicketInfo — цены и свободные места сеанса в рублях
+type TicketInfo struct {
+	MinPrice int          `json:"min_price"`
+	MaxPrice int          `json:"max_price"`
+	Seats    int          `json:"seats"` // 0 — количество мест неизвестно
+	Zones    []TicketZone `json:"zones,omitempty"`
+}
+
+// Классы и статусы, которыми схема зала помечает занятые места
+var busySeatMarkers = []string{"busy", "sold", "occupied", "reserved", "disabled", "unavailable"}
+
+// pricePattern находит цены вида "1 500 ₽", "1.500 ₽" или "1500 руб."
+var pricePattern = regexp.MustCompile(`(\d[\d\s\x{00a0}.,]*)\s*(?:₽|руб)`)
+
+// fetchTicketInfo loads the buy page of a session and parses prices and free seats
+func fetchTicketInfo(ctx context.Context, buyLink string) (TicketInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, currentConfig().Timeouts.Fetch.Duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", buyLink, nil)
+	if err != nil {
+		return TicketInfo{}, fmt.Errorf("failed to load tickets %s: %w", buyLink, err)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	observeFetch(providerVakhtangovTickets, start, resp)
+	if err != nil {
+		return TicketInfo{}, fmt.Errorf("failed to load tickets %s: %w", buyLink, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return TicketInfo{}, fmt.Errorf("failed to load tickets %s: status %d", buyLink, resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		parseFailures.WithLabelValues(providerVakhtangovTickets).Inc()
+		return TicketInfo{}, fmt.Errorf("failed to parse tickets %s: %w", buyLink, err)
+	}
+	info, ok := parseTicketPage(doc)
+	if !ok {
+		parseFailures.WithLabelValues(providerVakhtangovTickets).Inc()
+		return TicketInfo{}, fmt.Errorf("no prices found on %s", buyLink)
+	}
+	return info, nil
+}
+
+// parseTicketPage reads the hall scheme: every free seat carries its price and zone.
+// Если схемы нет (например, продажа без выбора мест), берется только диапазон цен из текста.
+func parseTicketPage(doc *goquery.Document) (TicketInfo, bool) {
+	zones := make(map[string]*TicketZone)
+	var order []string
+	doc.Find("[data-price]").Each(func(i int, s *goquery.Selection) {
+		if isBusySeat(s) {
+			return
+		}
+		raw, _ := s.Attr("data-price")
+		price := parsePrice(raw)
+		if price <= 0 {
+			return
+		}
+		name := seatZone(s)
+		z, ok := zones[name]
+		if !ok {
+			z = &TicketZone{Name: name}
+			zones[name] = z
+			order = append(order, name)
+		}
+		z.Seats++
+		z.MinPrice = minPrice(z.MinPrice, price)
+		z.MaxPrice = max(z.MaxPrice, price)
+	})
+
+	var info TicketInfo
+	for _, name := range order {
+		z := *zones[name]
+		info.Zones = append(info.Zones, z)
+		info.Seats += z.Seats
+		info.MinPrice = minPrice(info.MinPrice, z.MinPrice)
+		info.MaxPrice = max(info.MaxPrice, z.MaxPrice)
+	}
+	if info.MinPrice > 0 {
+		sort.SliceStable(info.Zones, func(i, j int) bool { return info.Zones[i].MinPrice > info.Zones[j].MinPrice })
+		return info, true
+	}
+
+	// Схемы зала нет: ищем цены в блоках с ценой
+	doc.Find(".price, [class*='price'], [class*='cost']").Each(func(i int, s *goquery.Selection) {
+		for _, m := range pricePattern.FindAllStringSubmatch(s.Text(), -1) {
+			if price := parsePrice(m[1]); price > 0 {
+				info.MinPrice = minPrice(info.MinPrice, price)
+				info.MaxPrice = max(info.MaxPrice, price)
+			}
+		}
+	})
+	return info, info.MinPrice > 0
+}
+
+// isBusySeat reports whether the scheme marks the seat as taken
+func isBusySeat(s *goquery.Selection) bool {
+	status := strings.ToLower(s.AttrOr("data-status", "") + " " + s.AttrOr("class", ""))
+	for _, marker := range busySeatMarkers {
+		if strings.Contains(status, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// seatZone returns the zone name of a seat from its attributes or the enclosing zone block
+func seatZone(s *goquery.Selection) string {
+	for _, attr := range []string{"data-zone", "data-sector", "data-zone-name"} {
+		if v := strings.TrimSpace(s.AttrOr(attr, "")); v != "" {
+			return v
+		}
+	}
+	zone := s.Closest("[data-zone-name], [data-zone], .zone, .sector")
+	if v := strings.TrimSpace(zone.AttrOr("data-zone-name", zone.AttrOr("data-zone", ""))); v != "" {
+		return v
+	}
+	if v := strings.Join(strings.Fields(zone.Find(".zone-name, .sector-name, .title").First().Text()), " "); v != "" {
+		return v
+	}
+	return "Зал"
+}
+
+// parsePrice converts "1 500", "1.500", "1,500", "1500.00" or "1500 ₽" into rubles.
+// Точка или запятая, за которой ровно три цифры, — разделитель тысяч, иначе — копейки.
+func parsePrice(s string) int {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "₽", "").Replace(strings.TrimSpace(s))
+	var digits strings.Builder
+scan:
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits.WriteByte(c)
+		case (c == '.' || c == ',') && digits.Len() > 0:
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			if j-i-1 == 3 {
+				continue
+			}
+			// Копейки отбрасываем; после них в строке ничего не должно остаться
+			if j != len(s) {
+				return 0
+			}
+			break scan
+		default:
+			return 0
+		}
+	}
+	n, err := strconv.Atoi(digits.String())
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// minPrice returns the smaller price, treating 0 as "not set"
+func minPrice(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// ticketSummary renders "от 1500 ₽, осталось ~40 мест" in the given language; empty when nothing is known
+func ticketSummary(lang string, t TicketInfo) string {
+	var parts []string
+	if t.MinPrice > 0 {
+		parts = append(parts, tr(lang, "tickets.from_price", t.MinPrice))
+	}
+	if t.Seats > 0 {
+		parts = append(parts, tr(lang, "tickets.seats_left", t.Seats, seatsWordLang(lang, t.Seats)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// seatsWord agrees "место" with the number
+func seatsWord(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 14:
+		return "мест"
+	case n%10 == 1:
+		return "место"
+	case n%10 >= 2 && n%10 <= 4:
+		return "места"
+	}
+	return "мест"
+}
+
+type ticketEntry struct {
+	info TicketInfo
+	ok   bool // false — страницу загрузить не удалось, повторим после TICKET_INFO_TTL
+	at   time.Time
+}
+
+// ticketStore caches ticket information per session
+type ticketStore struct {
+	mu      sync.Mutex
+	entries map[string]ticketEntry
+	sem     chan struct{}
+}
+
+var tickets = newTicketStore()
+
+func newTicketStore() *ticketStore {
+	return &ticketStore{
+		entries: make(map[string]ticketEntry),
+		sem:     make(chan struct{}, TICKET_FETCH_WORKERS),
+	}
+}
+
+// cached returns fresh ticket information without loading anything
+func (s *ticketStore) cached(key string) (TicketInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, found := s.entries[key]
+	if !found || time.Since(e.at) > TICKET_INFO_TTL {
+		return TicketInfo{}, false
+	}
+	return e.info, e.ok
+}
+
+// get returns ticket information for the session, loading the buy page when the cache is stale
+func (s *ticketStore) get(ctx context.Context, key, buyLink string) (TicketInfo, bool) {
+	s.mu.Lock()
+	e, found := s.entries[key]
+	s.mu.Unlock()
+	if found && time.Since(e.at) <= TICKET_INFO_TTL {
+		return e.info, e.ok
+	}
+	if buyLink == "" {
+		return TicketInfo{}, false
+	}
+
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return TicketInfo{}, false
+	}
+	ctx = logger.WithProvider(ctx, providerVakhtangovTickets)
+	info, err := fetchTicketInfo(ctx, buyLink)
+	<-s.sem
+	if err != nil {
+		logger.From(ctx).Warnf("Ticket info unavailable: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, old := range s.entries {
+		if now.Sub(old.at) > TICKET_INFO_TTL {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = ticketEntry{info: info, ok: err == nil, at: now}
+	return info, err == nil
+}
+
+// withTickets returns a copy of the show with ticket information for sessions on sale
+func (s *ticketStore) withTickets(ctx context.Context, sh Show) Show {
+	sh.Info = append([]ShowInfo(nil), sh.Info...)
+	var wg sync.WaitGroup
+	for i := range sh.Info {
+		inf := &sh.Info[i]
+		if !inf.CanBuy {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if t, ok := s.get(ctx, performanceKey(*inf), inf.BuyLink); ok {
+				inf.Tickets = &t
+			}
+		}()
+	}
+	wg.Wait()
+	return sh
+}
+
+// withCachedTickets is withTickets without loading: for answers that can't wait for the site
+func (s *ticketStore) withCachedTickets(sh Show) Show {
+	sh.Info = append([]ShowInfo(nil), sh.Info...)
+	for i := range sh.Info {
+		if t, ok := s.cached(performanceKey(sh.Info[i])); ok {
+			sh.Info[i].Tickets = &t
+		}
+	}
+	return sh
+}
+
+// annotateChanges fills prices and seats of changes that put tickets on sale
+func (s *ticketStore) annotateChanges(ctx context.Context, changes []PerformanceChange) {
+	var wg sync.WaitGroup
+	for i := range changes {
+		ch := &changes[i]
+		if !ch.NewOnSale {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if t, ok := s.get(ctx, ch.StageUID+"/"+ch.DateTimeKey, ch.BuyLink); ok {
+				ch.MinPrice, ch.SeatsLeft = t.MinPrice, t.Seats
+			}
+		}()
+	}
+	wg.Wait()
+}
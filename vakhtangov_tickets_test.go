@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"1500", 1500},
+		{"1 500", 1500},
+		{"1 500 ₽", 1500},
+		{"1.500", 1500},
+		{"1,500", 1500},
+		{"12.000.000", 12000000},
+		{"1500.00", 1500},
+		{"1500,5", 1500},
+		{"1.500,00", 1500},
+		{"1,500.00", 1500},
+		{"", 0},
+		{"бесплатно", 0},
+		{"1.5.0", 0},
+		{".500", 0},
+	}
+	for _, tt := range tests {
+		if got := parsePrice(tt.in); got != tt.want {
+			t.Errorf("parsePrice(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTicketPage(t *testing.T) {
+	f, err := os.Open("testdata/vakhtangov_buy.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, ok := parseTicketPage(doc)
+	if !ok {
+		t.Fatal("no prices found")
+	}
+	want := TicketInfo{
+		MinPrice: 1500,
+		MaxPrice: 7500,
+		Seats:    8,
+		Zones: []TicketZone{
+			{Name: "Партер", MinPrice: 5000, MaxPrice: 7500, Seats: 3},
+			{Name: "Амфитеатр", MinPrice: 3000, MaxPrice: 3000, Seats: 2},
+			{Name: "Балкон 1-го яруса", MinPrice: 1500, MaxPrice: 1500, Seats: 3},
+		},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("parseTicketPage =\n%+v\nwant\n%+v", info, want)
+	}
+}
+
+func TestParseTicketPageWithoutScheme(t *testing.T) {
+	page := `<div class="session-price">Билеты: от 1 200 ₽ до 4 500 руб.</div><div class="cost">2.500 ₽</div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := parseTicketPage(doc)
+	if !ok || info.MinPrice != 1200 || info.MaxPrice != 4500 || info.Seats != 0 || info.Zones != nil {
+		t.Errorf("parseTicketPage = %+v, %v", info, ok)
+	}
+}